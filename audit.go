@@ -0,0 +1,118 @@
+package jsonrest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// An AuditRecord describes a request handled by an endpoint, for compliance
+// purposes.
+type AuditRecord struct {
+	Time      time.Time         `json:"time"`
+	Principal string            `json:"principal,omitempty"`
+	Method    string            `json:"method"`
+	Route     string            `json:"route"`
+	Path      string            `json:"path"`
+	Params    map[string]string `json:"params,omitempty"`
+	Status    int               `json:"status"`
+	Duration  time.Duration     `json:"duration"`
+
+	// Payloads holds the values passed to Request.Audit by the endpoint, e.g.
+	// a diff of the modified resource.
+	Payloads []interface{} `json:"payloads,omitempty"`
+}
+
+// An AuditSink delivers audit records, e.g. to a log, a message queue or an
+// HTTP collector. Audit is called synchronously once the endpoint returns, so
+// slow sinks should buffer records and deliver them in the background.
+type AuditSink interface {
+	Audit(ctx context.Context, rec *AuditRecord)
+}
+
+// The AuditSinkFunc type is an adapter to allow the use of ordinary functions
+// as audit sinks.
+type AuditSinkFunc func(ctx context.Context, rec *AuditRecord)
+
+// Audit calls f(ctx, rec).
+func (f AuditSinkFunc) Audit(ctx context.Context, rec *AuditRecord) {
+	f(ctx, rec)
+}
+
+// jsonAuditSink writes audit records as JSON lines.
+type jsonAuditSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONAuditSink returns an AuditSink writing each record to w as a line
+// of JSON, e.g. to os.Stdout. It is safe for concurrent use.
+func NewJSONAuditSink(w io.Writer) AuditSink {
+	return &jsonAuditSink{enc: json.NewEncoder(w)}
+}
+
+// Audit implements the AuditSink interface.
+func (s *jsonAuditSink) Audit(_ context.Context, rec *AuditRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = s.enc.Encode(rec)
+}
+
+type auditPayloadsKey struct{}
+
+// AuditMiddleware returns a middleware delivering an audit record of each
+// request to the sink. The principal is the one set by an authentication
+// middleware with SetPrincipal, and the status is the one the response will
+// be sent with.
+func AuditMiddleware(sink AuditSink) Middleware {
+	return func(next Endpoint) Endpoint {
+		return func(ctx context.Context, req *Request) (interface{}, error) {
+			start := time.Now()
+			var payloads []interface{}
+			req.Set(auditPayloadsKey{}, &payloads)
+
+			result, err := next(ctx, req)
+
+			rec := &AuditRecord{
+				Time:      start,
+				Principal: req.Principal(),
+				Method:    req.Method(),
+				Route:     req.Route(),
+				Path:      req.URL().Path,
+				Status:    responseStatus(result, err),
+				Duration:  time.Since(start),
+				Payloads:  payloads,
+			}
+			if len(req.params) > 0 {
+				rec.Params = make(map[string]string, len(req.params))
+				for _, p := range req.params {
+					rec.Params[p.Key] = p.Value
+				}
+			}
+			sink.Audit(ctx, rec)
+			return result, err
+		}
+	}
+}
+
+// Audit attaches the payload, e.g. a diff of the modified resource, to the
+// request's audit record. It is a no-op if AuditMiddleware is not used.
+func (r *Request) Audit(payload interface{}) {
+	if payloads, ok := r.Get(auditPayloadsKey{}).(*[]interface{}); ok {
+		*payloads = append(*payloads, payload)
+	}
+}
+
+// responseStatus returns the status code the result or error of an endpoint
+// will be sent with.
+func responseStatus(result interface{}, err error) int {
+	if err != nil {
+		return translateError(err, false).StatusCode()
+	}
+	if res, ok := result.(Response); ok {
+		return res.StatusCode
+	}
+	return 200
+}
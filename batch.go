@@ -0,0 +1,200 @@
+package jsonrest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// BatchOptions configures Router.Batch.
+type BatchOptions struct {
+	// MaxRequests is the maximum number of sub-requests of a batch. It
+	// defaults to 20.
+	MaxRequests int
+
+	// MaxBodySize is the maximum size of the body of a batch. It defaults to
+	// 1 MiB.
+	MaxBodySize int64
+
+	// Concurrency is the number of sub-requests dispatched concurrently. It
+	// defaults to 1: the sub-requests are dispatched in order.
+	Concurrency int
+}
+
+// A BatchRequest is a sub-request of a batch.
+type BatchRequest struct {
+	// ID, if set, is copied to the response of the sub-request.
+	ID      string            `json:"id,omitempty"`
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// A BatchResponse is the response of a sub-request of a batch.
+type BatchResponse struct {
+	ID      string            `json:"id,omitempty"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// batchKey is the context key marking the sub-requests of a batch.
+type batchKey struct{}
+
+// Batch registers a POST endpoint at path running several requests in one
+// HTTP call. The body is an array of BatchRequest:
+//
+//	[
+//	  {"id": "a", "method": "GET", "path": "/users/1"},
+//	  {"id": "b", "method": "POST", "path": "/orders", "body": {"sku": "X1"}}
+//	]
+//
+// Each sub-request is dispatched through the root router, so that it runs
+// the middleware and error translation of its route, with the headers of the
+// batch request overridden by its own. The response is an array of
+// BatchResponse, in the order of the sub-requests, with a 200 status even if
+// some sub-requests failed:
+//
+//	[
+//	  {"id": "a", "status": 200, "body": {"id": 1, "name": "Ada"}},
+//	  {"id": "b", "status": 422, "body": {"error": {...}}}
+//	]
+//
+// Batches exceeding BatchOptions.MaxRequests or MaxBodySize are rejected with
+// a 413 error, and batches cannot be nested.
+func (r *Router) Batch(path string, opts BatchOptions, routeOpts ...RouteOption) {
+	if opts.MaxRequests <= 0 {
+		opts.MaxRequests = 20
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 1 << 20
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	root := r.root()
+	r.Post(path, func(ctx context.Context, req *Request) (interface{}, error) {
+		if req.Raw().Context().Value(batchKey{}) != nil {
+			return nil, BadRequest("batch requests cannot be nested")
+		}
+		if req.Raw().Body == nil {
+			return nil, BadRequest("missing request body")
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(req.Raw().Body, opts.MaxBodySize+1))
+		if err != nil {
+			return nil, BadRequest("cannot read request body").Wrap(err)
+		}
+		if int64(len(body)) > opts.MaxBodySize {
+			return nil, errBodyTooLarge()
+		}
+		var batch []BatchRequest
+		if err := json.Unmarshal(body, &batch); err != nil {
+			return nil, BadRequest("body must be an array of requests").Wrap(err)
+		}
+		if len(batch) > opts.MaxRequests {
+			return nil, Error(http.StatusRequestEntityTooLarge, "batch_too_large", fmt.Sprintf("batch exceeds the maximum of %d requests", opts.MaxRequests))
+		}
+
+		responses := make([]BatchResponse, len(batch))
+		sem := make(chan struct{}, opts.Concurrency)
+		var wg sync.WaitGroup
+		for i := range batch {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(i int) {
+				defer func() { <-sem; wg.Done() }()
+				responses[i] = root.serveBatchRequest(req.Raw(), batch[i])
+			}(i)
+		}
+		wg.Wait()
+		return responses, nil
+	}, routeOpts...)
+}
+
+// serveBatchRequest dispatches a sub-request of the batch request parent, and
+// returns its response.
+func (r *Router) serveBatchRequest(parent *http.Request, br BatchRequest) BatchResponse {
+	res := BatchResponse{ID: br.ID}
+	if br.Method == "" || !strings.HasPrefix(br.Path, "/") {
+		res.Status = http.StatusBadRequest
+		res.Body, _ = json.Marshal(BadRequest("method and an absolute path are required"))
+		return res
+	}
+	u, err := url.ParseRequestURI(br.Path)
+	if err != nil {
+		res.Status = http.StatusBadRequest
+		res.Body, _ = json.Marshal(BadRequest("invalid path"))
+		return res
+	}
+
+	ctx := context.WithValue(parent.Context(), batchKey{}, true)
+	sub := parent.Clone(ctx)
+	sub.Method = strings.ToUpper(br.Method)
+	sub.URL, sub.RequestURI = u, br.Path
+	sub.Header.Del("Accept-Encoding")
+	sub.Header.Del("Content-Length")
+	sub.Body, sub.ContentLength, sub.GetBody = http.NoBody, 0, nil
+	if len(br.Body) > 0 && string(br.Body) != "null" {
+		sub.Body = ioutil.NopCloser(bytes.NewReader(br.Body))
+		sub.ContentLength = int64(len(br.Body))
+		sub.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range br.Headers {
+		sub.Header.Set(k, v)
+	}
+
+	w := &batchResponseWriter{header: http.Header{}}
+	r.ServeHTTP(w, sub)
+
+	res.Status = w.status
+	if res.Status == 0 {
+		res.Status = http.StatusOK
+	}
+	for k := range w.header {
+		if k == "Content-Type" || k == "Content-Length" {
+			continue
+		}
+		if res.Headers == nil {
+			res.Headers = map[string]string{}
+		}
+		res.Headers[k] = w.header.Get(k)
+	}
+	if b := bytes.TrimSpace(w.body.Bytes()); len(b) > 0 {
+		if json.Valid(b) {
+			res.Body = b
+		} else {
+			res.Body, _ = json.Marshal(string(b))
+		}
+	}
+	return res
+}
+
+// batchResponseWriter records the response of a sub-request of a batch.
+type batchResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *batchResponseWriter) Header() http.Header { return w.header }
+
+func (w *batchResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *batchResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
@@ -0,0 +1,131 @@
+package jsonrest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/mbranch/jsonrest-go"
+)
+
+type benchItem struct {
+	ID    int      `json:"id"`
+	Name  string   `json:"name"`
+	Tags  []string `json:"tags"`
+	Price float64  `json:"price"`
+}
+
+func benchItems(n int) []benchItem {
+	items := make([]benchItem, n)
+	for i := range items {
+		items[i] = benchItem{ID: i, Name: "item", Tags: []string{"a", "b"}, Price: 9.99}
+	}
+	return items
+}
+
+func benchServe(b *testing.B, h http.Handler, path string) {
+	b.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
+func BenchmarkRouting(b *testing.B) {
+	r := jsonrest.NewRouter()
+	ok := func(ctx context.Context, req *jsonrest.Request) (interface{}, error) {
+		return nil, nil
+	}
+	r.Get("/static/path", ok)
+	r.Get("/users/:id/posts/:post", ok)
+
+	b.Run("static", func(b *testing.B) { benchServe(b, r, "/static/path") })
+	b.Run("params", func(b *testing.B) { benchServe(b, r, "/users/1/posts/2") })
+	b.Run("not found", func(b *testing.B) { benchServe(b, r, "/missing") })
+}
+
+func BenchmarkMiddleware(b *testing.B) {
+	passthrough := func(next jsonrest.Endpoint) jsonrest.Endpoint {
+		return func(ctx context.Context, req *jsonrest.Request) (interface{}, error) {
+			return next(ctx, req)
+		}
+	}
+	for _, depth := range []int{1, 5, 20} {
+		r := jsonrest.NewRouter()
+		g := r
+		for i := 0; i < depth; i++ {
+			g = g.Group()
+			g.Use(passthrough)
+		}
+		g.Get("/", func(ctx context.Context, req *jsonrest.Request) (interface{}, error) {
+			return nil, nil
+		})
+		b.Run(strconv.Itoa(depth), func(b *testing.B) { benchServe(b, r, "/") })
+	}
+}
+
+func BenchmarkEncoding(b *testing.B) {
+	for _, tt := range []struct {
+		name string
+		opts []jsonrest.Option
+	}{
+		{"indent", nil},
+		{"no indent", []jsonrest.Option{jsonrest.WithDisableJSONIndent()}},
+	} {
+		for _, n := range []int{1, 100} {
+			items := benchItems(n)
+			r := jsonrest.NewRouter(tt.opts...)
+			r.Get("/", func(ctx context.Context, req *jsonrest.Request) (interface{}, error) {
+				return items, nil
+			})
+			b.Run(tt.name+"/"+strconv.Itoa(n), func(b *testing.B) { benchServe(b, r, "/") })
+		}
+	}
+}
+
+func BenchmarkErrors(b *testing.B) {
+	r := jsonrest.NewRouter()
+	r.Get("/http", func(ctx context.Context, req *jsonrest.Request) (interface{}, error) {
+		return nil, jsonrest.NotFound("item not found")
+	})
+	r.Get("/internal", func(ctx context.Context, req *jsonrest.Request) (interface{}, error) {
+		return nil, errors.New("database unavailable")
+	})
+
+	b.Run("http error", func(b *testing.B) { benchServe(b, r, "/http") })
+	b.Run("internal error", func(b *testing.B) { benchServe(b, r, "/internal") })
+}
+
+// allocationBudget is the maximum number of allocations made to serve a simple
+// request.
+const allocationBudget = 12
+
+// TestAllocationBudget guards the allocations of the hot path against
+// regressions.
+func TestAllocationBudget(t *testing.T) {
+	r := jsonrest.NewRouter(jsonrest.WithDisableJSONIndent())
+	g := r.Group()
+	g.Use(func(next jsonrest.Endpoint) jsonrest.Endpoint {
+		return func(ctx context.Context, req *jsonrest.Request) (interface{}, error) {
+			return next(ctx, req)
+		}
+	})
+	g.Get("/users/:id", func(ctx context.Context, req *jsonrest.Request) (interface{}, error) {
+		return nil, nil
+	})
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	w := httptest.NewRecorder()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		r.ServeHTTP(w, req)
+	})
+	t.Logf("%v allocations per request", allocs)
+	if allocs > allocationBudget {
+		t.Errorf("got %v allocations per request, want at most %v", allocs, allocationBudget)
+	}
+}
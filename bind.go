@@ -0,0 +1,377 @@
+package jsonrest
+
+import (
+	"encoding"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A bindSource is a struct tag read by Bind, along with the description of its
+// values in error messages.
+type bindSource struct {
+	tag  string
+	desc string
+}
+
+// bindSources are the struct tags read by Bind, along with the description of
+// their values in error messages.
+var bindSources = []bindSource{
+	{"path", "path parameter"},
+	{"query", "query parameter"},
+	{"header", "header"},
+}
+
+// Bind populates the struct pointed to by dst from the request: the JSON body,
+// if any, is unmarshaled first, then the fields tagged with path, query or
+// header are set from the URL parameters, the query string and the headers,
+// e.g.
+//
+//	var in struct {
+//	    ID    int64    `path:"id"`
+//	    Page  int      `query:"page"`
+//	    Tags  []string `query:"tag"`
+//	    Org   string   `header:"X-Org,required"`
+//	    Name  string   `json:"name"`
+//	}
+//
+// Fields can be strings, booleans, numbers, time.Time, time.Duration,
+// encoding.TextUnmarshaler implementations, or pointers and slices of those.
+// Values are coerced to the field types: booleans accept "yes", "no", "on"
+// and "off" besides the strconv.ParseBool values, times accept RFC 3339
+// timestamps, dates and Unix timestamps, and durations accept Go durations
+// and seconds. A slice gets all the values of a query parameter or header,
+// split on commas unless the tag has the nosplit option.
+//
+// Fields whose value is absent are left unchanged, unless the tag has the
+// required option; a field still zero after binding gets the value of its
+// default tag, if any, e.g. `query:"limit" default:"20"`. All the invalid and
+// missing values are reported at once in the details of a 400 error.
+func (r *Request) Bind(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("jsonrest: Bind requires a non-nil pointer to a struct, got %T", dst)
+	}
+	if hasBody(r.req) {
+		if err := r.BindBody(dst); err != nil {
+			return err
+		}
+	}
+
+	return r.bindSources(v.Elem(), bindSources)
+}
+
+// BindHeaders populates the fields tagged with header of the struct pointed to
+// by dst from the request headers, like Bind but ignoring the body, the URL
+// parameters and the query string.
+func (r *Request) BindHeaders(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("jsonrest: BindHeaders requires a non-nil pointer to a struct, got %T", dst)
+	}
+	return r.bindSources(v.Elem(), bindSources[2:])
+}
+
+// bindSources sets the fields of the struct v tagged with the sources, and
+// returns a 400 error listing the invalid and missing values, if any.
+func (r *Request) bindSources(v reflect.Value, sources []bindSource) error {
+	var details []string
+	r.bindFields(v, sources, &details)
+	return invalidParameters(details...)
+}
+
+// invalidParameters returns a 400 error with the details, or nil if there are
+// none.
+func invalidParameters(details ...string) error {
+	if len(details) == 0 {
+		return nil
+	}
+	err := BadRequest("invalid request parameters")
+	err.Details = details
+	return err
+}
+
+// hasBody reports whether the request may have a body.
+func hasBody(req *http.Request) bool {
+	return req.Body != nil && req.Body != http.NoBody && req.ContentLength != 0
+}
+
+// bindFields sets the fields of the struct v tagged with the sources,
+// recursing into embedded structs, and appends the errors to details. Defaults
+// apply to the fields tagged with the sources, or to all the fields if all the
+// sources are bound.
+func (r *Request) bindFields(v reflect.Value, sources []bindSource, details *[]string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue // unexported
+		}
+		fv := v.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			r.bindFields(fv, sources, details)
+			continue
+		}
+		set, tagged := false, len(sources) == len(bindSources)
+		for _, source := range sources {
+			tag, ok := field.Tag.Lookup(source.tag)
+			if !ok {
+				continue
+			}
+			tagged = true
+			name, opts := tag, ""
+			if i := strings.IndexByte(tag, ','); i >= 0 {
+				name, opts = tag[:i], tag[i+1:]
+			}
+			vals := r.sourceValues(source.tag, name)
+			if len(vals) == 0 {
+				if hasTagOption(opts, "required") {
+					*details = append(*details, fmt.Sprintf("%s %q is required", source.desc, name))
+				}
+				continue
+			}
+			set = true
+			if err := setFieldValues(fv, vals, !hasTagOption(opts, "nosplit")); err != nil {
+				*details = append(*details, fmt.Sprintf("%s %q: %v", source.desc, name, err))
+			}
+		}
+		if def, ok := field.Tag.Lookup("default"); ok && tagged && !set && isZero(fv) {
+			if err := setFieldValues(fv, []string{def}, true); err != nil {
+				*details = append(*details, fmt.Sprintf("default of field %s: %v", field.Name, err))
+			}
+		}
+	}
+}
+
+// isZero reports whether v is the zero value of its type.
+func isZero(v reflect.Value) bool {
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+// sourceValues returns the values of the named path parameter, query
+// parameter or header.
+func (r *Request) sourceValues(source, name string) []string {
+	switch source {
+	case "path":
+		for _, p := range r.params {
+			if p.Key == name {
+				return []string{p.Value}
+			}
+		}
+		return nil
+	case "query":
+		return r.req.URL.Query()[name]
+	default:
+		return r.req.Header[http.CanonicalHeaderKey(name)]
+	}
+}
+
+// hasTagOption reports whether the comma-separated tag options contain opt.
+func hasTagOption(opts, opt string) bool {
+	for _, o := range strings.Split(opts, ",") {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// textUnmarshalerType is the type of encoding.TextUnmarshaler.
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// setFieldValues sets the field v from the string values: a slice gets all of
+// them, split on commas if split is true, other types the first one.
+func setFieldValues(v reflect.Value, vals []string, split bool) error {
+	if v.Kind() == reflect.Slice && !v.Addr().Type().Implements(textUnmarshalerType) && v.Type().Elem().Kind() != reflect.Uint8 {
+		if split {
+			var splitVals []string
+			for _, val := range vals {
+				for _, s := range strings.Split(val, ",") {
+					if s = strings.TrimSpace(s); s != "" {
+						splitVals = append(splitVals, s)
+					}
+				}
+			}
+			vals = splitVals
+		}
+		s := reflect.MakeSlice(v.Type(), len(vals), len(vals))
+		for i, val := range vals {
+			if err := setFieldValue(s.Index(i), val); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+	return setFieldValue(v, vals[0])
+}
+
+// setFieldValue sets v from the string value.
+func setFieldValue(v reflect.Value, val string) error {
+	if v.Kind() == reflect.Ptr {
+		p := reflect.New(v.Type().Elem())
+		if err := setFieldValue(p.Elem(), val); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+	switch v.Type() {
+	case timeType:
+		t, err := parseTime(val)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case typeTimeDuration:
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			secs, convErr := strconv.ParseInt(val, 10, 64)
+			if convErr != nil {
+				return fmt.Errorf("invalid duration %q", val)
+			}
+			d = time.Duration(secs) * time.Second
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		if err := u.UnmarshalText([]byte(val)); err != nil {
+			return fmt.Errorf("invalid value %q", val)
+		}
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(val)
+	case reflect.Bool:
+		b, err := parseBool(val)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(val, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", val)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(val, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %q", val)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(val, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", val)
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
+
+// parseBool parses a boolean, accepting the values of strconv.ParseBool as
+// well as "yes", "no", "on" and "off", in any case.
+func parseBool(val string) (bool, error) {
+	switch strings.ToLower(val) {
+	case "1", "t", "true", "y", "yes", "on":
+		return true, nil
+	case "0", "f", "false", "n", "no", "off":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", val)
+}
+
+// parseTime parses an RFC 3339 timestamp, a date such as "2006-01-02", or a
+// Unix timestamp in seconds.
+func parseTime(val string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, val); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", val); err == nil {
+		return t, nil
+	}
+	if secs, err := strconv.ParseFloat(val, 64); err == nil && !math.IsInf(secs, 0) && !math.IsNaN(secs) {
+		sec, frac := math.Modf(secs)
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", val)
+}
+
+// HeaderInt returns the value of the header as an integer, 0 if it is absent,
+// or a 400 error if it is not an integer.
+func (r *Request) HeaderInt(name string) (int, error) {
+	var n int
+	err := r.headerValue(name, reflect.ValueOf(&n).Elem())
+	return n, err
+}
+
+// HeaderTime returns the value of the header as a time, the zero time if it
+// is absent, or a 400 error if it is not an RFC 3339 timestamp, a date or a
+// Unix timestamp. HTTP dates, as in If-Modified-Since, are accepted too.
+func (r *Request) HeaderTime(name string) (time.Time, error) {
+	val := r.req.Header.Get(name)
+	if t, err := http.ParseTime(val); err == nil {
+		return t, nil
+	}
+	var t time.Time
+	err := r.headerValue(name, reflect.ValueOf(&t).Elem())
+	return t, err
+}
+
+// HeaderUUID returns the value of the header, lowercased, if it is a UUID in
+// the canonical form, e.g. "123e4567-e89b-12d3-a456-426614174000", an empty
+// string if it is absent, or a 400 error otherwise.
+func (r *Request) HeaderUUID(name string) (string, error) {
+	val := r.req.Header.Get(name)
+	if val == "" {
+		return "", nil
+	}
+	if !isUUID(val) {
+		return "", invalidParameters(fmt.Sprintf("header %q: invalid UUID %q", name, val))
+	}
+	return strings.ToLower(val), nil
+}
+
+// headerValue sets v from the value of the header, if present.
+func (r *Request) headerValue(name string, v reflect.Value) error {
+	val := r.req.Header.Get(name)
+	if val == "" {
+		return nil
+	}
+	if err := setFieldValue(v, val); err != nil {
+		return invalidParameters(fmt.Sprintf("header %q: %v", name, err))
+	}
+	return nil
+}
+
+// isUUID reports whether s is a UUID in the canonical form.
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
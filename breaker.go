@@ -0,0 +1,214 @@
+package jsonrest
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A CircuitState is the state of a circuit breaker.
+type CircuitState int
+
+// The states of a circuit breaker.
+const (
+	// CircuitClosed lets requests through.
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen rejects requests until the open timeout elapses.
+	CircuitOpen
+
+	// CircuitHalfOpen lets a limited number of probe requests through, to
+	// decide whether to close or reopen the circuit.
+	CircuitHalfOpen
+)
+
+// String returns the name of the state.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "CircuitState(" + strconv.Itoa(int(s)) + ")"
+}
+
+// CircuitBreakerOptions configures CircuitBreakerMiddleware. The circuit opens
+// when either of the configured conditions is met.
+type CircuitBreakerOptions struct {
+	// ConsecutiveFailures, if positive, is the number of consecutive
+	// failures opening the circuit.
+	ConsecutiveFailures int
+
+	// FailureRate, if positive, is the ratio of failed requests in a window
+	// opening the circuit, once the window has at least MinRequests.
+	FailureRate float64
+	MinRequests int
+
+	// Window is the duration over which the failure rate is measured. It
+	// defaults to 10s.
+	Window time.Duration
+
+	// OpenTimeout is how long the circuit stays open before probe requests
+	// are let through. It defaults to 30s.
+	OpenTimeout time.Duration
+
+	// HalfOpenProbes is the number of successful probe requests closing the
+	// circuit. It defaults to 1.
+	HalfOpenProbes int
+
+	// IsFailure reports whether a request failed, from the status of its
+	// response and its error. It defaults to a 5xx status.
+	IsFailure func(status int, err error) bool
+
+	// OnStateChange, if set, is called when the state of the circuit
+	// changes. It must not block, as the circuit is locked meanwhile.
+	OnStateChange func(from, to CircuitState)
+}
+
+// errCircuitOpen is returned for the requests rejected by an open circuit.
+var errCircuitOpen = Error(http.StatusServiceUnavailable, "circuit_open", "service temporarily unavailable, try again later")
+
+// circuitBreaker is the state of a circuit breaker.
+type circuitBreaker struct {
+	opts CircuitBreakerOptions
+
+	mu          sync.Mutex
+	state       CircuitState
+	consecutive int       // consecutive failures
+	total       int       // requests in the window
+	failures    int       // failed requests in the window
+	windowStart time.Time // start of the window
+	openedAt    time.Time
+	probes      int // probe requests in flight
+	successes   int // successful probe requests
+}
+
+// CircuitBreakerMiddleware returns a middleware rejecting the requests with a
+// 503 error while the circuit is open, e.g. when the upstream service of a
+// group of routes is failing. All the routes the middleware is used for share
+// the same circuit. A panicking endpoint counts as a failure.
+func CircuitBreakerMiddleware(opts CircuitBreakerOptions) Middleware {
+	if opts.Window <= 0 {
+		opts.Window = 10 * time.Second
+	}
+	if opts.OpenTimeout <= 0 {
+		opts.OpenTimeout = 30 * time.Second
+	}
+	if opts.HalfOpenProbes <= 0 {
+		opts.HalfOpenProbes = 1
+	}
+	if opts.IsFailure == nil {
+		opts.IsFailure = func(status int, err error) bool { return status >= 500 }
+	}
+	cb := &circuitBreaker{opts: opts}
+
+	return func(next Endpoint) Endpoint {
+		return func(ctx context.Context, req *Request) (result interface{}, err error) {
+			probe, retryAfter := cb.allow()
+			if retryAfter > 0 {
+				req.SetResponseHeader("Retry-After", strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+				return nil, errCircuitOpen
+			}
+			failed := true
+			defer func() {
+				cb.record(probe, failed)
+			}()
+			result, err = next(ctx, req)
+			failed = opts.IsFailure(responseStatus(result, err), err)
+			return result, err
+		}
+	}
+}
+
+// allow reports whether the request is a probe of the half-open circuit, or
+// how long to wait before retrying if it is rejected.
+func (cb *circuitBreaker) allow() (probe bool, retryAfter time.Duration) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	switch cb.state {
+	case CircuitOpen:
+		wait := cb.opts.OpenTimeout - time.Since(cb.openedAt)
+		if wait > 0 {
+			return false, wait
+		}
+		cb.setState(CircuitHalfOpen)
+		cb.probes, cb.successes = 0, 0
+		fallthrough
+	case CircuitHalfOpen:
+		if cb.probes+cb.successes >= cb.opts.HalfOpenProbes {
+			return false, time.Second
+		}
+		cb.probes++
+		return true, 0
+	}
+	return false, 0
+}
+
+// record records the outcome of a request let through.
+func (cb *circuitBreaker) record(probe, failed bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if probe {
+		if cb.state != CircuitHalfOpen {
+			return
+		}
+		cb.probes--
+		if failed {
+			cb.open()
+			return
+		}
+		cb.successes++
+		if cb.successes >= cb.opts.HalfOpenProbes {
+			cb.setState(CircuitClosed)
+			cb.consecutive, cb.total, cb.failures = 0, 0, 0
+			cb.windowStart = time.Now()
+		}
+		return
+	}
+	if cb.state != CircuitClosed {
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(cb.windowStart) >= cb.opts.Window {
+		cb.windowStart, cb.total, cb.failures = now, 0, 0
+	}
+	cb.total++
+	if !failed {
+		cb.consecutive = 0
+		return
+	}
+	cb.failures++
+	cb.consecutive++
+	if n := cb.opts.ConsecutiveFailures; n > 0 && cb.consecutive >= n {
+		cb.open()
+		return
+	}
+	if rate := cb.opts.FailureRate; rate > 0 && cb.total >= cb.opts.MinRequests && float64(cb.failures)/float64(cb.total) >= rate {
+		cb.open()
+	}
+}
+
+// open opens the circuit.
+func (cb *circuitBreaker) open() {
+	cb.setState(CircuitOpen)
+	cb.openedAt = time.Now()
+	cb.consecutive = 0
+}
+
+// setState changes the state of the circuit and calls the OnStateChange hook.
+func (cb *circuitBreaker) setState(state CircuitState) {
+	if state == cb.state {
+		return
+	}
+	from := cb.state
+	cb.state = state
+	if cb.opts.OnStateChange != nil {
+		cb.opts.OnStateChange(from, state)
+	}
+}
@@ -0,0 +1,149 @@
+package jsonrest
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// An ErrorBudget configures the tracking of the 5xx error rate of each route
+// over a sliding window.
+type ErrorBudget struct {
+	// Window is the duration of the sliding window. It defaults to a
+	// minute.
+	Window time.Duration
+
+	// Threshold is the rate of 5xx errors, between 0 and 1, above which the
+	// budget of a route is exceeded.
+	Threshold float64
+
+	// MinRequests is the minimum number of requests in the window for the
+	// rate to be evaluated, so that a few errors on an idle route do not
+	// raise an alert.
+	MinRequests int
+
+	// Capture is the number of the route's failures, after the budget is
+	// exceeded, whose internal errors are displayed in the response, like
+	// with DumpErrors.
+	Capture int
+
+	// Alert, if set, is called when the error rate of a route crosses the
+	// threshold. It is called again only after the rate has fallen back
+	// below the threshold.
+	Alert func(ErrorBudgetAlert)
+}
+
+// An ErrorBudgetAlert reports a route exceeding its error budget.
+type ErrorBudgetAlert struct {
+	Method   string
+	Path     string
+	Requests int
+	Failures int
+	Rate     float64
+}
+
+// WithErrorBudget is an Option available for NewRouter to track the 5xx error
+// rate of the routes, from the errors returned by their endpoints and their
+// panics. It has no effect on groups.
+func WithErrorBudget(budget ErrorBudget) Option {
+	return func(r *Router) {
+		if r.parent != nil {
+			return
+		}
+		if budget.Window <= 0 {
+			budget.Window = time.Minute
+		}
+		r.errorBudget = &budget
+	}
+}
+
+// budgetBuckets is the number of buckets of the sliding window.
+const budgetBuckets = 10
+
+// budgetBucket counts the requests of a slot of the sliding window.
+type budgetBucket struct {
+	slot     int64
+	requests int
+	failures int
+}
+
+// routeBudget tracks the error rate of a route.
+type routeBudget struct {
+	*ErrorBudget
+	method, path string
+
+	mu       sync.Mutex
+	buckets  [budgetBuckets]budgetBucket
+	alerting bool
+	capture  int
+}
+
+// newRouteBudget returns the error budget tracker of the route.
+func newRouteBudget(b *ErrorBudget, route *Route) *routeBudget {
+	return &routeBudget{ErrorBudget: b, method: route.Method, path: route.Path}
+}
+
+// record records the status of a response, and calls the alert hook if the
+// error rate crosses the threshold.
+func (b *routeBudget) record(status int) {
+	if b == nil {
+		return
+	}
+	width := int64(b.Window / budgetBuckets)
+	if width <= 0 {
+		width = 1
+	}
+	slot := time.Now().UnixNano() / width
+
+	b.mu.Lock()
+	bucket := &b.buckets[slot%budgetBuckets]
+	if bucket.slot != slot {
+		*bucket = budgetBucket{slot: slot}
+	}
+	bucket.requests++
+	if status >= 500 {
+		bucket.failures++
+	}
+
+	alert := ErrorBudgetAlert{Method: b.method, Path: b.path}
+	for _, bucket := range b.buckets {
+		if bucket.slot > slot-budgetBuckets {
+			alert.Requests += bucket.requests
+			alert.Failures += bucket.failures
+		}
+	}
+	alert.Rate = float64(alert.Failures) / float64(alert.Requests)
+	exceeded := alert.Requests >= b.MinRequests && alert.Rate > b.Threshold
+	crossed := exceeded && !b.alerting
+	b.alerting = exceeded
+	if crossed {
+		b.capture = b.Capture
+	}
+	b.mu.Unlock()
+
+	if crossed && b.Alert != nil {
+		b.Alert(alert)
+	}
+}
+
+// takeCapture reports whether the internal error of a failed request should be
+// displayed in the response.
+func (b *routeBudget) takeCapture() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.capture > 0 {
+		b.capture--
+		return true
+	}
+	return false
+}
+
+// captureError reports whether the internal error sent for the request should
+// be displayed because its route exceeded its error budget.
+func captureError(req *http.Request) bool {
+	request := RequestFromContext(req.Context())
+	return request != nil && request.captureError
+}
@@ -0,0 +1,200 @@
+package jsonrest
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// CacheOptions configures CacheMiddleware.
+type CacheOptions struct {
+	// TTL is how long a cached result is fresh.
+	TTL time.Duration
+
+	// StaleWhileRevalidate is how long a result is served after it expires,
+	// while it is refreshed in the background, so that clients do not wait
+	// for popular entries to be recomputed.
+	StaleWhileRevalidate time.Duration
+
+	// MaxEntries, if positive, is the maximum number of cached results.
+	MaxEntries int
+
+	// Key returns the cache key of the request, or "" if the request must
+	// not be cached. It defaults to the method, the URL and the principal
+	// of the request; requests with an Authorization or Cookie header but
+	// no principal are not cached, since their results may be specific to
+	// the user.
+	Key func(*Request) string
+}
+
+// cacheEntry is a cached endpoint result.
+type cacheEntry struct {
+	result     interface{}
+	fresh      time.Time // fresh until
+	stale      time.Time // servable while refreshing until
+	refreshing bool
+}
+
+// CacheMiddleware returns a middleware caching in memory the successful
+// results of the GET and HEAD requests. Results served directly by a
+// HandlerResponse are not cached. The response headers set by the endpoint are
+// not cached, and the endpoint is called with a detached request when
+// refreshing a stale result.
+func CacheMiddleware(opts CacheOptions) Middleware {
+	if opts.Key == nil {
+		opts.Key = defaultCacheKey
+	}
+	var mu sync.Mutex
+	entries := make(map[string]*cacheEntry)
+
+	store := func(key string, result interface{}) {
+		now := time.Now()
+		mu.Lock()
+		defer mu.Unlock()
+		if _, ok := entries[key]; !ok && opts.MaxEntries > 0 && len(entries) >= opts.MaxEntries {
+			evictCacheEntry(entries, now)
+		}
+		entries[key] = &cacheEntry{
+			result: result,
+			fresh:  now.Add(opts.TTL),
+			stale:  now.Add(opts.TTL + opts.StaleWhileRevalidate),
+		}
+	}
+
+	return func(next Endpoint) Endpoint {
+		refresh := func(key string, req *Request) {
+			stored := false
+			defer func() {
+				if p := recover(); p != nil {
+					log.Printf("panic refreshing cached result of %v: %+v\n%s", key, p, debug.Stack())
+				}
+				if stored {
+					return
+				}
+				mu.Lock()
+				if e, ok := entries[key]; ok {
+					e.refreshing = false
+				}
+				mu.Unlock()
+			}()
+			result, err := next(req.req.Context(), req)
+			if err == nil && cacheable(result) {
+				store(key, result)
+				stored = true
+			}
+		}
+
+		return func(ctx context.Context, req *Request) (interface{}, error) {
+			if req.Method() != http.MethodGet && req.Method() != http.MethodHead {
+				return next(ctx, req)
+			}
+			key := opts.Key(req)
+			if key == "" {
+				return next(ctx, req)
+			}
+			now := time.Now()
+
+			mu.Lock()
+			e, ok := entries[key]
+			if ok && now.Before(e.fresh) {
+				mu.Unlock()
+				return e.result, nil
+			}
+			if ok && now.Before(e.stale) {
+				if !e.refreshing {
+					e.refreshing = true
+					go refresh(key, req.detached())
+				}
+				mu.Unlock()
+				return e.result, nil
+			}
+			mu.Unlock()
+
+			result, err := next(ctx, req)
+			if err == nil && cacheable(result) {
+				store(key, result)
+			}
+			return result, err
+		}
+	}
+}
+
+// defaultCacheKey returns the method, URL and principal of the request, or ""
+// for credentialed requests without a principal.
+func defaultCacheKey(req *Request) string {
+	principal := req.Principal()
+	if principal == "" && (req.Header("Authorization") != "" || req.Header("Cookie") != "") {
+		return ""
+	}
+	return req.Method() + " " + req.URL().String() + " " + principal
+}
+
+// cacheable reports whether the endpoint result can be cached.
+func cacheable(result interface{}) bool {
+	_, isHandler := result.(HandlerResponse)
+	return !isHandler
+}
+
+// evictCacheEntry removes the expired cache entries, or an arbitrary one if
+// none is expired.
+func evictCacheEntry(entries map[string]*cacheEntry, now time.Time) {
+	evicted := false
+	for key, e := range entries {
+		if !now.Before(e.stale) {
+			delete(entries, key)
+			evicted = true
+		}
+	}
+	if evicted {
+		return
+	}
+	for key := range entries {
+		delete(entries, key)
+		return
+	}
+}
+
+// detached returns a copy of the request which can be used after the request
+// completes: its context keeps the values of the request's context but is
+// never canceled, and response headers are discarded.
+func (r *Request) detached() *Request {
+	d := &Request{
+		params:         r.params,
+		responseWriter: discardResponseWriter{header: make(http.Header)},
+		route:          r.route,
+		routeInfo:      r.routeInfo,
+		pageLimits:     r.pageLimits,
+		router:         r.router,
+		scopesChecked:  r.scopesChecked,
+	}
+	r.metaMu.RLock()
+	for key, val := range r.meta {
+		d.Set(key, val)
+	}
+	r.metaMu.RUnlock()
+	d.req = r.req.WithContext(context.WithValue(detachedContext{r.req.Context()}, requestKey{}, d))
+	return d
+}
+
+// detachedContext is a context keeping the values of its parent, without its
+// deadline and cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+// discardResponseWriter is an http.ResponseWriter discarding the response.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w discardResponseWriter) Header() http.Header         { return w.header }
+func (w discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w discardResponseWriter) WriteHeader(int)             {}
@@ -0,0 +1,93 @@
+package jsonrest
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A CachePolicy describes the Cache-Control directives of the responses of a
+// route. See CacheControl and WithCacheControl.
+type CachePolicy struct {
+	// MaxAge is how long the response is fresh. The Expires header is set
+	// accordingly.
+	MaxAge time.Duration
+
+	// Public allows shared caches to store the response. Otherwise the
+	// response is private.
+	Public bool
+
+	// Immutable indicates that the response does not change while fresh.
+	Immutable bool
+
+	// StaleWhileRevalidate is how long a stale response can be served while
+	// it is revalidated in the background.
+	StaleWhileRevalidate time.Duration
+
+	// NoCache requires caches to revalidate the response before using it.
+	NoCache bool
+
+	// NoStore forbids caches to store the response. The other directives
+	// are ignored.
+	NoStore bool
+}
+
+// Cache is a RouteOption setting the Cache-Control header of the successful
+// responses of the GET and HEAD requests, e.g. "public, max-age=60".
+func Cache(maxAge time.Duration, public bool) RouteOption {
+	return CacheControl(CachePolicy{MaxAge: maxAge, Public: public})
+}
+
+// CacheControl is a RouteOption setting the Cache-Control and Expires headers
+// of the successful responses of the GET and HEAD requests from the policy.
+// Endpoints setting the Cache-Control header themselves take precedence.
+func CacheControl(policy CachePolicy) RouteOption {
+	return func(r *Route) {
+		r.cachePolicy = &policy
+	}
+}
+
+// WithCacheControl is an Option available for NewRouter and Group to set the
+// default cache policy of the routes. See CacheControl.
+func WithCacheControl(policy CachePolicy) Option {
+	return func(r *Router) {
+		r.cachePolicy = &policy
+	}
+}
+
+// String returns the value of the Cache-Control header.
+func (p CachePolicy) String() string {
+	if p.NoStore {
+		return "no-store"
+	}
+	directives := []string{"private"}
+	if p.Public {
+		directives[0] = "public"
+	}
+	if p.NoCache {
+		directives = append(directives, "no-cache")
+	}
+	directives = append(directives, "max-age="+strconv.Itoa(int(p.MaxAge/time.Second)))
+	if p.StaleWhileRevalidate > 0 {
+		directives = append(directives, "stale-while-revalidate="+strconv.Itoa(int(p.StaleWhileRevalidate/time.Second)))
+	}
+	if p.Immutable {
+		directives = append(directives, "immutable")
+	}
+	return strings.Join(directives, ", ")
+}
+
+// apply sets the Cache-Control and Expires headers of the response to the
+// request from the policy, unless Cache-Control is already set.
+func (p *CachePolicy) apply(req *http.Request, h http.Header) {
+	if p == nil || (req.Method != http.MethodGet && req.Method != http.MethodHead) || h.Get("Cache-Control") != "" {
+		return
+	}
+	h.Set("Cache-Control", p.String())
+	if p.NoStore || p.NoCache {
+		h.Set("Expires", "0")
+		return
+	}
+	h.Set("Expires", time.Now().Add(p.MaxAge).UTC().Format(http.TimeFormat))
+}
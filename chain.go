@@ -0,0 +1,66 @@
+package jsonrest
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// MiddlewareChain returns the names of the middleware applied to the route
+// registered for the method and path, from the outermost to the innermost, or
+// nil if there is no such route. Middleware registered with Use is named after
+// its function, e.g. "github.com/org/app/auth.Middleware.func1".
+func (r *Router) MiddlewareChain(method, path string) []string {
+	root := r.root()
+	root.routesMu.RLock()
+	defer root.routesMu.RUnlock()
+	for _, route := range root.routes {
+		if route.Method == method && route.Path == path {
+			return middlewareChain(route.router)
+		}
+	}
+	return nil
+}
+
+// middlewareChain returns the names of the middleware applied to the routes
+// of r, from the outermost to the innermost.
+func middlewareChain(r *Router) []string {
+	var routers []*Router
+	for ; r != nil; r = r.parent {
+		routers = append(routers, r)
+	}
+	chain := []string{}
+	if c := routers[len(routers)-1].composite; c != nil {
+		chain = append(chain, c.middlewareNames...)
+	}
+	for i := len(routers) - 1; i >= 0; i-- {
+		chain = append(chain, routers[i].middlewareNames...)
+	}
+	return chain
+}
+
+// MiddlewareChainsEndpoint returns an endpoint listing the middleware chain of
+// each route registered with the router, keyed by method and path, e.g. to be
+// served on an internal debugging route.
+func (r *Router) MiddlewareChainsEndpoint() Endpoint {
+	return func(ctx context.Context, req *Request) (interface{}, error) {
+		root := r.root()
+		root.routesMu.RLock()
+		defer root.routesMu.RUnlock()
+		chains := make(map[string][]string)
+		for _, route := range root.routes {
+			chains[route.Method+" "+route.Path] = middlewareChain(route.router)
+		}
+		return chains, nil
+	}
+}
+
+// funcName returns the name of the function f.
+func funcName(f interface{}) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer())
+	if fn == nil {
+		return "unknown"
+	}
+	return strings.TrimSuffix(fn.Name(), "-fm")
+}
@@ -0,0 +1,289 @@
+// Package client implements a client for APIs served by jsonrest routers.
+//
+// Requests and responses are encoded as JSON, error responses are decoded
+// back into *jsonrest.HTTPError values, requests rejected with a 429 or 503
+// status are retried with backoff, and the request ID and trace headers of
+// the incoming request being served are propagated to the outgoing requests.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	jsonrest "github.com/mbranch/jsonrest-go"
+)
+
+// DefaultPropagatedHeaders are the headers of the incoming request which are
+// propagated to the outgoing requests by default: the W3C Trace Context and
+// B3 trace headers.
+var DefaultPropagatedHeaders = []string{"Traceparent", "Tracestate", "B3", "X-B3-Traceid", "X-B3-Spanid", "X-B3-Sampled"}
+
+// A Client calls a jsonrest-style API. It is safe for concurrent use.
+type Client struct {
+	baseURL         *url.URL
+	httpClient      *http.Client
+	header          http.Header
+	maxRetries      int
+	minBackoff      time.Duration
+	maxBackoff      time.Duration
+	requestIDHeader string
+	propagated      []string
+}
+
+// An Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient is an Option setting the HTTP client sending the requests.
+// It defaults to http.DefaultClient.
+func WithHTTPClient(c *http.Client) Option {
+	return func(cl *Client) {
+		cl.httpClient = c
+	}
+}
+
+// WithHeader is an Option setting a header sent with all the requests, e.g.
+// an authorization header.
+func WithHeader(key, value string) Option {
+	return func(c *Client) {
+		c.header.Set(key, value)
+	}
+}
+
+// WithRetries is an Option setting the maximum number of retries of the
+// requests rejected with a 429 or 503 status, and the bounds of the
+// exponential backoff between the attempts. The Retry-After header of the
+// response takes precedence over the backoff, up to max. It defaults to 3
+// retries with a backoff between 100ms and 10s.
+func WithRetries(n int, min, max time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries, c.minBackoff, c.maxBackoff = n, min, max
+	}
+}
+
+// WithRequestIDHeader is an Option setting the header carrying the request ID
+// of the incoming request, see jsonrest.RequestIDFromContext. It defaults to
+// jsonrest.HeaderRequestID.
+func WithRequestIDHeader(name string) Option {
+	return func(c *Client) {
+		c.requestIDHeader = name
+	}
+}
+
+// WithPropagatedHeaders is an Option setting the headers of the incoming
+// request propagated to the outgoing requests. It defaults to
+// DefaultPropagatedHeaders.
+func WithPropagatedHeaders(names ...string) Option {
+	return func(c *Client) {
+		c.propagated = names
+	}
+}
+
+// New returns a client of the API at the base URL, e.g.
+// "http://billing.internal/api".
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("client: invalid base URL: %v", err)
+	}
+	c := &Client{
+		baseURL:         u,
+		httpClient:      http.DefaultClient,
+		header:          make(http.Header),
+		maxRetries:      3,
+		minBackoff:      100 * time.Millisecond,
+		maxBackoff:      10 * time.Second,
+		requestIDHeader: jsonrest.HeaderRequestID,
+		propagated:      DefaultPropagatedHeaders,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Get calls the API with a GET request and decodes the response into out.
+func (c *Client) Get(ctx context.Context, path string, out interface{}) error {
+	return c.Do(ctx, http.MethodGet, path, nil, out)
+}
+
+// Post calls the API with a POST request with the JSON encoding of in, and
+// decodes the response into out.
+func (c *Client) Post(ctx context.Context, path string, in, out interface{}) error {
+	return c.Do(ctx, http.MethodPost, path, in, out)
+}
+
+// Put calls the API with a PUT request with the JSON encoding of in, and
+// decodes the response into out.
+func (c *Client) Put(ctx context.Context, path string, in, out interface{}) error {
+	return c.Do(ctx, http.MethodPut, path, in, out)
+}
+
+// Patch calls the API with a PATCH request with the JSON encoding of in, and
+// decodes the response into out.
+func (c *Client) Patch(ctx context.Context, path string, in, out interface{}) error {
+	return c.Do(ctx, http.MethodPatch, path, in, out)
+}
+
+// Delete calls the API with a DELETE request and decodes the response into
+// out.
+func (c *Client) Delete(ctx context.Context, path string, out interface{}) error {
+	return c.Do(ctx, http.MethodDelete, path, nil, out)
+}
+
+// Do calls the API with a request with the method to the path, relative to
+// the base URL, and the JSON encoding of in as body if in is not nil. The
+// JSON response is decoded into out if out is not nil. Error responses are
+// returned as *jsonrest.HTTPError values, so that an endpoint returning them
+// forwards them as-is to its own client.
+func (c *Client) Do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return fmt.Errorf("client: encoding request: %v", err)
+		}
+	}
+	u, err := c.baseURL.Parse(strings.TrimSuffix(c.baseURL.Path, "/") + "/" + strings.TrimPrefix(path, "/"))
+	if err != nil {
+		return fmt.Errorf("client: invalid path %q: %v", path, err)
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, method, u.String(), body)
+		if err != nil {
+			return err
+		}
+		if (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) && attempt < c.maxRetries {
+			wait := c.backoff(attempt, resp.Header.Get("Retry-After"))
+			drain(resp.Body)
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+			continue
+		}
+		defer resp.Body.Close()
+		return decodeResponse(resp, out)
+	}
+}
+
+// send sends one attempt of a request.
+func (c *Client) send(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, url, r)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for key, vals := range c.header {
+		req.Header[key] = vals
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if id := jsonrest.RequestIDFromContext(ctx); id != "" && c.requestIDHeader != "" {
+		req.Header.Set(c.requestIDHeader, id)
+	}
+	if incoming := jsonrest.RequestFromContext(ctx); incoming != nil {
+		for _, name := range c.propagated {
+			if val := incoming.Header(name); val != "" {
+				req.Header.Set(name, val)
+			}
+		}
+	}
+	return c.httpClient.Do(req)
+}
+
+// backoff returns how long to wait before retrying the attempt, from the
+// Retry-After header value if valid, or else exponentially with jitter.
+func (c *Client) backoff(attempt int, retryAfter string) time.Duration {
+	if secs, err := strconv.Atoi(retryAfter); err == nil && secs >= 0 {
+		return minDuration(time.Duration(secs)*time.Second, c.maxBackoff)
+	}
+	if t, err := http.ParseTime(retryAfter); err == nil {
+		return minDuration(time.Until(t), c.maxBackoff)
+	}
+	d := c.minBackoff << uint(attempt)
+	if d <= 0 || d > c.maxBackoff {
+		d = c.maxBackoff
+	}
+	// Full jitter, so that rejected clients do not retry in lockstep.
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// decodeResponse decodes the response into out, or into the returned
+// *jsonrest.HTTPError for error responses.
+func decodeResponse(resp *http.Response, out interface{}) error {
+	if resp.StatusCode >= 400 {
+		return decodeError(resp)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		drain(resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil && err != io.EOF {
+		return fmt.Errorf("client: decoding response: %v", err)
+	}
+	return nil
+}
+
+// decodeError returns the *jsonrest.HTTPError of the error response, decoding
+// the {"error": {"code", "message", "details"}} envelope or an RFC 7807
+// problem.
+func decodeError(resp *http.Response) error {
+	var envelope struct {
+		Error *struct {
+			Code    string   `json:"code"`
+			Message string   `json:"message"`
+			Details []string `json:"details"`
+		} `json:"error"`
+
+		// RFC 7807 problem details, see jsonrest.ProblemJSONEncoder.
+		Code    string   `json:"code"`
+		Detail  string   `json:"detail"`
+		Details []string `json:"details"`
+	}
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	err := jsonrest.Error(resp.StatusCode, "unknown_error", http.StatusText(resp.StatusCode))
+	if json.Unmarshal(b, &envelope) != nil {
+		return err
+	}
+	switch {
+	case envelope.Error != nil:
+		err.Code, err.Message, err.Details = envelope.Error.Code, envelope.Error.Message, envelope.Error.Details
+	case envelope.Code != "":
+		err.Code, err.Message, err.Details = envelope.Code, envelope.Detail, envelope.Details
+	}
+	return err
+}
+
+// drain reads the rest of the body, so that the connection can be reused,
+// and closes it.
+func drain(body io.ReadCloser) {
+	_, _ = io.CopyN(ioutil.Discard, body, 64<<10)
+	body.Close()
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,117 @@
+package client_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mbranch/assert-go"
+	jsonrest "github.com/mbranch/jsonrest-go"
+	"github.com/mbranch/jsonrest-go/client"
+)
+
+func TestClient(t *testing.T) {
+	r := jsonrest.NewRouter()
+	r.Post("/users", func(ctx context.Context, req *jsonrest.Request) (interface{}, error) {
+		var in struct{ Name string }
+		if err := req.BindBody(&in); err != nil {
+			return nil, err
+		}
+		return jsonrest.M{"id": 1, "name": in.Name}, nil
+	})
+	r.Get("/users/:id", func(ctx context.Context, req *jsonrest.Request) (interface{}, error) {
+		return nil, jsonrest.NotFound("user not found")
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	c, err := client.New(srv.URL)
+	assert.Must(t, err)
+
+	t.Run("success", func(t *testing.T) {
+		var out struct {
+			ID   int
+			Name string
+		}
+		assert.Must(t, c.Post(context.Background(), "/users", jsonrest.M{"name": "ada"}, &out))
+		assert.Equal(t, out.ID, 1)
+		assert.Equal(t, out.Name, "ada")
+	})
+
+	t.Run("error", func(t *testing.T) {
+		err := c.Get(context.Background(), "/users/2", nil)
+		httpErr, ok := err.(*jsonrest.HTTPError)
+		assert.True(t, ok)
+		assert.Equal(t, httpErr.Status, 404)
+		assert.Equal(t, httpErr.Code, "not_found")
+		assert.Equal(t, httpErr.Message, "user not found")
+	})
+
+	t.Run("non json error", func(t *testing.T) {
+		err := c.Get(context.Background(), "/missing/a/b", nil)
+		httpErr, ok := err.(*jsonrest.HTTPError)
+		assert.True(t, ok)
+		assert.Equal(t, httpErr.Status, 404)
+	})
+}
+
+func TestClientRetries(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"ok": true}`))
+	}))
+	defer srv.Close()
+
+	t.Run("retried", func(t *testing.T) {
+		c, err := client.New(srv.URL, client.WithRetries(3, time.Millisecond, 10*time.Millisecond))
+		assert.Must(t, err)
+		var out struct{ OK bool }
+		assert.Must(t, c.Get(context.Background(), "/", &out))
+		assert.True(t, out.OK)
+		assert.Equal(t, atomic.LoadInt32(&calls), int32(3))
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		c, err := client.New(srv.URL, client.WithRetries(1, time.Millisecond, 10*time.Millisecond))
+		assert.Must(t, err)
+		err = c.Get(context.Background(), "/", nil)
+		httpErr, ok := err.(*jsonrest.HTTPError)
+		assert.True(t, ok)
+		assert.Equal(t, httpErr.Status, http.StatusServiceUnavailable)
+		assert.Equal(t, atomic.LoadInt32(&calls), int32(2))
+	})
+}
+
+func TestClientPropagation(t *testing.T) {
+	var got http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer upstream.Close()
+	c, err := client.New(upstream.URL + "/api")
+	assert.Must(t, err)
+
+	r := jsonrest.NewRouter()
+	r.Use(jsonrest.RequestIDMiddleware(""))
+	r.Get("/", func(ctx context.Context, req *jsonrest.Request) (interface{}, error) {
+		return nil, c.Get(ctx, "ping", nil)
+	})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-Id", "req-1")
+	req.Header.Set("Traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, w.Code, 200)
+	assert.Equal(t, got.Get("X-Request-Id"), "req-1")
+	assert.Equal(t, got.Get("Traceparent"), "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+}
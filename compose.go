@@ -0,0 +1,100 @@
+package jsonrest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// A Composite is an http.Handler dispatching requests to several routers, e.g.
+// to embed independently-owned routers in a monolith. See Compose.
+type Composite struct {
+	entries         []compositeEntry
+	middleware      []Middleware
+	middlewareNames []string
+}
+
+// compositeEntry is a router of a composite, along with the host and path
+// prefix of its requests.
+type compositeEntry struct {
+	host   string
+	prefix string
+	router *Router
+}
+
+// Compose returns a handler dispatching the requests to the routers, keyed by
+// path prefix (e.g. "/billing"), host (e.g. "api.example.com") or both (e.g.
+// "api.example.com/billing"). The most specific match wins: a key with a host
+// over a key without, then the longest prefix. Like Mount, the prefix is
+// removed from the URL path seen by the router and available through
+// MountPrefix. Requests matching no router are answered with a 404 error.
+func Compose(routers map[string]*Router) *Composite {
+	c := &Composite{}
+	for key, router := range routers {
+		host, prefix := key, ""
+		if i := strings.IndexByte(key, '/'); i >= 0 {
+			host, prefix = key[:i], key[i:]
+		}
+		c.entries = append(c.entries, compositeEntry{
+			host:   strings.ToLower(host),
+			prefix: strings.TrimSuffix(prefix, "/"),
+			router: router,
+		})
+		router.root().composite = c
+	}
+	sort.Slice(c.entries, func(i, j int) bool {
+		a, b := c.entries[i], c.entries[j]
+		if (a.host != "") != (b.host != "") {
+			return a.host != ""
+		}
+		return len(a.prefix) > len(b.prefix)
+	})
+	return c
+}
+
+// Use registers a middleware to be used for all the routes of the composed
+// routers, before their own middleware.
+func (c *Composite) Use(ms ...Middleware) {
+	c.middleware = append(c.middleware, ms...)
+	for _, m := range ms {
+		c.middlewareNames = append(c.middlewareNames, funcName(m))
+	}
+	for _, entry := range c.entries {
+		atomic.AddUint32(&entry.router.root().middlewareVersion, 1)
+	}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (c *Composite) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	for _, e := range c.entries {
+		if e.host != "" && e.host != host {
+			continue
+		}
+		if e.prefix != "" && req.URL.Path != e.prefix && !strings.HasPrefix(req.URL.Path, e.prefix+"/") {
+			continue
+		}
+		if e.prefix != "" {
+			ctx := context.WithValue(req.Context(), mountPrefixKey{}, MountPrefix(req)+e.prefix)
+			req = req.WithContext(ctx)
+			u := *req.URL
+			u.Path = strings.TrimPrefix(u.Path, e.prefix)
+			if u.Path == "" {
+				u.Path = "/"
+			}
+			u.RawPath = strings.TrimPrefix(u.RawPath, e.prefix)
+			req.URL = &u
+		}
+		e.router.ServeHTTP(w, req)
+		return
+	}
+	(&Router{}).sendError(w, req, Error(http.StatusNotFound, "not_found", "url not found"))
+}
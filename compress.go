@@ -0,0 +1,423 @@
+package jsonrest
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultCompressionMinSize is the default minimum size of the compressed
+// responses, below which compression is not worth its cost.
+const DefaultCompressionMinSize = 1400
+
+// A Compressor compresses responses with a content coding.
+type Compressor struct {
+	// Encoding is the content coding, e.g. "gzip", "br" or "zstd".
+	Encoding string
+
+	// NewWriter returns a writer compressing to w. If the writer has a
+	// Flush() error method, it is called when the response is flushed.
+	NewWriter func(w io.Writer) io.WriteCloser
+}
+
+// GzipCompressor returns a gzip Compressor with the compression level, which
+// can be gzip.DefaultCompression, gzip.NoCompression, gzip.HuffmanOnly or any
+// integer value between gzip.BestSpeed and gzip.BestCompression inclusive. It
+// panics if the level is invalid.
+func GzipCompressor(level int) Compressor {
+	if _, err := gzip.NewWriterLevel(nil, level); err != nil {
+		panic(err)
+	}
+	pool := &sync.Pool{New: func() interface{} {
+		w, _ := gzip.NewWriterLevel(nil, level)
+		return w
+	}}
+	return Compressor{
+		Encoding: GzipEncoding,
+		NewWriter: func(w io.Writer) io.WriteCloser {
+			gw := pool.Get().(*gzip.Writer)
+			gw.Reset(w)
+			return &pooledWriter{gw, func() { pool.Put(gw) }}
+		},
+	}
+}
+
+// DeflateCompressor returns a deflate Compressor with the compression level,
+// which can be flate.DefaultCompression, flate.NoCompression,
+// flate.HuffmanOnly or any integer value between flate.BestSpeed and
+// flate.BestCompression inclusive. It panics if the level is invalid.
+func DeflateCompressor(level int) Compressor {
+	if _, err := flate.NewWriter(nil, level); err != nil {
+		panic(err)
+	}
+	pool := &sync.Pool{New: func() interface{} {
+		w, _ := flate.NewWriter(nil, level)
+		return w
+	}}
+	return Compressor{
+		Encoding: "deflate",
+		NewWriter: func(w io.Writer) io.WriteCloser {
+			fw := pool.Get().(*flate.Writer)
+			fw.Reset(w)
+			return &pooledWriter{fw, func() { pool.Put(fw) }}
+		},
+	}
+}
+
+// pooledWriter is a compressing writer returned to its pool when closed.
+type pooledWriter struct {
+	w interface {
+		io.WriteCloser
+		Flush() error
+	}
+	release func()
+}
+
+func (w *pooledWriter) Write(b []byte) (int, error) { return w.w.Write(b) }
+func (w *pooledWriter) Flush() error                { return w.w.Flush() }
+
+func (w *pooledWriter) Close() error {
+	err := w.w.Close()
+	w.release()
+	return err
+}
+
+// CompressionOptions configures the compression of responses.
+type CompressionOptions struct {
+	// Compressors are the available content codings, in order of
+	// preference when the client accepts several of them equally. Brotli
+	// or zstd compressors can be added with third-party libraries:
+	//
+	//	jsonrest.Compressor{
+	//	    Encoding: "br",
+	//	    NewWriter: func(w io.Writer) io.WriteCloser {
+	//	        return brotli.NewWriterLevel(w, 5)
+	//	    },
+	//	}
+	//
+	// It defaults to gzip with the default compression level.
+	Compressors []Compressor
+
+	// MinSize is the minimum size of the compressed responses. It defaults
+	// to DefaultCompressionMinSize; a negative value compresses all
+	// responses. It can be overridden per route with CompressionMinSize.
+	MinSize int
+
+	// ExcludedContentTypes lists the media types of the responses which are
+	// not compressed, e.g. because they are already compressed. A type
+	// ending with a slash, e.g. "video/", excludes all its subtypes. It
+	// defaults to DefaultExcludedContentTypes.
+	ExcludedContentTypes []string
+}
+
+// DefaultExcludedContentTypes are the media types of already compressed
+// content, which are not compressed by default.
+var DefaultExcludedContentTypes = []string{
+	"image/gif",
+	"image/jpeg",
+	"image/png",
+	"image/webp",
+	"audio/",
+	"video/",
+	"font/woff",
+	"font/woff2",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zip",
+	"application/zstd",
+}
+
+// NoCompression is a RouteOption that disables the compression of the route's
+// responses, e.g. for server-sent events or file downloads.
+func NoCompression() RouteOption {
+	return func(r *Route) {
+		r.noCompression = true
+	}
+}
+
+// CompressionMinSize is a RouteOption that overrides the minimum size of the
+// route's compressed responses. A negative size compresses all responses.
+func CompressionMinSize(n int) RouteOption {
+	return func(r *Route) {
+		r.compressionMinSize = n
+	}
+}
+
+// DisableCompression disables the compression of the response. It has no
+// effect once the response is written.
+func (r *Request) DisableCompression() {
+	if cw, ok := r.responseWriter.(*compressWriter); ok {
+		cw.disabled = true
+	}
+}
+
+// configureCompression applies the compression options of the route to the
+// response writer.
+func configureCompression(w http.ResponseWriter, route *Route) {
+	cw, ok := w.(*compressWriter)
+	if !ok {
+		return
+	}
+	if route.noCompression {
+		cw.disabled = true
+	}
+	if route.compressionMinSize != 0 {
+		cw.minSize = route.compressionMinSize
+	}
+}
+
+// WithCompression is an Option available for NewRouter to compress the
+// responses with the content coding best matching the Accept-Encoding header
+// of the request. Responses are sent uncompressed if the client accepts none
+// of the codings, if they are smaller than the minimum size, or if they
+// already have a Content-Encoding.
+func WithCompression(opts CompressionOptions) Option {
+	if len(opts.Compressors) == 0 {
+		opts.Compressors = []Compressor{GzipCompressor(gzip.DefaultCompression)}
+	}
+	if opts.MinSize == 0 {
+		opts.MinSize = DefaultCompressionMinSize
+	}
+	if opts.ExcludedContentTypes == nil {
+		opts.ExcludedContentTypes = DefaultExcludedContentTypes
+	}
+	return func(r *Router) {
+		r.enableCompression = true
+		r.compression = opts
+	}
+}
+
+// compress wraps the handler to compress its responses.
+func (r *Router) compress(h http.Handler) http.Handler {
+	opts := r.compression
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Add("Vary", HeaderAcceptEncoding)
+		c := negotiateEncoding(req.Header.Get(HeaderAcceptEncoding), opts.Compressors)
+		if c == nil || req.Method == http.MethodHead {
+			h.ServeHTTP(w, req)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, compressor: c, minSize: opts.MinSize, excluded: opts.ExcludedContentTypes}
+		defer cw.Close()
+		h.ServeHTTP(cw, req)
+	})
+}
+
+// negotiateEncoding returns the compressor best matching the Accept-Encoding
+// header value, or nil if the response should not be compressed.
+func negotiateEncoding(header string, compressors []Compressor) *Compressor {
+	if header == "" {
+		return nil
+	}
+	qs := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		qs[coding] = q
+	}
+
+	var best *Compressor
+	bestQ := 0.0
+	for i, c := range compressors {
+		q, ok := qs[c.Encoding]
+		if !ok {
+			q = qs["*"]
+		}
+		if q > bestQ {
+			best, bestQ = &compressors[i], q
+		}
+	}
+	return best
+}
+
+// compressWriter compresses the response once it is known to be large enough,
+// buffering its beginning until then.
+type compressWriter struct {
+	http.ResponseWriter
+	compressor *Compressor
+	minSize    int
+	excluded   []string
+	disabled   bool
+
+	buf     []byte
+	status  int
+	started bool
+	cw      io.WriteCloser // nil if the response is not compressed
+}
+
+// WriteHeader implements the http.ResponseWriter interface. Informational
+// responses are written immediately.
+func (w *compressWriter) WriteHeader(status int) {
+	if status >= 100 && status < 200 {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if w.started {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// Write implements the http.ResponseWriter interface.
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.started {
+		if w.cw != nil {
+			return w.cw.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" || !bodyAllowed(w.status) {
+		return len(b), w.start(false)
+	}
+	if cl, err := strconv.Atoi(h.Get("Content-Length")); err == nil && cl < w.minSize {
+		return len(b), w.start(false)
+	}
+	if len(w.buf) >= w.minSize {
+		return len(b), w.start(true)
+	}
+	return len(b), nil
+}
+
+// start writes the response header and the buffered body, compressed or not.
+func (w *compressWriter) start(compress bool) error {
+	w.started = true
+	h := w.Header()
+	if compress && !w.disabled {
+		if h.Get("Content-Type") == "" {
+			h.Set("Content-Type", http.DetectContentType(w.buf))
+		}
+		compress = !excludedContentType(h.Get("Content-Type"), w.excluded)
+	} else {
+		compress = false
+	}
+	if compress {
+		h.Set("Content-Encoding", w.compressor.Encoding)
+		h.Del("Content-Length")
+		w.cw = w.compressor.NewWriter(w.ResponseWriter)
+	}
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.cw != nil {
+		_, err = w.cw.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush implements the http.Flusher interface. A buffered response is
+// compressed regardless of its size.
+func (w *compressWriter) Flush() {
+	if !w.started {
+		if len(w.buf) == 0 {
+			return
+		}
+		if err := w.start(w.Header().Get("Content-Encoding") == "" && bodyAllowed(w.status)); err != nil {
+			return
+		}
+	}
+	if f, ok := w.cw.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close writes the buffered response and closes the compressing writer.
+func (w *compressWriter) Close() error {
+	if !w.started {
+		if w.buf == nil && w.status == 0 {
+			// Nothing was written, e.g. the connection was hijacked.
+			return nil
+		}
+		return w.start(false)
+	}
+	if w.cw != nil {
+		err := w.cw.Close()
+		w.cw = nil
+		return err
+	}
+	return nil
+}
+
+// Unwrap returns the underlying ResponseWriter, e.g. for
+// http.ResponseController.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack implements the http.Hijacker interface.
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("jsonrest: response writer does not support hijacking")
+	}
+	return hj.Hijack()
+}
+
+// Push implements the http.Pusher interface.
+func (w *compressWriter) Push(target string, opts *http.PushOptions) error {
+	pusher, ok := w.ResponseWriter.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	if opts == nil {
+		opts = &http.PushOptions{}
+	}
+	if opts.Header == nil {
+		opts.Header = make(http.Header)
+	}
+	if opts.Header.Get(HeaderAcceptEncoding) == "" {
+		opts.Header.Set(HeaderAcceptEncoding, w.compressor.Encoding)
+	}
+	return pusher.Push(target, opts)
+}
+
+// excludedContentType reports whether the content type is one of the excluded
+// media types.
+func excludedContentType(contentType string, excluded []string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	for _, t := range excluded {
+		if mediaType == t || (strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// bodyAllowed reports whether a response with the status may have a body.
+func bodyAllowed(status int) bool {
+	return status != http.StatusNoContent && status != http.StatusNotModified
+}
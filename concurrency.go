@@ -0,0 +1,83 @@
+package jsonrest
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// concurrencyLimiter bounds the number of requests handled concurrently.
+type concurrencyLimiter struct {
+	sem          chan struct{}
+	queueTimeout time.Duration
+	retryAfter   string
+}
+
+func newConcurrencyLimiter(n int, queueTimeout time.Duration) *concurrencyLimiter {
+	retryAfter := int((queueTimeout + time.Second - 1) / time.Second)
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	return &concurrencyLimiter{
+		sem:          make(chan struct{}, n),
+		queueTimeout: queueTimeout,
+		retryAfter:   strconv.Itoa(retryAfter),
+	}
+}
+
+// WithMaxConcurrentRequests is an Option available for NewRouter and Group to
+// bound the number of requests handled concurrently by the router's routes,
+// including those of its groups. When the limit is reached, requests wait up
+// to queueTimeout for a slot, then are rejected with a 503 error and a
+// Retry-After header. A group given its own limit is bounded by it instead.
+func WithMaxConcurrentRequests(n int, queueTimeout time.Duration) Option {
+	l := newConcurrencyLimiter(n, queueTimeout)
+	return func(r *Router) {
+		r.limiter = l
+	}
+}
+
+// MaxConcurrentRequests is a RouteOption bounding the number of requests
+// handled concurrently by the route, like WithMaxConcurrentRequests, instead
+// of the router's limit.
+func MaxConcurrentRequests(n int, queueTimeout time.Duration) RouteOption {
+	return func(r *Route) {
+		r.limiter = newConcurrencyLimiter(n, queueTimeout)
+	}
+}
+
+// limitHandle wraps the handle to apply the concurrency limit.
+func limitHandle(l *concurrencyLimiter, h Handle, r *Router) Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps Params) {
+		if !l.acquire(req) {
+			w.Header().Set("Retry-After", l.retryAfter)
+			r.sendError(w, req, errOverloaded)
+			return
+		}
+		defer func() { <-l.sem }()
+		h(w, req, ps)
+	}
+}
+
+// acquire waits for a slot, up to the queue timeout, and reports whether it
+// was acquired.
+func (l *concurrencyLimiter) acquire(req *http.Request) bool {
+	select {
+	case l.sem <- struct{}{}:
+		return true
+	default:
+	}
+	if l.queueTimeout <= 0 {
+		return false
+	}
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	select {
+	case l.sem <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-req.Context().Done():
+		return false
+	}
+}
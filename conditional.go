@@ -0,0 +1,58 @@
+package jsonrest
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SetLastModified sets the Last-Modified header of the response to t, unless
+// t is zero. The router answers the GET and HEAD requests whose
+// If-Modified-Since header is not before t with a 304 Not Modified response,
+// without encoding the result of the endpoint. Likewise, if the endpoint sets
+// an ETag header, the requests with a matching If-None-Match header are
+// answered with a 304 response.
+func (r *Request) SetLastModified(t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	r.responseWriter.Header().Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+}
+
+// notModified reports whether the conditional headers of the GET or HEAD
+// request (If-None-Match, or else If-Modified-Since) are satisfied by the
+// validators of the response header, in which case a 304 Not Modified
+// response should be sent instead of the representation.
+func notModified(req *http.Request, h http.Header) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		etag := h.Get("ETag")
+		return etag != "" && etagMatch(inm, etag)
+	}
+	ims, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lm, err := http.ParseTime(h.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !lm.Truncate(time.Second).After(ims)
+}
+
+// etagMatch reports whether the If-None-Match header value matches the ETag,
+// using the weak comparison function of RFC 7232.
+func etagMatch(ifNoneMatch, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package jsonrest
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+)
+
+// A Contract describes the shapes a route accepts and emits, as declared with
+// RequestSchema and ResponseSchema.
+type Contract struct {
+	Method   string  `json:"method"`
+	Path     string  `json:"path"`
+	Name     string  `json:"name,omitempty"`
+	Request  *Schema `json:"request,omitempty"`
+	Response *Schema `json:"response,omitempty"`
+}
+
+// Contracts returns the contracts of the routes registered with the router
+// and its groups that declare a request or response schema, in registration
+// order.
+func (r *Router) Contracts() []Contract {
+	var contracts []Contract
+	for _, route := range r.RegisteredRoutes() {
+		if route.RequestSchema == nil && route.ResponseSchema == nil {
+			continue
+		}
+		contracts = append(contracts, Contract{
+			Method:   route.Method,
+			Path:     route.Path,
+			Name:     route.Name,
+			Request:  route.RequestSchema,
+			Response: route.ResponseSchema,
+		})
+	}
+	return contracts
+}
+
+// WriteContracts writes the contracts of the router as an indented JSON
+// document, sorted by path and method, e.g. to be published for the API's
+// consumers or compared with a golden file in CI.
+func (r *Router) WriteContracts(w io.Writer) error {
+	contracts := r.Contracts()
+	sort.SliceStable(contracts, func(i, j int) bool {
+		if contracts[i].Path != contracts[j].Path {
+			return contracts[i].Path < contracts[j].Path
+		}
+		return contracts[i].Method < contracts[j].Method
+	})
+	if contracts == nil {
+		contracts = []Contract{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Contracts []Contract `json:"contracts"`
+	}{contracts})
+}
+
+// Example returns an example value matching the schema, e.g. to exercise an
+// endpoint or mock its response: the first of its Examples, or else its
+// Default, or else a generated value. Generated objects have all their
+// properties, arrays their minimum number of items, and scalars the first
+// enum value, a value of their format, or a value within their bounds.
+// Patterns are not taken into account.
+func (s *Schema) Example() interface{} {
+	if s == nil {
+		return nil
+	}
+	if len(s.Examples) > 0 {
+		return s.Examples[0]
+	}
+	if s.Default != nil {
+		return s.Default
+	}
+	if len(s.Enum) > 0 {
+		return s.Enum[0]
+	}
+	switch s.Type {
+	case "object":
+		obj := make(map[string]interface{}, len(s.Properties))
+		for name, prop := range s.Properties {
+			obj[name] = prop.Example()
+		}
+		return obj
+	case "array":
+		n := 0
+		if s.MinItems != nil {
+			n = *s.MinItems
+		}
+		if n == 0 && s.Items != nil {
+			n = 1
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			items[i] = s.Items.Example()
+		}
+		return items
+	case "string":
+		return s.exampleString()
+	case "integer", "number":
+		f := 1.0
+		if s.Minimum != nil && f < *s.Minimum {
+			f = *s.Minimum
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			f = *s.Maximum
+		}
+		if s.Type == "integer" {
+			return int64(f)
+		}
+		return f
+	case "boolean":
+		return true
+	}
+	return nil
+}
+
+// exampleFormats are example strings of the supported formats.
+var exampleFormats = map[string]string{
+	"date-time": "2006-01-02T15:04:05Z",
+	"date":      "2006-01-02",
+	"uuid":      "123e4567-e89b-12d3-a456-426614174000",
+	"email":     "user@example.com",
+	"uri":       "https://example.com",
+	"byte":      "ZXhhbXBsZQ==",
+}
+
+func (s *Schema) exampleString() string {
+	if example, ok := exampleFormats[s.Format]; ok {
+		return example
+	}
+	example := "example"
+	if s.MinLength != nil && len(example) < *s.MinLength {
+		example += strings.Repeat("x", *s.MinLength-len(example))
+	}
+	if s.MaxLength != nil && len(example) > *s.MaxLength {
+		example = example[:*s.MaxLength]
+	}
+	return example
+}
@@ -0,0 +1,74 @@
+package jsonrest
+
+import "net/http"
+
+// CookieDefaults are the attributes applied to the cookies set with
+// Request.SetCookie which do not set them. See WithCookieDefaults.
+type CookieDefaults struct {
+	// Path defaults to "/".
+	Path   string
+	Domain string
+
+	// Secure and HttpOnly, if true, apply to all the cookies.
+	Secure   bool
+	HttpOnly bool
+
+	// SameSite defaults to http.SameSiteLaxMode.
+	SameSite http.SameSite
+}
+
+// defaultCookieDefaults are the cookie defaults of routers without
+// WithCookieDefaults.
+var defaultCookieDefaults = CookieDefaults{Path: "/", SameSite: http.SameSiteLaxMode}
+
+// WithCookieDefaults is an Option available for NewRouter and Group to set the
+// default attributes of the cookies set with Request.SetCookie, e.g. to make
+// them all secure in production.
+func WithCookieDefaults(d CookieDefaults) Option {
+	return func(r *Router) {
+		if d.Path == "" {
+			d.Path = defaultCookieDefaults.Path
+		}
+		if d.SameSite == 0 {
+			d.SameSite = defaultCookieDefaults.SameSite
+		}
+		r.cookieDefaults = &d
+	}
+}
+
+// Cookie returns the named cookie of the request, or nil if there is none.
+func (r *Request) Cookie(name string) *http.Cookie {
+	c, err := r.req.Cookie(name)
+	if err != nil {
+		return nil
+	}
+	return c
+}
+
+// Cookies returns the cookies of the request.
+func (r *Request) Cookies() []*http.Cookie {
+	return r.req.Cookies()
+}
+
+// SetCookie adds a Set-Cookie header to the response, with the router's
+// cookie defaults for the attributes the cookie does not set. See
+// WithCookieDefaults. The cookie is not modified.
+func (r *Request) SetCookie(cookie *http.Cookie) {
+	d := defaultCookieDefaults
+	if r.router != nil && r.router.cookieDefaults != nil {
+		d = *r.router.cookieDefaults
+	}
+	c := *cookie
+	if c.Path == "" {
+		c.Path = d.Path
+	}
+	if c.Domain == "" {
+		c.Domain = d.Domain
+	}
+	if c.SameSite == 0 {
+		c.SameSite = d.SameSite
+	}
+	c.Secure = c.Secure || d.Secure
+	c.HttpOnly = c.HttpOnly || d.HttpOnly
+	http.SetCookie(r.responseWriter, &c)
+}
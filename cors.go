@@ -0,0 +1,166 @@
+package jsonrest
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions configures the Cross-Origin Resource Sharing headers of the
+// responses.
+type CORSOptions struct {
+	// AllowedOrigins lists the origins allowed to make cross-origin
+	// requests. "*" allows any origin.
+	AllowedOrigins []string
+
+	// AllowedMethods lists the methods allowed in preflight requests. It
+	// defaults to GET, HEAD, POST, PUT, PATCH and DELETE.
+	AllowedMethods []string
+
+	// AllowedHeaders lists the request headers allowed in preflight
+	// requests. By default, the requested headers are allowed.
+	AllowedHeaders []string
+
+	// ExposedHeaders lists the response headers exposed to the client.
+	ExposedHeaders []string
+
+	// AllowCredentials indicates if the requests may include credentials.
+	AllowCredentials bool
+
+	// MaxAge, if positive, is how long the result of a preflight request
+	// may be cached by the client, sent in the Access-Control-Max-Age
+	// header with a precision of a second.
+	MaxAge time.Duration
+
+	// AllowPrivateNetwork indicates if requests from public websites to the
+	// private network are allowed, by answering the
+	// Access-Control-Request-Private-Network header of preflight requests.
+	AllowPrivateNetwork bool
+}
+
+// WithCORS is an Option available for NewRouter and Group to answer preflight
+// requests and set the CORS headers of the responses to cross-origin requests
+// under the router's path prefix. A group's options override the inherited
+// ones for the routes of the group.
+func WithCORS(opts CORSOptions) Option {
+	return func(r *Router) {
+		r.cors = &opts
+	}
+}
+
+// WithCORSMaxAge is an Option available for NewRouter and Group to override
+// the MaxAge of the inherited CORS options, e.g. to let clients cache the
+// preflight requests of a group longer.
+func WithCORSMaxAge(maxAge time.Duration) Option {
+	return func(r *Router) {
+		r.cors = r.cors.with(func(o *CORSOptions) { o.MaxAge = maxAge })
+	}
+}
+
+// WithCORSPrivateNetwork is an Option available for NewRouter and Group to
+// override the AllowPrivateNetwork of the inherited CORS options.
+func WithCORSPrivateNetwork(allow bool) Option {
+	return func(r *Router) {
+		r.cors = r.cors.with(func(o *CORSOptions) { o.AllowPrivateNetwork = allow })
+	}
+}
+
+// with returns a copy of the options modified by fn.
+func (o *CORSOptions) with(fn func(*CORSOptions)) *CORSOptions {
+	var c CORSOptions
+	if o != nil {
+		c = *o
+	}
+	fn(&c)
+	return &c
+}
+
+// prefixCORS are the CORS options of the requests under a path prefix.
+type prefixCORS struct {
+	prefix string
+	opts   *CORSOptions
+}
+
+// corsOptions returns the CORS options for the request path, if any.
+func (r *Router) corsOptions(path string) *CORSOptions {
+	var opts *CORSOptions
+	longest := -1
+	for _, p := range r.corsPolicies {
+		if len(p.prefix) > longest && strings.HasPrefix(path, p.prefix) {
+			opts, longest = p.opts, len(p.prefix)
+		}
+	}
+	return opts
+}
+
+// allowOrigin returns the value of the Access-Control-Allow-Origin header for
+// the origin, or an empty string if the origin is not allowed.
+func (o *CORSOptions) allowOrigin(origin string) string {
+	for _, allowed := range o.AllowedOrigins {
+		if allowed == "*" {
+			if o.AllowCredentials {
+				return origin
+			}
+			return "*"
+		}
+		if strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// serveCORS sets the CORS headers of the response to a cross-origin request.
+// It reports whether the request was a preflight request, which is then
+// answered.
+func (r *Router) serveCORS(w http.ResponseWriter, req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	opts := r.corsOptions(req.URL.Path)
+	if opts == nil {
+		return false
+	}
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	allowOrigin := opts.allowOrigin(origin)
+	if allowOrigin == "" {
+		return false
+	}
+
+	h.Set("Access-Control-Allow-Origin", allowOrigin)
+	if opts.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	preflight := req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != ""
+	if !preflight {
+		if len(opts.ExposedHeaders) > 0 {
+			h.Set("Access-Control-Expose-Headers", strings.Join(opts.ExposedHeaders, ", "))
+		}
+		return false
+	}
+
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+	methods := opts.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+	}
+	h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if len(opts.AllowedHeaders) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(opts.AllowedHeaders, ", "))
+	} else if requested := req.Header.Get("Access-Control-Request-Headers"); requested != "" {
+		h.Set("Access-Control-Allow-Headers", requested)
+	}
+	if opts.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge/time.Second)))
+	}
+	if opts.AllowPrivateNetwork && req.Header.Get("Access-Control-Request-Private-Network") == "true" {
+		h.Set("Access-Control-Allow-Private-Network", "true")
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
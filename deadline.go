@@ -0,0 +1,118 @@
+package jsonrest
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errDeadlineExceeded is returned when the deadline requested by the client
+// expires before the endpoint completes.
+var errDeadlineExceeded = Error(http.StatusGatewayTimeout, "gateway_timeout", "the request deadline was exceeded")
+
+// WithClientDeadlines is an Option available for NewRouter and Group to honor
+// the timeout requested by the client in the X-Request-Timeout header, a Go
+// duration such as "1.5s" or a number of seconds, or in the Grpc-Timeout
+// header, e.g. "100m" for 100 milliseconds. The context of the middleware and
+// endpoint gets a deadline from the timeout, capped by max which must be
+// positive, and a 504 error
+// is sent if the deadline expires before the endpoint completes. Requests
+// without a timeout header are not affected, and a malformed header is
+// answered with a 400 error.
+func WithClientDeadlines(max time.Duration) Option {
+	return func(r *Router) {
+		r.clientDeadlineMax = max
+	}
+}
+
+// deadlineEndpoint wraps e to run it with the deadline requested by the
+// client, capped by max.
+func deadlineEndpoint(e Endpoint, max time.Duration) Endpoint {
+	return func(ctx context.Context, req *Request) (interface{}, error) {
+		timeout, ok, err := requestTimeout(req.req.Header)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return e(ctx, req)
+		}
+		if timeout > max {
+			timeout = max
+		}
+		if timeout <= 0 {
+			return nil, errDeadlineExceeded
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		raw := req.req
+		req.req = raw.WithContext(ctx)
+		defer func() { req.req = raw }()
+
+		result, err := e(ctx, req)
+		if ctx.Err() == context.DeadlineExceeded && raw.Context().Err() == nil {
+			return nil, errDeadlineExceeded
+		}
+		return result, err
+	}
+}
+
+// requestTimeout returns the timeout requested by the client, and whether
+// there is one.
+func requestTimeout(h http.Header) (time.Duration, bool, error) {
+	if val := h.Get("X-Request-Timeout"); val != "" {
+		if d, err := time.ParseDuration(val); err == nil {
+			return d, true, nil
+		}
+		secs, err := strconv.ParseFloat(val, 64)
+		if err != nil || secs != secs {
+			return 0, false, BadRequest("invalid X-Request-Timeout header")
+		}
+		if secs >= float64(math.MaxInt64/time.Second) {
+			return math.MaxInt64, true, nil
+		}
+		return time.Duration(secs * float64(time.Second)), true, nil
+	}
+	if val := h.Get("Grpc-Timeout"); val != "" {
+		d, ok := parseGRPCTimeout(val)
+		if !ok {
+			return 0, false, BadRequest("invalid Grpc-Timeout header")
+		}
+		return d, true, nil
+	}
+	return 0, false, nil
+}
+
+// grpcTimeoutUnits are the units of the Grpc-Timeout header.
+var grpcTimeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// parseGRPCTimeout parses a timeout in the format of the Grpc-Timeout header:
+// at most 8 digits followed by a unit.
+func parseGRPCTimeout(val string) (time.Duration, bool) {
+	if len(val) < 2 || len(val) > 9 {
+		return 0, false
+	}
+	unit, ok := grpcTimeoutUnits[val[len(val)-1]]
+	digits := val[:len(val)-1]
+	if !ok || strings.TrimLeft(digits, "0123456789") != "" {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	if d := time.Duration(n) * unit; d/unit == time.Duration(n) {
+		return d, true
+	}
+	return 0, false
+}
@@ -0,0 +1,110 @@
+package jsonrest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// maxEchoBodySize is the maximum size of the request body reflected by the
+// echo debug endpoint.
+const maxEchoBodySize = 64 << 10
+
+// redactedEchoHeaders are the request headers whose values are not
+// reflected by the echo debug endpoint.
+var redactedEchoHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// WithDebugEndpoints is an Option available for NewRouter to register debug
+// endpoints, for the requests matching allow; other requests get a 404
+// error, as if the endpoints did not exist:
+//
+//   - /debug/echo, for all the common methods and TRACE, reflects the
+//     request: method, URL, headers (except credentials), URL parameters of
+//     the path following /debug/echo/, and body.
+//   - GET /debug/routes lists the registered routes.
+//
+// The endpoints are registered under the router's path prefix, and run the
+// router's middleware. It has no effect on groups.
+func WithDebugEndpoints(allow RequestPredicate) Option {
+	return func(r *Router) {
+		if r.parent != nil {
+			return
+		}
+		r.debugAccess = allow
+	}
+}
+
+// registerDebugEndpoints registers the debug endpoints, see
+// WithDebugEndpoints.
+func (r *Router) registerDebugEndpoints() {
+	allow := r.debugAccess
+	debug := r.Group()
+	debug.UseNamed("jsonrest.debugAccess", func(next Endpoint) Endpoint {
+		return func(ctx context.Context, req *Request) (interface{}, error) {
+			if !allow(req) {
+				return nil, Error(http.StatusNotFound, "not_found", "url not found")
+			}
+			return next(ctx, req)
+		}
+	})
+	for _, method := range append([]string{http.MethodTrace}, patternMethods...) {
+		debug.Handle(method, "/debug/echo", echoEndpoint)
+		debug.Handle(method, "/debug/echo/*path", echoEndpoint)
+	}
+	debug.Get("/debug/routes", func(ctx context.Context, req *Request) (interface{}, error) {
+		type route struct {
+			Method     string   `json:"method"`
+			Path       string   `json:"path"`
+			Name       string   `json:"name,omitempty"`
+			Stub       bool     `json:"stub,omitempty"`
+			Mock       bool     `json:"mock,omitempty"`
+			Deprecated bool     `json:"deprecated,omitempty"`
+			Scopes     []string `json:"scopes,omitempty"`
+		}
+		routes := []route{}
+		for _, rt := range r.RegisteredRoutes() {
+			routes = append(routes, route{rt.Method, rt.Path, rt.Name, rt.Stub, rt.Mock, rt.Deprecated, rt.Scopes})
+		}
+		return routes, nil
+	})
+}
+
+// echoEndpoint reflects the request, see WithDebugEndpoints.
+func echoEndpoint(ctx context.Context, req *Request) (interface{}, error) {
+	header := req.req.Header.Clone()
+	for _, key := range redactedEchoHeaders {
+		if _, ok := header[key]; ok {
+			header[key] = []string{Redacted}
+		}
+	}
+	params := make(map[string]string, len(req.params))
+	for _, p := range req.params {
+		params[p.Key] = p.Value
+	}
+
+	var body interface{}
+	if req.req.Body != nil {
+		b, err := ioutil.ReadAll(io.LimitReader(req.req.Body, maxEchoBodySize))
+		if err != nil {
+			return nil, BadRequest("cannot read request body").Wrap(err)
+		}
+		if json.Valid(b) {
+			body = json.RawMessage(b)
+		} else if len(b) > 0 {
+			body = string(b)
+		}
+	}
+
+	return M{
+		"method":  req.Method(),
+		"url":     req.req.URL.String(),
+		"host":    req.req.Host,
+		"remote":  req.req.RemoteAddr,
+		"headers": header,
+		"params":  params,
+		"query":   req.req.URL.Query(),
+		"body":    body,
+	}, nil
+}
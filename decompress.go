@@ -0,0 +1,95 @@
+package jsonrest
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// WithRequestDecompression is an Option available for NewRouter and Group to
+// decompress the request bodies with a gzip or deflate Content-Encoding before
+// they are read by the endpoint. Requests with another encoding are rejected
+// with a 415 error, and corrupt bodies with a 400 error. Reading more than
+// maxSize decompressed bytes fails with a 413 error, to prevent decompression
+// bombs.
+func WithRequestDecompression(maxSize int64) Option {
+	return func(r *Router) {
+		r.maxDecompressedSize = maxSize
+	}
+}
+
+// decompressRequest replaces the body of a request with a Content-Encoding
+// with its decompressed content.
+func decompressRequest(req *http.Request, maxSize int64) error {
+	header := req.Header.Get("Content-Encoding")
+	if header == "" || req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+
+	codings := strings.Split(header, ",")
+	body := io.ReadCloser(req.Body)
+	// Codings are listed in the order they were applied.
+	for i := len(codings) - 1; i >= 0; i-- {
+		var err error
+		switch coding := strings.ToLower(strings.TrimSpace(codings[i])); coding {
+		case "identity":
+		case "gzip", "x-gzip":
+			body, err = gzip.NewReader(body)
+		case "deflate":
+			body, err = zlib.NewReader(body)
+		default:
+			return Error(http.StatusUnsupportedMediaType, "unsupported_encoding", "unsupported content encoding "+strconv.Quote(coding))
+		}
+		if err != nil {
+			return BadRequest("malformed " + codings[i] + " request body").Wrap(err)
+		}
+	}
+
+	req.Body = &limitedBody{ReadCloser: body, original: req.Body, remaining: maxSize}
+	req.Header.Del("Content-Encoding")
+	req.Header.Del("Content-Length")
+	req.ContentLength = -1
+	return nil
+}
+
+// limitedBody is a decompressed request body failing once more than a maximum
+// number of bytes is read.
+type limitedBody struct {
+	io.ReadCloser
+	original  io.Closer
+	remaining int64
+}
+
+// Read implements the io.Reader interface.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, errBodyTooLarge()
+	}
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n, errBodyTooLarge()
+	}
+	if err != nil && err != io.EOF {
+		err = BadRequest("malformed compressed request body").Wrap(err)
+	}
+	return n, err
+}
+
+// Close implements the io.Closer interface.
+func (b *limitedBody) Close() error {
+	b.ReadCloser.Close()
+	return b.original.Close()
+}
+
+// errBodyTooLarge returns the error of a request body exceeding its maximum
+// size.
+func errBodyTooLarge() *HTTPError {
+	return Error(http.StatusRequestEntityTooLarge, "request_too_large", "request body too large")
+}
@@ -0,0 +1,41 @@
+package jsonrest
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Deprecated is a RouteOption marking the route as deprecated. Its responses
+// have a Deprecation header, a Sunset header if sunset is not zero, and a Link
+// header to the documentation with the "deprecation" relation if link is not
+// empty. For example:
+//
+//	r.Get("/v1/users", listUsersV1, jsonrest.Deprecated(sunset, "https://example.com/migrate"))
+func Deprecated(sunset time.Time, link string) RouteOption {
+	return func(r *Route) {
+		r.Deprecated = true
+		r.Sunset = sunset
+		r.DeprecationLink = link
+	}
+}
+
+// WithDeprecationHook is an Option available for NewRouter and Group to call
+// fn for each request to a deprecated route, e.g. to log or count the clients
+// still using it.
+func WithDeprecationHook(fn func(ctx context.Context, req *Request)) Option {
+	return func(r *Router) {
+		r.deprecationHook = fn
+	}
+}
+
+// setDeprecationHeaders sets the response headers of a deprecated route.
+func setDeprecationHeaders(h http.Header, route *Route) {
+	h.Set("Deprecation", "true")
+	if !route.Sunset.IsZero() {
+		h.Set("Sunset", route.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if route.DeprecationLink != "" {
+		h.Add("Link", "<"+route.DeprecationLink+`>; rel="deprecation"`)
+	}
+}
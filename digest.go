@@ -0,0 +1,111 @@
+package jsonrest
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// digestAlgorithms maps the supported Digest algorithms (RFC 3230) to their
+// hash functions.
+var digestAlgorithms = map[string]func() hash.Hash{
+	"MD5":     md5.New,
+	"SHA-256": sha256.New,
+	"SHA-512": sha512.New,
+}
+
+// DigestValidationMiddleware returns a middleware validating the request body
+// against its Content-MD5 and Digest headers, if present. Digests of
+// unsupported algorithms are ignored. The body is read into memory; bodies
+// larger than maxBodySize are rejected with a 413 error, and bodies not
+// matching their digest with a 400 error.
+func DigestValidationMiddleware(maxBodySize int64) Middleware {
+	return func(next Endpoint) Endpoint {
+		return func(ctx context.Context, req *Request) (interface{}, error) {
+			expected := requestDigests(req.Raw().Header)
+			if len(expected) == 0 {
+				return next(ctx, req)
+			}
+
+			body, err := ioutil.ReadAll(io.LimitReader(req.Raw().Body, maxBodySize+1))
+			req.Raw().Body.Close()
+			if err != nil {
+				return nil, BadRequest("cannot read request body").Wrap(err)
+			}
+			if int64(len(body)) > maxBodySize {
+				return nil, errBodyTooLarge()
+			}
+			for alg, want := range expected {
+				if subtle.ConstantTimeCompare(digest(alg, body), want) != 1 {
+					return nil, BadRequest("request body does not match its " + alg + " digest")
+				}
+			}
+			req.Raw().Body = ioutil.NopCloser(bytes.NewReader(body))
+			return next(ctx, req)
+		}
+	}
+}
+
+// WithResponseDigest is an Option available for NewRouter and Group to set
+// the Digest header (RFC 3230) of JSON responses, using the given algorithms
+// ("MD5", "SHA-256" or "SHA-512"). It defaults to SHA-256.
+func WithResponseDigest(algs ...string) Option {
+	if len(algs) == 0 {
+		algs = []string{"SHA-256"}
+	}
+	return WithPostEncodeHook(func(h http.Header, _ int, body []byte) {
+		values := make([]string, 0, len(algs))
+		for _, alg := range algs {
+			if _, ok := digestAlgorithms[alg]; ok {
+				values = append(values, alg+"="+base64.StdEncoding.EncodeToString(digest(alg, body)))
+			}
+		}
+		h.Set("Digest", strings.Join(values, ","))
+	})
+}
+
+// requestDigests returns the decoded digests of the supported algorithms
+// found in the Content-MD5 and Digest headers.
+func requestDigests(h http.Header) map[string][]byte {
+	digests := make(map[string][]byte)
+	if v := h.Get("Content-MD5"); v != "" {
+		digests["MD5"] = decodeDigest(v)
+	}
+	for _, v := range strings.Split(h.Get("Digest"), ",") {
+		parts := strings.SplitN(strings.TrimSpace(v), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		alg := strings.ToUpper(parts[0])
+		if _, ok := digestAlgorithms[alg]; ok {
+			digests[alg] = decodeDigest(parts[1])
+		}
+	}
+	return digests
+}
+
+// decodeDigest decodes a base64 digest. Invalid digests decode to an empty
+// value, which never matches.
+func decodeDigest(s string) []byte {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return []byte{}
+	}
+	return b
+}
+
+// digest returns the digest of the body with the algorithm.
+func digest(alg string, body []byte) []byte {
+	h := digestAlgorithms[alg]()
+	h.Write(body)
+	return h.Sum(nil)
+}
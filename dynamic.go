@@ -0,0 +1,130 @@
+package jsonrest
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// dynamicMatcher is a Matcher whose routes can be changed while it serves
+// requests: once it started serving, each change builds a new matcher with
+// the updated routes, which atomically replaces the current one.
+type dynamicMatcher struct {
+	newMatcher NewMatcherFunc
+	config     MatcherConfig
+
+	current atomic.Value // Matcher
+
+	// serving is set, with mu held, before the current matcher is first
+	// read, so that changes made with mu held while it is unset can update
+	// the current matcher in place.
+	serving int32 // accessed atomically
+
+	mu      sync.Mutex
+	entries []matcherEntry
+}
+
+// matcherEntry is a handle registered with a dynamicMatcher.
+type matcherEntry struct {
+	method, path string
+	handle       Handle
+}
+
+func newDynamicMatcher(newMatcher NewMatcherFunc, config MatcherConfig) *dynamicMatcher {
+	m := &dynamicMatcher{newMatcher: newMatcher, config: config}
+	m.current.Store(newMatcher(config))
+	return m
+}
+
+// ServeHTTP implements the Matcher interface.
+func (m *dynamicMatcher) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	m.startServing()
+	m.current.Load().(Matcher).ServeHTTP(w, req)
+}
+
+// Lookup implements the Matcher interface.
+func (m *dynamicMatcher) Lookup(method, path string) (Handle, Params) {
+	m.startServing()
+	return m.current.Load().(Matcher).Lookup(method, path)
+}
+
+// startServing sets the serving flag, waiting for the in-place change in
+// progress, if any, to complete.
+func (m *dynamicMatcher) startServing() {
+	if atomic.LoadInt32(&m.serving) == 1 {
+		return
+	}
+	m.mu.Lock()
+	atomic.StoreInt32(&m.serving, 1)
+	m.mu.Unlock()
+}
+
+// Handle implements the Matcher interface.
+func (m *dynamicMatcher) Handle(method, path string, handle Handle) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry := matcherEntry{method, path, handle}
+	if atomic.LoadInt32(&m.serving) == 0 {
+		m.current.Load().(Matcher).Handle(method, path, handle)
+		m.entries = append(m.entries, entry)
+		return
+	}
+	m.rebuild(append(m.entries[:len(m.entries):len(m.entries)], entry))
+}
+
+// remove unregisters the handle for the method and path, and reports whether
+// there was one.
+func (m *dynamicMatcher) remove(method, path string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, e := range m.entries {
+		if e.method == method && e.path == path {
+			entries := make([]matcherEntry, 0, len(m.entries)-1)
+			entries = append(entries, m.entries[:i]...)
+			m.rebuild(append(entries, m.entries[i+1:]...))
+			return true
+		}
+	}
+	return false
+}
+
+// rebuild replaces the current matcher with one holding the entries. It
+// panics, leaving the current matcher in place, if an entry is invalid.
+func (m *dynamicMatcher) rebuild(entries []matcherEntry) {
+	matcher := m.newMatcher(m.config)
+	for _, e := range entries {
+		matcher.Handle(e.method, e.path, e.handle)
+	}
+	m.current.Store(matcher)
+	m.entries = entries
+}
+
+// Remove unregisters the route for the method and path, given relative to the
+// router's path prefix like for Handle, and reports whether there was one.
+// Like Handle, it can be called while the router serves requests, e.g. by
+// services loading plugins at runtime; requests in progress complete with the
+// removed route.
+func (r *Router) Remove(method, path string) bool {
+	path = r.prefix + path
+	root := r.root()
+	root.routesMu.Lock()
+	defer root.routesMu.Unlock()
+
+	matcherPath := path
+	if root.caseInsensitive {
+		matcherPath = lowerStaticPath(path)
+	}
+	if !root.matcher.(*dynamicMatcher).remove(method, matcherPath) {
+		return false
+	}
+	for i, route := range root.routes {
+		if route.Method == method && route.Path == path {
+			root.routes = append(root.routes[:i:i], root.routes[i+1:]...)
+			if route.Name != "" {
+				delete(root.namedRoutes, route.Name)
+			}
+			break
+		}
+	}
+	return true
+}
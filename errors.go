@@ -16,6 +16,50 @@ type HTTPErrorResponse interface {
 	StatusCode() int
 }
 
+// An ErrorEncoder writes an error response to the client. The error has been
+// translated by the router, so that internal errors are obfuscated unless
+// DumpErrors is enabled.
+type ErrorEncoder func(w http.ResponseWriter, req *http.Request, err HTTPErrorResponse)
+
+// ProblemJSONEncoder is an ErrorEncoder rendering errors as RFC 7807 problem
+// details, with the application/problem+json content type. An HTTPError's
+// code and details are included as extension members; other errors are
+// marshaled as-is, or rendered as an unknown error if they cannot be.
+func ProblemJSONEncoder(w http.ResponseWriter, req *http.Request, err HTTPErrorResponse) {
+	status := err.StatusCode()
+	var body interface{} = err
+	if httpErr, ok := err.(*HTTPError); ok {
+		body = struct {
+			Type    string   `json:"type"`
+			Title   string   `json:"title"`
+			Status  int      `json:"status"`
+			Detail  string   `json:"detail,omitempty"`
+			Code    string   `json:"code"`
+			Details []string `json:"details,omitempty"`
+		}{
+			Type:    "about:blank",
+			Title:   http.StatusText(status),
+			Status:  status,
+			Detail:  httpErr.Message,
+			Code:    httpErr.Code,
+			Details: httpErr.Details,
+		}
+	}
+
+	b, marshalErr := json.Marshal(body)
+	if marshalErr != nil {
+		status = http.StatusInternalServerError
+		b, _ = json.Marshal(unknownError)
+	}
+	if httpErr, ok := err.(*HTTPError); ok && httpErr.requestID != "" {
+		b = insertField(b, 1, httpErr.requestIDField, httpErr.requestID)
+	}
+
+	w.Header().Set("content-type", "application/problem+json")
+	w.WriteHeader(status)
+	w.Write(append(b, '\n'))
+}
+
 // Error creates an error that will be rendered directly to the client.
 func Error(status int, code, message string) *HTTPError {
 	return &HTTPError{
@@ -41,6 +85,11 @@ func Unauthorized(msg string) *HTTPError {
 	return Error(http.StatusUnauthorized, "unauthorized", msg)
 }
 
+// Forbidden returns an HTTP 403 Forbidden error with a custom error message.
+func Forbidden(msg string) *HTTPError {
+	return Error(http.StatusForbidden, "forbidden", msg)
+}
+
 // UnprocessableEntity returns an HTTP 422 UnprocessableEntity error with a
 // custom error message.
 func UnprocessableEntity(msg string) *HTTPError {
@@ -62,6 +111,10 @@ type HTTPError struct {
 	Status  int
 
 	wrapped error
+
+	// requestID is rendered in the field named requestIDField, if set.
+	requestID      string
+	requestIDField string
 }
 
 // StatusCode implements the HTTPErrorResponse interface.
@@ -81,7 +134,25 @@ func (err *HTTPError) MarshalJSON() ([]byte, error) {
 	wp.Error.Code = err.Code
 	wp.Error.Message = err.Message
 	wp.Error.Details = err.Details
-	return json.Marshal(wp)
+	b, marshalErr := json.Marshal(wp)
+	if marshalErr != nil || err.requestID == "" {
+		return b, marshalErr
+	}
+	return insertField(b, 2, err.requestIDField, err.requestID), nil
+}
+
+// insertField inserts a string field in the non-empty JSON object ending
+// before the last n closing braces of b.
+func insertField(b []byte, n int, name, value string) []byte {
+	k, _ := json.Marshal(name)
+	v, _ := json.Marshal(value)
+	out := make([]byte, 0, len(b)+len(k)+len(v)+2)
+	out = append(out, b[:len(b)-n]...)
+	out = append(out, ',')
+	out = append(out, k...)
+	out = append(out, ':')
+	out = append(out, v...)
+	return append(out, b[len(b)-n:]...)
 }
 
 // Error implements the error interface.
@@ -106,6 +177,18 @@ func (err *HTTPError) Cause() error {
 	return err.wrapped
 }
 
+// withRequestID returns a copy of err rendering the request ID in the given
+// field, if err is an *HTTPError.
+func withRequestID(err HTTPErrorResponse, field, id string) HTTPErrorResponse {
+	httpErr, ok := err.(*HTTPError)
+	if !ok {
+		return err
+	}
+	e := *httpErr // shallow copy
+	e.requestID, e.requestIDField = id, field
+	return &e
+}
+
 // translateError coerces err into an HTTPErrorResponse that can be marshaled directly
 // to the client.
 func translateError(err error, dumpInternalError bool) HTTPErrorResponse {
@@ -0,0 +1,90 @@
+package jsonrest
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An Event is a request-scoped annotation, such as a database query or a
+// cache miss, recorded with Request.AddEvent.
+type Event struct {
+	Name  string
+	Time  time.Time
+	Attrs M
+}
+
+// EventDuration is the attribute of an Event holding its duration, as a
+// time.Duration. It is reported in the Server-Timing header.
+const EventDuration = "duration"
+
+// AddEvent records a request-scoped event with optional attributes. Events are
+// reported in the Server-Timing header (see WithServerTiming) and in the
+// details of internal errors when DumpErrors is enabled, and can be exported
+// to traces by a middleware through Events. It is safe for concurrent use.
+//
+// For example:
+//
+//	start := time.Now()
+//	rows, err := db.QueryContext(ctx, query)
+//	req.AddEvent("db", jsonrest.M{jsonrest.EventDuration: time.Since(start)})
+func (r *Request) AddEvent(name string, attrs M) {
+	r.eventsMu.Lock()
+	defer r.eventsMu.Unlock()
+	r.events = append(r.events, Event{Name: name, Time: time.Now(), Attrs: attrs})
+}
+
+// Events returns the events recorded for the request, in order.
+func (r *Request) Events() []Event {
+	r.eventsMu.Lock()
+	defer r.eventsMu.Unlock()
+	return append([]Event(nil), r.events...)
+}
+
+// WithServerTiming is an Option available for NewRouter and Group to report
+// the request's events in the Server-Timing response header, along with their
+// duration attribute, if any.
+func WithServerTiming() Option {
+	return func(r *Router) {
+		r.serverTiming = true
+	}
+}
+
+// serverTiming formats the events as a Server-Timing header value.
+func serverTiming(events []Event) string {
+	metrics := make([]string, 0, len(events))
+	for _, e := range events {
+		metric := strings.Map(func(c rune) rune {
+			if c > 0x7f || strings.ContainsRune(" \t\"(),/:;<=>?@[\\]{}", c) {
+				return '_'
+			}
+			return c
+		}, e.Name)
+		if d, ok := e.Attrs[EventDuration].(time.Duration); ok {
+			metric += ";dur=" + strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64)
+		}
+		metrics = append(metrics, metric)
+	}
+	return strings.Join(metrics, ", ")
+}
+
+// dumpEvents formats the events for viewing in the details of an error
+// response, for local debugging.
+func dumpEvents(events []Event) []string {
+	lines := make([]string, len(events))
+	for i, e := range events {
+		keys := make([]string, 0, len(e.Attrs))
+		for k := range e.Attrs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		line := "event: " + e.Name
+		for _, k := range keys {
+			line += fmt.Sprintf(" %s=%v", k, redactForLog(e.Attrs[k]))
+		}
+		lines[i] = line
+	}
+	return lines
+}
@@ -0,0 +1,137 @@
+package jsonrest
+
+import (
+	"context"
+	"sync"
+)
+
+// A FlagSubject is who a feature flag is evaluated for.
+type FlagSubject struct {
+	// Principal is the principal of the request, see Request.SetPrincipal.
+	Principal string
+
+	// Tenant is the tenant of the request, see WithTenantResolver.
+	Tenant string
+}
+
+// FeatureFlags evaluates feature flags, e.g. through the SDK of a feature flag
+// service.
+type FeatureFlags interface {
+	// Variant returns the variant of the flag for the subject, e.g. "on" or
+	// "treatment-b", or an empty string if the flag is off.
+	Variant(ctx context.Context, flag string, subject FlagSubject) (string, error)
+}
+
+// The FeatureFlagsFunc type is an adapter to allow the use of ordinary
+// functions as FeatureFlags.
+type FeatureFlagsFunc func(ctx context.Context, flag string, subject FlagSubject) (string, error)
+
+// Variant calls f(ctx, flag, subject).
+func (f FeatureFlagsFunc) Variant(ctx context.Context, flag string, subject FlagSubject) (string, error) {
+	return f(ctx, flag, subject)
+}
+
+// StaticFeatureFlags are FeatureFlags with the same variant for all the
+// subjects, keyed by flag, e.g. for tests or local development.
+type StaticFeatureFlags map[string]string
+
+// Variant implements the FeatureFlags interface.
+func (f StaticFeatureFlags) Variant(_ context.Context, flag string, _ FlagSubject) (string, error) {
+	return f[flag], nil
+}
+
+// A FlagEvaluation reports the evaluation of a feature flag for a request.
+type FlagEvaluation struct {
+	Flag    string      `json:"flag"`
+	Variant string      `json:"variant"`
+	Subject FlagSubject `json:"-"`
+
+	// Err is the error of the evaluation, in which case the flag is off.
+	Err error `json:"-"`
+}
+
+// FeatureFlagOptions configures FeatureFlagMiddleware.
+type FeatureFlagOptions struct {
+	// OnEvaluation, if set, is called for the first evaluation of each flag
+	// of a request, e.g. to count the variants served in metrics.
+	OnEvaluation func(ctx context.Context, eval FlagEvaluation)
+
+	// Audit attaches the evaluations to the audit record of the request,
+	// see AuditMiddleware.
+	Audit bool
+
+	// Events records the evaluations as "feature_flag" request events, see
+	// Request.AddEvent.
+	Events bool
+}
+
+type featureFlagsKey struct{}
+
+// requestFlags are the feature flags of a request, evaluated lazily.
+type requestFlags struct {
+	flags FeatureFlags
+	opts  FeatureFlagOptions
+
+	mu       sync.Mutex
+	variants map[string]string
+}
+
+// FeatureFlagMiddleware returns a middleware making the flags available to
+// the endpoint through Request.Feature and Request.FeatureVariant. Flags are
+// evaluated on first use, once per request, for the principal and tenant of
+// the request at that time, so the middleware can be registered before the
+// authentication middleware.
+func FeatureFlagMiddleware(flags FeatureFlags, opts FeatureFlagOptions) Middleware {
+	return func(next Endpoint) Endpoint {
+		return func(ctx context.Context, req *Request) (interface{}, error) {
+			req.Set(featureFlagsKey{}, &requestFlags{flags: flags, opts: opts})
+			return next(ctx, req)
+		}
+	}
+}
+
+// Feature reports whether the flag is on for the request, i.e. has a
+// non-empty variant. It returns false if FeatureFlagMiddleware is not used.
+func (r *Request) Feature(flag string) bool {
+	return r.FeatureVariant(flag) != ""
+}
+
+// FeatureVariant returns the variant of the flag for the request, or an empty
+// string if the flag is off, its evaluation failed, or FeatureFlagMiddleware
+// is not used.
+func (r *Request) FeatureVariant(flag string) string {
+	rf, ok := r.Get(featureFlagsKey{}).(*requestFlags)
+	if !ok {
+		return ""
+	}
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if variant, ok := rf.variants[flag]; ok {
+		return variant
+	}
+
+	ctx := r.req.Context()
+	eval := FlagEvaluation{
+		Flag:    flag,
+		Subject: FlagSubject{Principal: r.Principal(), Tenant: r.Tenant()},
+	}
+	eval.Variant, eval.Err = rf.flags.Variant(ctx, flag, eval.Subject)
+	if eval.Err != nil {
+		eval.Variant = ""
+	}
+	if rf.variants == nil {
+		rf.variants = make(map[string]string)
+	}
+	rf.variants[flag] = eval.Variant
+
+	if rf.opts.OnEvaluation != nil {
+		rf.opts.OnEvaluation(ctx, eval)
+	}
+	if rf.opts.Audit {
+		r.Audit(eval)
+	}
+	if rf.opts.Events {
+		r.AddEvent("feature_flag", M{"flag": flag, "variant": eval.Variant})
+	}
+	return eval.Variant
+}
@@ -0,0 +1,142 @@
+package jsonrest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// WithSparseFieldsets is an Option available for NewRouter and Group to filter
+// the JSON responses to the fields listed in the query parameter, e.g.
+// ?fields=name,email,address.city. Nested fields are selected with dotted
+// names. Only objects are filtered; the elements of an array are filtered
+// individually, and other values are left untouched. The order of the fields
+// is preserved and unknown fields are ignored. The parameter defaults to
+// "fields".
+func WithSparseFieldsets(param string) Option {
+	if param == "" {
+		param = "fields"
+	}
+	return func(r *Router) {
+		r.fieldsParam = param
+	}
+}
+
+// A fieldSet is a tree of selected fields. A nil fieldSet selects all the
+// fields of a value.
+type fieldSet map[string]fieldSet
+
+// parseFieldSet parses a comma-separated list of dotted field names. It
+// returns nil if the list is empty.
+func parseFieldSet(s string) fieldSet {
+	var fs fieldSet
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if fs == nil {
+			fs = make(fieldSet)
+		}
+		node := fs
+		parts := strings.Split(name, ".")
+		for i, part := range parts {
+			child, ok := node[part]
+			if ok && child == nil {
+				// The field is already selected whole.
+				break
+			}
+			if i == len(parts)-1 {
+				node[part] = nil
+				break
+			}
+			if child == nil {
+				child = make(fieldSet)
+				node[part] = child
+			}
+			node = child
+		}
+	}
+	return fs
+}
+
+// sparseSender wraps send to filter the response to the fields.
+func (r *Router) sparseSender(send func(http.ResponseWriter, int, interface{}), fields fieldSet, req *http.Request) func(http.ResponseWriter, int, interface{}) {
+	return func(w http.ResponseWriter, status int, v interface{}) {
+		if v == nil {
+			send(w, status, v)
+			return
+		}
+		b, err := json.Marshal(v)
+		if err == nil {
+			b, err = filterFields(b, fields)
+		}
+		if err != nil {
+			r.sendError(w, req, err)
+			return
+		}
+		send(w, status, json.RawMessage(b))
+	}
+}
+
+// filterFields returns the JSON value filtered to the fields.
+func filterFields(b []byte, fields fieldSet) ([]byte, error) {
+	if fields == nil {
+		return b, nil
+	}
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || (b[0] != '{' && b[0] != '[') {
+		return b, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(b[0])
+	n := 0
+	for dec.More() {
+		var key string
+		if b[0] == '{' {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, _ = tok.(string)
+		}
+		var val json.RawMessage
+		if err := dec.Decode(&val); err != nil {
+			return nil, err
+		}
+
+		sub := fields
+		if b[0] == '{' {
+			var ok bool
+			if sub, ok = fields[key]; !ok {
+				continue
+			}
+		}
+		filtered, err := filterFields(val, sub)
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			buf.WriteByte(',')
+		}
+		n++
+		if b[0] == '{' {
+			k, _ := json.Marshal(key)
+			buf.Write(k)
+			buf.WriteByte(':')
+		}
+		buf.Write(filtered)
+	}
+	if b[0] == '{' {
+		buf.WriteByte('}')
+	} else {
+		buf.WriteByte(']')
+	}
+	return buf.Bytes(), nil
+}
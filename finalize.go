@@ -0,0 +1,43 @@
+package jsonrest
+
+import (
+	"context"
+	"log"
+	"runtime/debug"
+)
+
+// A ResponseHook is called after a response is written, with the status of
+// the response and the error returned by the endpoint, if any. When the
+// endpoint panics, the status is 500 and the error describes the panic. When
+// the connection was hijacked, the status is 0.
+type ResponseHook func(ctx context.Context, req *Request, status int, err error)
+
+// OnResponse registers a hook called after each response of the router's
+// routes is written, including when the endpoint panics, e.g. for cleanup or
+// metrics. Hooks of the parent routers are called first, in registration
+// order. A panicking hook is logged and does not prevent the other hooks from
+// running. The Request must not be retained by the hook.
+func (r *Router) OnResponse(hook ResponseHook) {
+	r.responseHooks = append(r.responseHooks, hook)
+}
+
+// runResponseHooks calls the response hooks of r's parents, then of r.
+func (r *Router) runResponseHooks(ctx context.Context, req *Request, status int, err error) {
+	if r.parent != nil {
+		r.parent.runResponseHooks(ctx, req, status, err)
+	}
+	for _, hook := range r.responseHooks {
+		runResponseHook(ctx, hook, req, status, err)
+	}
+}
+
+// runResponseHook calls hook, recovering from its panics.
+func runResponseHook(ctx context.Context, hook ResponseHook, req *Request, status int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("panic in response hook for %v: %+v", req.req.RequestURI, r)
+			debug.PrintStack()
+		}
+	}()
+	hook(ctx, req, status, err)
+}
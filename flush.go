@@ -0,0 +1,14 @@
+package jsonrest
+
+import "net/http"
+
+// Flush sends the response written so far to the client, e.g. to stream
+// partial output or server-sent events. It reports whether the response
+// writer supports flushing.
+func (r *Request) Flush() bool {
+	f, ok := r.responseWriter.(http.Flusher)
+	if ok {
+		f.Flush()
+	}
+	return ok
+}
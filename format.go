@@ -0,0 +1,546 @@
+package jsonrest
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"math"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Money is an amount of money in a currency, identified by its ISO 4217 code.
+// It is rendered as a display string in localized responses.
+type Money struct {
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+}
+
+// WithLocalizedFormatting is an Option available for NewRouter and Group to
+// format the annotated fields of responses for the locale of the request (see
+// Request.Locale). Struct fields are annotated with a format tag:
+//
+//	Total  float64   `json:"total" format:"money,EUR"`
+//	Count  int       `json:"count" format:"number"`
+//	Ratio  float64   `json:"ratio" format:"number,1"`
+//	Due    time.Time `json:"due" format:"date"`
+//	SentAt time.Time `json:"sent_at" format:"datetime"`
+//
+// Annotated fields, as well as Money values, are rendered as display strings,
+// e.g. "€1,234.50" or "1.234,50 €". The number format takes an optional
+// precision, which defaults to 0 for integers and 2 for floats. The
+// Content-Language header of the response is set to the locale.
+func WithLocalizedFormatting() Option {
+	return func(r *Router) {
+		r.localizedFormatting = true
+	}
+}
+
+// A localeFormat describes how values are displayed in a locale.
+type localeFormat struct {
+	decimal     string
+	group       string
+	symbolAfter bool
+	date        string
+	time        string
+}
+
+// localeFormats are the formats of the supported locales, by lowercased
+// language tag or primary language.
+var localeFormats = map[string]*localeFormat{
+	"en":    {".", ",", false, "01/02/2006", "3:04 PM"},
+	"en-us": {".", ",", false, "01/02/2006", "3:04 PM"},
+	"en-gb": {".", ",", false, "02/01/2006", "15:04"},
+	"de":    {",", ".", true, "02.01.2006", "15:04"},
+	"fr":    {",", "\u202f", true, "02/01/2006", "15:04"},
+	"es":    {",", ".", true, "02/01/2006", "15:04"},
+	"it":    {",", ".", true, "02/01/2006", "15:04"},
+	"nl":    {",", ".", false, "02-01-2006", "15:04"},
+	"pt":    {",", ".", false, "02/01/2006", "15:04"},
+	"ja":    {".", ",", false, "2006/01/02", "15:04"},
+}
+
+// lookupLocaleFormat returns the format of the locale, falling back to its
+// primary language and to English.
+func lookupLocaleFormat(locale string) *localeFormat {
+	if f, ok := localeFormats[strings.ToLower(locale)]; ok {
+		return f
+	}
+	if f, ok := localeFormats[primaryLanguage(locale)]; ok {
+		return f
+	}
+	return localeFormats["en"]
+}
+
+// currencySymbols are the symbols of common currencies. Other currencies are
+// displayed with their code.
+var currencySymbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+}
+
+// currencyDigits are the numbers of minor digits of the currencies not using
+// 2 digits.
+var currencyDigits = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+}
+
+// formatNumber formats f with the precision and the separators of the locale.
+func formatNumber(f float64, precision int, lf *localeFormat) string {
+	s := strconv.FormatFloat(math.Abs(f), 'f', precision, 64)
+	intPart, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, frac = s[:i], s[i+1:]
+	}
+
+	var b strings.Builder
+	if f < 0 && strings.Trim(s, "0.") != "" {
+		b.WriteByte('-')
+	}
+	for i, c := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(lf.group)
+		}
+		b.WriteRune(c)
+	}
+	if frac != "" {
+		b.WriteString(lf.decimal)
+		b.WriteString(frac)
+	}
+	return b.String()
+}
+
+// formatMoney formats the amount of the currency for the locale.
+func formatMoney(amount float64, currency string, lf *localeFormat) string {
+	digits, ok := currencyDigits[currency]
+	if !ok {
+		digits = 2
+	}
+	num := formatNumber(amount, digits, lf)
+	symbol, ok := currencySymbols[currency]
+	if !ok {
+		symbol = currency
+	}
+	if lf.symbolAfter {
+		return num + "\u00a0" + symbol
+	}
+	sign := ""
+	if strings.HasPrefix(num, "-") {
+		sign, num = "-", num[1:]
+	}
+	if !ok {
+		symbol += "\u00a0"
+	}
+	return sign + symbol + num
+}
+
+// localizedSender wraps send to format the response for the locale.
+func (r *Router) localizedSender(send func(http.ResponseWriter, int, interface{}), locale string) func(http.ResponseWriter, int, interface{}) {
+	lf := lookupLocaleFormat(locale)
+	return func(w http.ResponseWriter, status int, v interface{}) {
+		if locale != "" {
+			w.Header().Set("Content-Language", locale)
+		}
+		send(w, status, localizeValue(v, lf, r.redaction))
+	}
+}
+
+var (
+	moneyType         = reflect.TypeOf(Money{})
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// localizeValue returns a value encoding like v, with its Money values and
+// annotated fields formatted for the locale, and, if redact is set, its
+// redacted fields masked or omitted. If lf is nil, only the redacted fields
+// are masked. The value is encoded by
+// encoding/json, and the fields it selected are then patched, so that the
+// result only differs from the plain encoding in the patched fields. If v
+// cannot be encoded, it is returned as-is for the encoder to report the
+// error.
+func localizeValue(v interface{}, lf *localeFormat, redact bool) interface{} {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	node, err := decodeOrdered(dec)
+	if err != nil {
+		return v
+	}
+	return patchValue(node, reflect.ValueOf(v), lf, redact)
+}
+
+// decodeOrdered decodes the next JSON value of dec, with objects decoded as
+// orderedObject values and numbers as json.Number values.
+func decodeOrdered(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		obj := orderedObject{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			val, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, objectField{key.(string), val})
+		}
+		_, err = dec.Token()
+		return obj, err
+	case json.Delim('['):
+		arr := []interface{}{}
+		for dec.More() {
+			val, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, val)
+		}
+		_, err = dec.Token()
+		return arr, err
+	}
+	return tok, nil
+}
+
+// patchValue returns node, the decoded encoding of v, with the Money values
+// and annotated fields of v formatted for the locale, and, if redact is set,
+// its redacted fields masked or omitted.
+func patchValue(node interface{}, v reflect.Value, lf *localeFormat, redact bool) interface{} {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() || marshalsItself(v) {
+			return node
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() || marshalsItself(v) {
+		return node
+	}
+	if lf != nil && v.Type() == moneyType && v.CanInterface() {
+		m := v.Interface().(Money)
+		return formatMoney(m.Amount, m.Currency, lf)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if obj, ok := node.(orderedObject); ok {
+			return patchStruct(obj, v, lf, redact)
+		}
+	case reflect.Map:
+		obj, ok := node.(orderedObject)
+		if !ok {
+			return node
+		}
+		index := make(map[string]int, len(obj))
+		for i, f := range obj {
+			index[f.name] = i
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			if i, ok := index[mapKeyName(iter.Key())]; ok {
+				obj[i].value = patchValue(obj[i].value, iter.Value(), lf, redact)
+			}
+		}
+		return obj
+	case reflect.Slice, reflect.Array:
+		arr, ok := node.([]interface{})
+		if !ok || len(arr) != v.Len() {
+			return node
+		}
+		for i := range arr {
+			arr[i] = patchValue(arr[i], v.Index(i), lf, redact)
+		}
+		return arr
+	}
+	return node
+}
+
+// patchStruct patches the fields of obj, the decoded encoding of the struct
+// v, see patchValue.
+func patchStruct(obj orderedObject, v reflect.Value, lf *localeFormat, redact bool) orderedObject {
+	for _, f := range jsonFields(v.Type()) {
+		i := obj.index(f.name)
+		if i < 0 {
+			continue
+		}
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok {
+			continue
+		}
+		if masked, omit := redactTag(f.field); masked && redact {
+			if omit {
+				obj = append(obj[:i], obj[i+1:]...)
+			} else {
+				obj[i].value = Redacted
+			}
+			continue
+		}
+		if format := f.field.Tag.Get("format"); format != "" && lf != nil {
+			if s, ok := formatField(fv, format, lf); ok {
+				obj[i].value = s
+				continue
+			}
+		}
+		obj[i].value = patchValue(obj[i].value, fv, lf, redact)
+	}
+	return obj
+}
+
+// marshalsItself reports whether encoding/json encodes v with its
+// json.Marshaler or encoding.TextMarshaler implementation.
+func marshalsItself(v reflect.Value) bool {
+	t := v.Type()
+	if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+		return true
+	}
+	if v.Kind() != reflect.Ptr && v.CanAddr() {
+		pt := reflect.PtrTo(t)
+		return pt.Implements(jsonMarshalerType) || pt.Implements(textMarshalerType)
+	}
+	return false
+}
+
+// mapKeyName returns the name of the map key in its JSON encoding.
+func mapKeyName(k reflect.Value) string {
+	if k.Kind() == reflect.String {
+		return k.String()
+	}
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		if k.Kind() == reflect.Ptr && k.IsNil() {
+			return ""
+		}
+		b, _ := tm.MarshalText()
+		return string(b)
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10)
+	}
+	return ""
+}
+
+// fieldByIndex returns the field of the struct v with the index, or false if
+// it is promoted through a nil embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// A jsonField is a struct field encoded by encoding/json.
+type jsonField struct {
+	name   string
+	index  []int
+	field  reflect.StructField
+	tagged bool
+}
+
+// jsonFieldsCache caches the result of jsonFields by type.
+var jsonFieldsCache sync.Map // map[reflect.Type][]jsonField
+
+// jsonFields returns the fields of the struct type encoded by encoding/json,
+// including the promoted ones, following its rules for embedded structs and
+// conflicting names. It only maps the keys of the encoding to struct fields:
+// which keys are encoded, and how, is still decided by encoding/json.
+func jsonFields(t reflect.Type) []jsonField {
+	if f, ok := jsonFieldsCache.Load(t); ok {
+		return f.([]jsonField)
+	}
+	type embedded struct {
+		t     reflect.Type
+		index []int
+	}
+	var fields []jsonField
+	visited := map[reflect.Type]bool{}
+	for next := []embedded{{t, nil}}; len(next) > 0; {
+		current := next
+		next = nil
+		for _, e := range current {
+			if visited[e.t] {
+				continue
+			}
+			visited[e.t] = true
+			for i := 0; i < e.t.NumField(); i++ {
+				sf := e.t.Field(i)
+				ft := sf.Type
+				if ft.Name() == "" && ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if sf.Anonymous {
+					if sf.PkgPath != "" && ft.Kind() != reflect.Struct {
+						continue
+					}
+				} else if sf.PkgPath != "" {
+					continue
+				}
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name := tag
+				if i := strings.IndexByte(tag, ','); i >= 0 {
+					name = tag[:i]
+				}
+				index := append(append([]int(nil), e.index...), i)
+				if name == "" && sf.Anonymous && ft.Kind() == reflect.Struct {
+					next = append(next, embedded{ft, index})
+					continue
+				}
+				f := jsonField{name: name, index: index, field: sf, tagged: name != ""}
+				if name == "" {
+					f.name = sf.Name
+				}
+				fields = append(fields, f)
+			}
+		}
+	}
+
+	// Keep the dominant field of each name: the shallowest one, or the
+	// tagged one among the shallowest; there is none if it is ambiguous.
+	sort.SliceStable(fields, func(i, j int) bool {
+		if fields[i].name != fields[j].name {
+			return fields[i].name < fields[j].name
+		}
+		if len(fields[i].index) != len(fields[j].index) {
+			return len(fields[i].index) < len(fields[j].index)
+		}
+		return fields[i].tagged && !fields[j].tagged
+	})
+	out := fields[:0]
+	for i := 0; i < len(fields); {
+		j := i + 1
+		for j < len(fields) && fields[j].name == fields[i].name {
+			j++
+		}
+		if j == i+1 || len(fields[i+1].index) > len(fields[i].index) || fields[i+1].tagged != fields[i].tagged {
+			out = append(out, fields[i])
+		}
+		i = j
+	}
+	jsonFieldsCache.Store(t, out)
+	return out
+}
+
+// formatField formats the value of a field annotated with the format tag. It
+// returns false if the value cannot be formatted.
+func formatField(v reflect.Value, format string, lf *localeFormat) (string, bool) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", false
+		}
+		v = v.Elem()
+	}
+	if !v.CanInterface() {
+		return "", false
+	}
+	kind, arg := format, ""
+	if i := strings.IndexByte(format, ','); i >= 0 {
+		kind, arg = format[:i], format[i+1:]
+	}
+
+	switch kind {
+	case "number", "money":
+		var f float64
+		precision := 0
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			f = float64(v.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			f = float64(v.Uint())
+		case reflect.Float32, reflect.Float64:
+			f, precision = v.Float(), 2
+		default:
+			if v.Type() == moneyType && kind == "money" {
+				m := v.Interface().(Money)
+				return formatMoney(m.Amount, m.Currency, lf), true
+			}
+			return "", false
+		}
+		if kind == "money" {
+			return formatMoney(f, arg, lf), true
+		}
+		if p, err := strconv.Atoi(arg); err == nil {
+			precision = p
+		}
+		return formatNumber(f, precision, lf), true
+	case "date", "datetime":
+		if v.Type() != timeType {
+			return "", false
+		}
+		layout := lf.date
+		if kind == "datetime" {
+			layout += " " + lf.time
+		}
+		return v.Interface().(time.Time).Format(layout), true
+	}
+	return "", false
+}
+
+// objectField is a field of an orderedObject.
+type objectField struct {
+	name  string
+	value interface{}
+}
+
+// orderedObject is a JSON object preserving the order of its fields.
+type orderedObject []objectField
+
+// index returns the index of the field with the name, or -1.
+func (o orderedObject) index(name string) int {
+	for i, f := range o {
+		if f.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(f.name)
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,111 @@
+//go:build gofuzz
+// +build gofuzz
+
+package jsonrest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+)
+
+// fuzzBindBody binds the JSON body data into typical destinations, with and
+// without key case conversion, and renders the resulting errors. It returns an
+// error if an invariant is violated: decoding errors must be 400 errors, and
+// every response must be valid JSON. It is shared by the go-fuzz targets and
+// the tests of their seed corpus, which are only built with the gofuzz build
+// tag, so that they are not compiled into the package.
+func fuzzBindBody(data []byte) error {
+	type nested struct {
+		ID    int64             `json:"id"`
+		Tags  []string          `json:"tags"`
+		Attrs map[string]string `json:"attrs"`
+	}
+	dests := []func() interface{}{
+		func() interface{} { return new(interface{}) },
+		func() interface{} {
+			return new(struct {
+				Name    string   `json:"name"`
+				Count   int      `json:"count"`
+				Ratio   float64  `json:"ratio"`
+				Enabled bool     `json:"enabled"`
+				Nested  nested   `json:"nested"`
+				List    []nested `json:"list"`
+				Secret  string   `json:"secret" jsonrest:"redact"`
+			})
+		},
+	}
+	routers := []*Router{NewRouter(), NewRouter(WithRequestJSONKeyCase(SnakeCase))}
+
+	for _, router := range routers {
+		for _, dest := range dests {
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+			r := &Request{req: req, router: router, responseWriter: httptest.NewRecorder()}
+			val := dest()
+			err := r.BindBody(val)
+			if err == nil {
+				w := httptest.NewRecorder()
+				router.sendJSON(w, req, http.StatusOK, redactValue(val))
+				if w.Code == http.StatusOK && !json.Valid(w.Body.Bytes()) {
+					return fmt.Errorf("invalid JSON response for %q: %q", data, w.Body.Bytes())
+				}
+				continue
+			}
+			var httpErr *HTTPError
+			if !errors.As(err, &httpErr) || httpErr.Status != http.StatusBadRequest {
+				return fmt.Errorf("binding %q: got error %v, want a 400 HTTPError", data, err)
+			}
+			if err := checkErrorRendering(router, req, err); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fuzzRenderError renders errors built from data, a NUL-separated list of
+// code, message, details and request ID, with the default and the problem
+// JSON encoders. It returns an error if a response is not valid JSON.
+func fuzzRenderError(data []byte) error {
+	parts := bytes.Split(data, []byte{0})
+	field := func(i int) string {
+		if i < len(parts) {
+			return string(parts[i])
+		}
+		return ""
+	}
+	httpErr := Error(http.StatusBadRequest+len(data)%100, field(0), field(1))
+	for i := 2; i < len(parts)-1; i++ {
+		httpErr.Details = append(httpErr.Details, field(i))
+	}
+	errs := []error{
+		httpErr,
+		withRequestID(httpErr, field(len(parts)-1), field(len(parts)-1)).(error),
+		errors.New(string(data)),
+	}
+
+	routers := []*Router{NewRouter(WithDumpErrors()), NewRouter(WithErrorEncoder(ProblemJSONEncoder))}
+	for _, router := range routers {
+		for _, err := range errs {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if err := checkErrorRendering(router, req, err); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkErrorRendering renders err with the router and returns an error if the
+// response is not valid JSON.
+func checkErrorRendering(router *Router, req *http.Request, err error) error {
+	w := httptest.NewRecorder()
+	router.sendError(w, req, err)
+	if !json.Valid(w.Body.Bytes()) {
+		return fmt.Errorf("invalid JSON rendering of %q: %q", err, w.Body.Bytes())
+	}
+	return nil
+}
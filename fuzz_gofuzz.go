@@ -0,0 +1,21 @@
+//go:build gofuzz
+// +build gofuzz
+
+package jsonrest
+
+// FuzzBindBody is the go-fuzz target for Request.BindBody and the rendering
+// of its errors.
+func FuzzBindBody(data []byte) int {
+	if err := fuzzBindBody(data); err != nil {
+		panic(err)
+	}
+	return 0
+}
+
+// FuzzRenderError is the go-fuzz target for the rendering of errors.
+func FuzzRenderError(data []byte) int {
+	if err := fuzzRenderError(data); err != nil {
+		panic(err)
+	}
+	return 0
+}
@@ -0,0 +1,42 @@
+//go:build gofuzz
+// +build gofuzz
+
+package jsonrest
+
+import "testing"
+
+// The module supports Go versions without native fuzzing, so the seed corpus
+// of the go-fuzz targets (see fuzz_gofuzz.go) is run as a regular test, with
+// the same gofuzz build tag: go test -tags gofuzz -run Corpus .
+
+func TestFuzzBindBodyCorpus(t *testing.T) {
+	for _, seed := range []string{
+		``,
+		`{}`,
+		`{"name":"x","count":1,"ratio":0.5,"enabled":true}`,
+		`{"nested":{"id":1,"tags":["a"],"attrs":{"a":"b"}},"list":[{"id":2}]}`,
+		`{"count":"x"}`,
+		`{"fooBar":{"bazQux":[1,{"_x":null}]}}`,
+		`{"name":`,
+		`[1,2,3]`,
+		"\"\xff\"",
+		`{"secret":"s"}`,
+	} {
+		if err := fuzzBindBody([]byte(seed)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestFuzzRenderErrorCorpus(t *testing.T) {
+	for _, seed := range []string{
+		``,
+		"bad_request\x00invalid body\x00detail\x00req-1",
+		"\xff\x00\"quoted\"\x00\\\x00id",
+		"code\x00message\x00\x00\x00",
+	} {
+		if err := fuzzRenderError([]byte(seed)); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package jsonrest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// A StoredResponse is the response to a request with an idempotency key, as
+// saved by an IdempotencyStore.
+type StoredResponse struct {
+	StatusCode int
+	Header     http.Header // headers set by the endpoint
+	Body       []byte      // JSON-encoded body, nil if there was none
+}
+
+// An IdempotencyStore saves the responses to requests with an idempotency
+// key. Its methods must be safe for concurrent use.
+type IdempotencyStore interface {
+	// Reserve reserves the key for a request about to be handled. If the
+	// key was already used, it returns the saved response, or nil if the
+	// request using it is still in progress, and reserved is false.
+	Reserve(ctx context.Context, key string) (res *StoredResponse, reserved bool, err error)
+
+	// Save saves the response for the reserved key.
+	Save(ctx context.Context, key string, res StoredResponse) error
+
+	// Release releases the reserved key without saving a response, so that
+	// the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// IdempotencyOptions configures IdempotencyMiddleware.
+type IdempotencyOptions struct {
+	// Store saves the responses. It defaults to an in-memory store keeping
+	// them for 24 hours.
+	Store IdempotencyStore
+
+	// Header is the name of the request header holding the idempotency key.
+	// It defaults to "Idempotency-Key".
+	Header string
+
+	// Required indicates if requests without an idempotency key are
+	// rejected with a 400 error, instead of being handled normally.
+	Required bool
+
+	// Scope returns a string scoping the keys of the request, so that
+	// clients cannot replay each other's responses. It defaults to the
+	// principal of the request, so the middleware must run after the
+	// authentication middleware; otherwise, Scope must be set to identify
+	// the clients of authenticated APIs.
+	Scope func(*Request) string
+}
+
+var errIdempotencyConflict = Error(http.StatusConflict, "conflict", "a request with the same idempotency key is in progress")
+
+// IdempotencyMiddleware returns a middleware implementing idempotency keys for
+// POST requests: the response to a request with a key is saved, and returned
+// as-is when the request is retried with the same key, method and path, with
+// an Idempotent-Replayed header. Concurrent requests with the same key are
+// rejected with a 409 error. Responses with a 5xx status, or served directly
+// by a HandlerResponse, are not saved, so that the request can be retried.
+func IdempotencyMiddleware(opts IdempotencyOptions) Middleware {
+	if opts.Store == nil {
+		opts.Store = NewMemoryIdempotencyStore(24 * time.Hour)
+	}
+	if opts.Header == "" {
+		opts.Header = "Idempotency-Key"
+	}
+	if opts.Scope == nil {
+		opts.Scope = (*Request).Principal
+	}
+
+	return func(next Endpoint) Endpoint {
+		return func(ctx context.Context, req *Request) (result interface{}, err error) {
+			header := req.Header(opts.Header)
+			if req.Method() != http.MethodPost || header == "" {
+				if opts.Required && req.Method() == http.MethodPost {
+					return nil, BadRequest("missing " + opts.Header + " header")
+				}
+				return next(ctx, req)
+			}
+			key := opts.Scope(req) + " " + req.Method() + " " + req.URL().Path + " " + header
+
+			stored, reserved, err := opts.Store.Reserve(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+			if !reserved {
+				if stored == nil {
+					return nil, errIdempotencyConflict
+				}
+				req.SetResponseHeader("Idempotent-Replayed", "true")
+				return replayResponse(req, stored), nil
+			}
+
+			saved := false
+			defer func() {
+				if !saved {
+					opts.Store.Release(ctx, key)
+				}
+			}()
+			before := req.responseWriter.Header().Clone()
+			result, err = next(ctx, req)
+			res, ok := captureResponse(req, before, result, err)
+			if !ok {
+				return result, err
+			}
+			if saveErr := opts.Store.Save(ctx, key, res); saveErr != nil {
+				return nil, saveErr
+			}
+			saved = true
+			return result, err
+		}
+	}
+}
+
+// captureResponse returns the response to save for the result of an
+// endpoint, or false if it cannot be replayed.
+func captureResponse(req *Request, before http.Header, result interface{}, err error) (StoredResponse, bool) {
+	res := StoredResponse{StatusCode: responseStatus(result, err), Header: make(http.Header)}
+	if res.StatusCode >= 500 {
+		return res, false
+	}
+	if _, ok := result.(HandlerResponse); ok {
+		return res, false
+	}
+	for k, v := range req.responseWriter.Header() {
+		if _, ok := before[k]; !ok {
+			res.Header[k] = append([]string(nil), v...)
+		}
+	}
+
+	body := result
+	if err != nil {
+		body = translateError(err, false)
+	} else {
+		if r, ok := result.(Response); ok {
+			body = r.Body
+		}
+		body = replayableBody(req, body)
+	}
+	if body == nil {
+		return res, true
+	}
+	b, marshalErr := json.Marshal(body)
+	if marshalErr != nil {
+		return res, false
+	}
+	res.Body = b
+	return res, true
+}
+
+// replayableBody returns the body with the localized formatting and the
+// redaction of the request's router applied, as they are by the send chain:
+// the saved response is replayed as JSON, which they do not apply to. The
+// other transforms of the send chain, e.g. the key case, apply to the replayed
+// JSON as well.
+func replayableBody(req *Request, body interface{}) interface{} {
+	switch {
+	case req.router == nil:
+		return body
+	case req.router.localizedFormatting:
+		return localizeValue(body, lookupLocaleFormat(req.Locale()), req.router.redaction)
+	case req.router.redaction:
+		return redactValue(body)
+	}
+	return body
+}
+
+// replayResponse returns the result replaying the saved response.
+func replayResponse(req *Request, res *StoredResponse) Response {
+	h := req.responseWriter.Header()
+	for k, v := range res.Header {
+		h[k] = append([]string(nil), v...)
+	}
+	replay := Response{StatusCode: res.StatusCode}
+	if res.Body != nil {
+		replay.Body = json.RawMessage(res.Body)
+	}
+	return replay
+}
+
+// memoryIdempotencyStore is an in-memory IdempotencyStore.
+type memoryIdempotencyStore struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+	sweepAt time.Time // next removal of the expired entries
+}
+
+type idempotencyEntry struct {
+	res     *StoredResponse // nil while in progress
+	expires time.Time
+}
+
+// NewMemoryIdempotencyStore returns an IdempotencyStore keeping the responses
+// in memory for the ttl. It is meant for single-instance services and tests;
+// replicated services need a shared store, e.g. backed by a database.
+func NewMemoryIdempotencyStore(ttl time.Duration) IdempotencyStore {
+	return &memoryIdempotencyStore{ttl: ttl, entries: make(map[string]*idempotencyEntry)}
+}
+
+// Reserve implements the IdempotencyStore interface.
+func (s *memoryIdempotencyStore) Reserve(ctx context.Context, key string) (*StoredResponse, bool, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.After(s.sweepAt) {
+		for k, e := range s.entries {
+			if e.res != nil && now.After(e.expires) {
+				delete(s.entries, k)
+			}
+		}
+		s.sweepAt = now.Add(time.Minute)
+	}
+	if e, ok := s.entries[key]; ok && (e.res == nil || now.Before(e.expires)) {
+		return e.res, false, nil
+	}
+	s.entries[key] = &idempotencyEntry{}
+	return nil, true, nil
+}
+
+// Save implements the IdempotencyStore interface.
+func (s *memoryIdempotencyStore) Save(ctx context.Context, key string, res StoredResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = &idempotencyEntry{res: &res, expires: time.Now().Add(s.ttl)}
+	return nil
+}
+
+// Release implements the IdempotencyStore interface.
+func (s *memoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build go1.19
+// +build go1.19
+
+package jsonrest
+
+// informationalResponses indicates if 1xx informational responses can be
+// written with http.ResponseWriter.WriteHeader.
+const informationalResponses = true
@@ -0,0 +1,88 @@
+package jsonrest
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// An ItemRange is a range of items of a collection requested with the
+// "Range: items=0-49" header. First and Last are zero-based and inclusive.
+type ItemRange struct {
+	First, Last int
+}
+
+// ContentRange declares the range of items returned by a collection endpoint,
+// see Response.Range. First and Last are zero-based and inclusive, and Total
+// is the number of items of the collection, or -1 if it is unknown.
+type ContentRange struct {
+	First, Last int
+	Total       int
+}
+
+// errRangeNotSatisfiable is returned for malformed or out of bounds item
+// ranges.
+var errRangeNotSatisfiable = Error(http.StatusRequestedRangeNotSatisfiable, "range_not_satisfiable", "the requested range cannot be satisfied")
+
+// ItemRange parses the "Range: items=first-last" header of the request, and
+// reports whether there is one. The range is capped to max items if max is
+// positive, and an open range such as "items=50-" spans max items. Ranges of
+// other units are ignored, and a malformed range is answered with a 416 error.
+func (r *Request) ItemRange(max int) (ItemRange, bool, error) {
+	header := r.req.Header.Get("Range")
+	if !strings.HasPrefix(header, "items=") {
+		return ItemRange{}, false, nil
+	}
+	spec := strings.TrimSpace(header[len("items="):])
+	i := strings.IndexByte(spec, '-')
+	if i < 0 {
+		return ItemRange{}, false, errRangeNotSatisfiable
+	}
+	first, err := strconv.Atoi(spec[:i])
+	if err != nil || first < 0 {
+		return ItemRange{}, false, errRangeNotSatisfiable
+	}
+	last := first + max - 1
+	if spec[i+1:] != "" {
+		if last, err = strconv.Atoi(spec[i+1:]); err != nil || last < first {
+			return ItemRange{}, false, errRangeNotSatisfiable
+		}
+	} else if max <= 0 {
+		return ItemRange{}, false, errRangeNotSatisfiable
+	}
+	if max > 0 && last-first+1 > max {
+		last = first + max - 1
+	}
+	return ItemRange{First: first, Last: last}, true, nil
+}
+
+// applyContentRange sets the Content-Range and Accept-Ranges headers of the
+// response from the range declared by res, and returns res with a 206 status
+// if the range is partial. It returns a 416 error if the range starts past
+// the end of the collection.
+func applyContentRange(h http.Header, res Response) (Response, error) {
+	cr := res.Range
+	total := "*"
+	if cr.Total >= 0 {
+		total = strconv.Itoa(cr.Total)
+	}
+	h.Set("Accept-Ranges", "items")
+	if cr.Total >= 0 && cr.First >= cr.Total && cr.Total > 0 {
+		h.Set("Content-Range", "items */"+total)
+		return res, errRangeNotSatisfiable
+	}
+	if cr.Last < cr.First {
+		// No items were returned.
+		h.Set("Content-Range", "items */"+total)
+	} else {
+		h.Set("Content-Range", fmt.Sprintf("items %d-%d/%s", cr.First, cr.Last, total))
+	}
+	if res.StatusCode == 0 {
+		res.StatusCode = http.StatusOK
+		if cr.Total < 0 || cr.First > 0 || cr.Last+1 < cr.Total {
+			res.StatusCode = http.StatusPartialContent
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,123 @@
+package jsonrest
+
+import (
+	"context"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// A JobResult describes a background job started with Request.Go, once it
+// returns.
+type JobResult struct {
+	Method string
+	Route  string
+
+	// Duration is how long the job ran.
+	Duration time.Duration
+
+	// Panic is the value the job panicked with, if any, and Stack the stack
+	// trace of the panic.
+	Panic interface{}
+	Stack []byte
+}
+
+// WithJobObserver is an Option available for NewRouter to call fn when each
+// background job started with Request.Go returns, e.g. for metrics.
+func WithJobObserver(fn func(ctx context.Context, job JobResult)) Option {
+	return func(r *Router) {
+		r.jobObserver = fn
+	}
+}
+
+// jobGroup tracks the background jobs of a router.
+type jobGroup struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	closed bool
+}
+
+func newJobGroup() *jobGroup {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &jobGroup{ctx: ctx, cancel: cancel}
+}
+
+// Go runs fn in a new goroutine after the response is sent, instead of an
+// ad-hoc goroutine started by the endpoint, e.g. to send a notification. The
+// context of fn keeps the values of the request's context, but is only
+// canceled when the router shuts down, and the Request it holds is a copy. A
+// panic in fn is recovered and logged.
+func (r *Request) Go(fn func(ctx context.Context)) {
+	r.jobs = append(r.jobs, fn)
+}
+
+// startJobs starts the background jobs of the request.
+func (r *Router) startJobs(req *Request) {
+	g := r.root().jobs
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		log.Printf("jsonrest: router shut down, dropping %d background jobs of %v", len(req.jobs), req.req.RequestURI)
+		return
+	}
+	ctx := jobContext{Context: g.ctx, values: req.detached().req.Context()}
+	for _, fn := range req.jobs {
+		g.wg.Add(1)
+		go r.runJob(ctx, req.routeInfo, fn)
+	}
+}
+
+// runJob runs a background job and reports it to the job observer.
+func (r *Router) runJob(ctx context.Context, route *Route, fn func(context.Context)) {
+	root := r.root()
+	defer root.jobs.wg.Done()
+	res := JobResult{Method: route.Method, Route: route.Path}
+	start := time.Now()
+	defer func() {
+		if p := recover(); p != nil {
+			res.Panic, res.Stack = p, debug.Stack()
+			log.Printf("panic in background job of %v %v: %+v\n%s", route.Method, route.Path, p, res.Stack)
+		}
+		res.Duration = time.Since(start)
+		if root.jobObserver != nil {
+			root.jobObserver(ctx, res)
+		}
+	}()
+	fn(ctx)
+}
+
+// Shutdown stops accepting background jobs and waits for the running ones to
+// return, or for ctx to be done, in which case their context is canceled and
+// the context's error is returned. It is meant to be called after the server
+// itself is shut down, e.g. with http.Server.Shutdown.
+func (r *Router) Shutdown(ctx context.Context) error {
+	g := r.root().jobs
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	defer g.cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// jobContext is the context of a background job: it is canceled with the
+// router's jobs, and holds the values of the request's context.
+type jobContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c jobContext) Value(key interface{}) interface{} { return c.values.Value(key) }
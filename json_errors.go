@@ -1,29 +1,152 @@
 package jsonrest
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"strings"
 	"time"
 )
 
+// An UnmarshalFieldError describes a value of the JSON request body whose
+// type does not match its destination. See WithUnmarshalErrorMessage.
+type UnmarshalFieldError struct {
+	// Path is the path of the value in the body, e.g. "items[2].qty", or an
+	// empty string for the body itself.
+	Path string
+
+	// Expected is the JSON type expected at the path, e.g. "integer", or an
+	// empty string if it is unknown.
+	Expected string
+
+	// Value is the JSON type of the value, e.g. "string".
+	Value string
+}
+
+// Error implements the error interface, describing the mismatch in terms that
+// are safe to return to the caller, e.g. "expected integer at items[2].qty".
+func (e *UnmarshalFieldError) Error() string {
+	msg := "unexpected " + e.Value
+	if e.Expected != "" {
+		msg = "expected " + e.Expected
+	}
+	if e.Path != "" {
+		msg += " at " + e.Path
+	}
+	return msg
+}
+
+// WithUnmarshalErrorMessage is an Option available for NewRouter and Group to
+// customize the message of the 400 errors returned by BindBody and Bind when a
+// value of the body has an unexpected type, e.g. to localize it. By default,
+// the message is "malformed or unexpected json: " followed by the description
+// of the error, e.g. "expected integer at items[2].qty".
+func WithUnmarshalErrorMessage(fn func(ctx context.Context, err *UnmarshalFieldError) string) Option {
+	return func(r *Router) {
+		r.unmarshalErrorMessage = fn
+	}
+}
+
+// newUnmarshalFieldError returns the UnmarshalFieldError describing err, an
+// error unmarshaling data.
+func newUnmarshalFieldError(err *json.UnmarshalTypeError, data []byte) *UnmarshalFieldError {
+	value := err.Value
+	if i := strings.IndexByte(value, ' '); i >= 0 {
+		value = value[:i] // e.g. "number 1.5"
+	}
+	if value == "bool" {
+		value = "boolean"
+	}
+	return &UnmarshalFieldError{
+		Path:     jsonPath(data, err.Offset),
+		Expected: jsonType(err.Type),
+		Value:    value,
+	}
+}
+
 // jsonErrorDetails returns a "safe" error message indicating the cause of the
-// JSON unmarshal error in terms that are safe to return to the caller.
-func jsonErrorDetails(err error) string {
+// error unmarshaling data, in terms that are safe to return to the caller.
+func jsonErrorDetails(err error, data []byte) string {
 	switch err := err.(type) {
 	case *json.SyntaxError:
 		return fmt.Sprintf("offset %d: %s", err.Offset, err.Error())
 	case *json.UnmarshalTypeError:
-		var typeSuffix string
-		if t := jsonType(err.Type); t != "" {
-			typeSuffix = " (expected " + t + ")"
-		}
-		return fmt.Sprintf("offset %d: cannot unmarshal %s to %q%s", err.Offset, err.Value, err.Field, typeSuffix)
+		return newUnmarshalFieldError(err, data).Error()
 	default:
 		return ""
 	}
 }
 
+// jsonFrame is an object or array being scanned by jsonPath.
+type jsonFrame struct {
+	array bool
+	index int
+	key   string
+}
+
+// jsonPath returns the path of the value of data ending at the offset, e.g.
+// "items[2].qty", with the syntax of JavaScript accessors.
+func jsonPath(data []byte, offset int64) string {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	data = bytes.TrimRight(data[:offset], " \t\r\n")
+	if n := len(data); n > 0 && (data[n-1] == '{' || data[n-1] == '[') {
+		// The mismatched value is an object or an array being opened.
+		data = data[:n-1]
+	}
+
+	var stack []jsonFrame
+	expectKey := false
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case '{':
+			stack = append(stack, jsonFrame{})
+			expectKey = true
+		case '[':
+			stack = append(stack, jsonFrame{array: true})
+		case '}', ']':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case ',':
+			if n := len(stack); n > 0 && stack[n-1].array {
+				stack[n-1].index++
+			} else {
+				expectKey = true
+			}
+		case '"':
+			start := i
+			for i++; i < len(data) && data[i] != '"'; i++ {
+				if data[i] == '\\' {
+					i++
+				}
+			}
+			if n := len(stack); expectKey && n > 0 && i < len(data) {
+				var key string
+				json.Unmarshal(data[start:i+1], &key)
+				stack[n-1].key = key
+				expectKey = false
+			}
+		}
+	}
+
+	var path strings.Builder
+	for _, f := range stack {
+		if f.array {
+			fmt.Fprintf(&path, "[%d]", f.index)
+			continue
+		}
+		if path.Len() > 0 {
+			path.WriteByte('.')
+		}
+		path.WriteString(f.key)
+	}
+	return path.String()
+}
+
 // jsonType attempts to map the given Go type to its equivalent JSON type. Note
 // that this mapping is incomplete for custom types, since it's impossible to
 // know what a custom UnmarshalJSON implementation may be doing.
@@ -17,6 +17,10 @@ func TestJSONErrorDetails(t *testing.T) {
 		Nested  struct {
 			Count int `json:"count"`
 		} `json:"nested"`
+		Items []struct {
+			Name string `json:"name"`
+			Qty  int    `json:"qty"`
+		} `json:"items"`
 	}
 	tests := []struct {
 		json string
@@ -28,19 +32,43 @@ func TestJSONErrorDetails(t *testing.T) {
 		},
 		{
 			json: `{"count": "abc"}`,
-			err:  `offset 15: cannot unmarshal string to "count" (expected integer)`,
+			err:  `expected integer at count`,
 		},
 		{
 			json: `{"name": 1}`,
-			err:  `offset 10: cannot unmarshal number to "name" (expected string)`,
+			err:  `expected string at name`,
 		},
 		{
 			json: `{"name": false}`,
-			err:  `offset 14: cannot unmarshal bool to "name" (expected string)`,
+			err:  `expected string at name`,
 		},
 		{
 			json: `{"nested": {"count": "abc"}}`,
-			err:  `offset 26: cannot unmarshal string to "nested.count" (expected integer)`,
+			err:  `expected integer at nested.count`,
+		},
+		{
+			json: `{"values": ["a", 2]}`,
+			err:  `expected string at values[1]`,
+		},
+		{
+			json: `{"items": [{"qty": 1}, {"qty": 2}, {"qty": "x", "name": "a,b"}]}`,
+			err:  `expected integer at items[2].qty`,
+		},
+		{
+			json: `{"items": [{"name": "\\\"[,{", "qty": 1.5}]}`,
+			err:  `expected integer at items[0].qty`,
+		},
+		{
+			json: `{"name": {"a": 1}}`,
+			err:  `expected string at name`,
+		},
+		{
+			json: `{"enabled": "true"}`,
+			err:  `expected boolean at enabled`,
+		},
+		{
+			json: `[1]`,
+			err:  `expected object`,
 		},
 	}
 	for i, tt := range tests {
@@ -50,7 +78,7 @@ func TestJSONErrorDetails(t *testing.T) {
 				t.Fatal("unexpected nil error")
 			}
 
-			got := jsonErrorDetails(err)
+			got := jsonErrorDetails(err, []byte(tt.json))
 			if got != tt.err {
 				t.Errorf("incorrect error:\ngot:  %s\nwant: %s", got, tt.err)
 			}
@@ -1,19 +1,22 @@
 package jsonrest
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"mime/multipart"
 	"net/http"
 	"net/url"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"sync"
-
-	"github.com/NYTimes/gziphandler"
-	"github.com/julienschmidt/httprouter"
+	"sync/atomic"
+	"time"
 )
 
 const (
@@ -22,12 +25,29 @@ const (
 )
 
 // A Request represents a RESTful HTTP request received by the server.
+//
+// A Request must not be retained after its endpoint returns, as it may be
+// reused for another request when WithRequestPooling is enabled.
 type Request struct {
-	meta           sync.Map
-	params         httprouter.Params
+	metaMu         sync.RWMutex
+	meta           map[interface{}]interface{} // allocated on the first Set
+	events         []Event
+	eventsMu       sync.Mutex
+	params         Params
 	req            *http.Request
 	responseWriter http.ResponseWriter
 	route          string
+	routeInfo      *Route
+	pageLimits     paginationLimits
+	captureError   bool
+	links          Links
+	router         *Router
+	hijacked       bool
+	jobs           []func(context.Context)
+
+	// scopesChecked indicates that the scopes of the route were checked by
+	// ScopeMiddleware or OIDCProvider.Middleware.
+	scopesChecked bool
 }
 
 // BasicAuth returns the username and password, if the request uses HTTP Basic
@@ -38,10 +58,30 @@ func (r *Request) BasicAuth() (username, password string, ok bool) {
 
 // BindBody unmarshals the request body into the given value.
 func (r *Request) BindBody(val interface{}) error {
+	if r.router != nil && r.router.requestKeyCase != 0 {
+		if err := convertRequestKeys(r.req, r.router.requestKeyCase); err != nil {
+			if httpErr, ok := err.(*HTTPError); ok {
+				return httpErr
+			}
+			return BadRequest("cannot read request body").Wrap(err)
+		}
+	}
 	defer r.req.Body.Close()
-	if err := json.NewDecoder(r.req.Body).Decode(val); err != nil {
+	data, err := ioutil.ReadAll(r.req.Body)
+	if err != nil {
+		if httpErr, ok := err.(*HTTPError); ok {
+			// The body could not be read, e.g. decompressed.
+			return httpErr
+		}
+		return BadRequest("cannot read request body").Wrap(err)
+	}
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(val); err != nil {
+		if typeErr, ok := err.(*json.UnmarshalTypeError); ok && r.router != nil && r.router.unmarshalErrorMessage != nil {
+			msg := r.router.unmarshalErrorMessage(r.req.Context(), newUnmarshalFieldError(typeErr, data))
+			return BadRequest(msg).Wrap(err)
+		}
 		msg := "malformed or unexpected json"
-		if details := jsonErrorDetails(err); details != "" {
+		if details := jsonErrorDetails(err, data); details != "" {
 			msg += ": " + details
 		}
 		return BadRequest(msg).Wrap(err)
@@ -57,9 +97,45 @@ func (r *Request) FormFile(name string, maxMultipartMemory int64) (multipart.Fil
 	return r.req.FormFile(name)
 }
 
-// Get returns the meta value for the key.
+// Get returns the meta value for the key. If the key was not set, the value
+// of the request's context for the key is returned.
 func (r *Request) Get(key interface{}) interface{} {
-	val, _ := r.meta.Load(key)
+	val, _ := r.Lookup(key)
+	return val
+}
+
+// Lookup returns the meta value for the key, like Get, and whether it was
+// found.
+func (r *Request) Lookup(key interface{}) (interface{}, bool) {
+	r.metaMu.RLock()
+	val, ok := r.meta[key]
+	r.metaMu.RUnlock()
+	if ok {
+		return val, true
+	}
+	if r.req == nil {
+		return nil, false
+	}
+	val = r.req.Context().Value(key)
+	return val, val != nil
+}
+
+// GetString returns the meta value for the key if it is a string, or an empty
+// string.
+func (r *Request) GetString(key interface{}) string {
+	val, _ := r.Get(key).(string)
+	return val
+}
+
+// GetInt returns the meta value for the key if it is an int, or 0.
+func (r *Request) GetInt(key interface{}) int {
+	val, _ := r.Get(key).(int)
+	return val
+}
+
+// GetBool returns the meta value for the key if it is a bool, or false.
+func (r *Request) GetBool(key interface{}) bool {
+	val, _ := r.Get(key).(bool)
 	return val
 }
 
@@ -83,6 +159,31 @@ func (r *Request) Raw() *http.Request {
 	return r.req
 }
 
+// CatchAll returns the value of the route's catch-all parameter, e.g. the
+// value of filepath for the route /files/*filepath. Like Param, the value
+// starts with a slash.
+func (r *Request) CatchAll() string {
+	i := strings.LastIndex(r.route, "/*")
+	if i < 0 {
+		return ""
+	}
+	return r.params.ByName(r.route[i+2:])
+}
+
+// StrippedPrefix returns the part of the request path matched before the
+// route's catch-all parameter, e.g. "/files" for the request /files/a/b.txt
+// and the route /files/*filepath. The request URL is left untouched.
+func (r *Request) StrippedPrefix() string {
+	return strings.TrimSuffix(r.req.URL.Path, r.RemainingPath())
+}
+
+// RemainingPath returns the part of the request path matched by the route's
+// catch-all parameter, e.g. "/a/b.txt" for the request /files/a/b.txt and the
+// route /files/*filepath. It is the same as CatchAll.
+func (r *Request) RemainingPath() string {
+	return r.CatchAll()
+}
+
 // Route returns the route pattern.
 func (r *Request) Route() string {
 	return r.route
@@ -100,7 +201,12 @@ func (r *Request) SetResponseHeader(key, val string) {
 
 // Set sets a meta value for the key.
 func (r *Request) Set(key, val interface{}) {
-	r.meta.Store(key, val)
+	r.metaMu.Lock()
+	defer r.metaMu.Unlock()
+	if r.meta == nil {
+		r.meta = make(map[interface{}]interface{})
+	}
+	r.meta[key] = val
 }
 
 // URL returns the URI being requested from the server.
@@ -113,6 +219,27 @@ func (r *Request) URL() *url.URL {
 type Response struct {
 	Body       interface{}
 	StatusCode int
+
+	// Range, if set, declares the range of items of a collection returned in
+	// the body, e.g. as requested by Request.ItemRange. The Content-Range
+	// header is set from it, and the status code defaults to 206 Partial
+	// Content if the range does not span the whole collection, or to 200.
+	Range *ContentRange
+}
+
+// HandlerResponse is a type that can be returned by the endpoint to write the
+// response itself with an http.Handler, e.g. to serve a file or stream
+// events. Other results implementing http.Handler are rendered as JSON like
+// any other value, so that an endpoint cannot hand over the response by
+// accident.
+type HandlerResponse struct {
+	http.Handler
+}
+
+// ServeHandler returns a result of the endpoint which calls h to write the
+// response.
+func ServeHandler(h http.Handler) HandlerResponse {
+	return HandlerResponse{h}
 }
 
 // M is a shorthand for map[string]interface{}. Responses from the server may be
@@ -120,6 +247,10 @@ type Response struct {
 type M map[string]interface{}
 
 // An Endpoint is an implementation of a RESTful endpoint.
+//
+// The result is rendered to the client as JSON, unless it is a
+// HandlerResponse, in which case its handler is called to write the response
+// itself (e.g. to serve a file).
 type Endpoint func(ctx context.Context, r *Request) (interface{}, error)
 
 // Middleware is a function that wraps an endpoint to add new behaviour.
@@ -143,38 +274,397 @@ type Middleware func(Endpoint) Endpoint
 // endpoints.
 type Router struct {
 	// DumpErrors indicates if internal errors should be displayed in the
-	// response; useful for local debugging.
+	// response; useful for local debugging. Prefer WithDumpErrors, which is
+	// inherited by groups and safe to use while serving requests.
 	DumpErrors bool
 
+	// middlewareVersion is incremented when middleware is added to the root,
+	// its groups or its composite, to recompose the cached chains.
+	middlewareVersion uint32
+
+	// requestPooling indicates if Request values are reused.
+	requestPooling bool
+
+	// bodyDrainLimit is the maximum number of bytes of an unread request body
+	// drained after the endpoint returns.
+	bodyDrainLimit int64
+
+	// maxDecompressedSize, if positive, is the maximum size of decompressed
+	// request bodies.
+	maxDecompressedSize int64
+
+	// baseContext and contextHooks derive the context of each request before
+	// the middleware is called.
+	baseContext  func(*http.Request) context.Context
+	contextHooks []func(context.Context, *Request) context.Context
+
+	// collectErrors indicates if registration errors are recorded in
+	// registrationErrors instead of panicking.
+	collectErrors      bool
+	registrationErrors RouteErrors
+
+	// maxPathLength and maxQueryLength are the maximum lengths of the request
+	// path and query string.
+	maxPathLength, maxQueryLength int
+
+	// errorBudget, if set, configures the tracking of the routes' error
+	// rates.
+	errorBudget *ErrorBudget
+
+	// locales are the supported locales, the first one being the default.
+	locales []string
+
+	// errorLocalizer, if set, translates the messages of the errors.
+	errorLocalizer ErrorLocalizer
+
+	// debugAccess, if set, allows the requests to the debug endpoints.
+	debugAccess RequestPredicate
+
+	// cachePolicy, if set, is the default cache policy of the routes.
+	cachePolicy *CachePolicy
+
+	// mockResponses indicates if the routes with an example response or a
+	// response schema serve example responses.
+	mockResponses bool
+
+	// validateResponses and strictResponses tell if responses are validated
+	// against the schema of their route, and if mismatches fail them.
+	validateResponses bool
+	strictResponses   bool
+
+	// cookieDefaults, if set, are the default attributes of the cookies.
+	cookieDefaults *CookieDefaults
+
+	// localizedFormatting indicates if annotated response fields are
+	// formatted for the locale of the request.
+	localizedFormatting bool
+
+	// redaction indicates if the redacted fields of responses are masked or
+	// omitted.
+	redaction bool
+
+	// logLevels, if set, are the log levels of requests.
+	logLevels *LogLevels
+
+	// linkMode tells where the links of responses are rendered.
+	linkMode LinkMode
+
+	// fieldsParam is the name of the query parameter listing the fields of
+	// sparse fieldsets, if enabled.
+	fieldsParam string
+
+	// pageLimits are the default and maximum page sizes of
+	// Request.Pagination.
+	pageLimits paginationLimits
+
+	// postEncodeHooks are called with the encoded response body before it is
+	// written.
+	postEncodeHooks []PostEncodeHook
+
+	// encodeErrorHooks are called with the errors encoding or writing
+	// responses.
+	encodeErrorHooks []EncodeErrorHook
+
+	// serverTiming indicates if request events are reported in the
+	// Server-Timing response header.
+	serverTiming bool
+
+	// requestIDField is the name of the error field holding the request ID.
+	requestIDField string
+
+	// dumpErrors, if set, reports whether internal errors should be displayed
+	// in the response to the request.
+	dumpErrors func(*http.Request) bool
+
 	// option to control JSON pretty formatting which can have performance impact
 	disableJSONIndent bool
 
-	// option to enable/disable gzip compression
+	// option to enable/disable compression
 	enableCompression bool
 
-	// gzipHandler is a handler that wraps the router and compresses responses
-	gzipHandler func(http.Handler) http.Handler
+	// compression configures the compression of responses
+	compression CompressionOptions
 
 	// notFound is a configurable http.Handler which is called when no matching
 	// route is found. If it is not set, notFoundHandler is used.
 	notFound http.Handler
 
-	router     *httprouter.Router
-	middleware []Middleware
-	options    []Option
-	parent     *Router
+	// groupNotFound lists the not found handlers of the groups with a path
+	// prefix, which are called for unmatched requests under that prefix.
+	groupNotFound []prefixHandler
+
+	// cors, if set, are the CORS options of the router, and corsPolicies
+	// those of the root router and its groups by path prefix.
+	cors         *CORSOptions
+	corsPolicies []prefixCORS
+
+	// prefix is prepended to the path of the routes registered with the
+	// router.
+	prefix string
+
+	// errorEncoder, if set, writes error responses instead of sendJSON.
+	errorEncoder ErrorEncoder
+
+	// spaRoot, if set, holds a single-page application served for unmatched
+	// requests outside of spaAPIPrefixes.
+	spaRoot        http.FileSystem
+	spaAPIPrefixes []string
+
+	// sloClass is the default SLO class of the routes registered with the
+	// router, and sloPolicies the policies of each class.
+	sloClass    string
+	sloPolicies map[string]*sloPolicy
+
+	// caseInsensitive indicates if the static parts of route paths should be
+	// matched case-insensitively.
+	caseInsensitive bool
+
+	// Behaviour of the matcher when no route matches; see MatcherConfig.
+	redirectTrailingSlash  bool
+	redirectFixedPath      bool
+	handleMethodNotAllowed bool
+
+	// newMatcher creates the routing backend. If it is not set,
+	// newHTTPRouterMatcher is used.
+	newMatcher NewMatcherFunc
+
+	// warmups are run once before the router serves its first request.
+	warmups  []func(context.Context) error
+	warmupMu sync.Mutex
+	warmedUp int32 // accessed atomically
+
+	// warmupFailedAt is the time of the last failed lazy warm-up, guarded by
+	// warmupMu.
+	warmupFailedAt time.Time
+
+	// warmupTimeout, if set, bounds the duration of the warm-up hooks.
+	warmupTimeout time.Duration
+
+	// readinessPath, if set, is the path of the readiness probe, and
+	// warmingUp is set while the probe runs the warm-up hooks.
+	readinessPath string
+	warmingUp     int32 // accessed atomically
+
+	matcher     Matcher
+	routesMu    sync.RWMutex // guards routes and namedRoutes
+	routes      []*Route
+	namedRoutes map[string]*Route
+	middleware  []Middleware
+	options     []Option
+	parent      *Router
+
+	// middlewareNames holds the name of each middleware.
+	middlewareNames []string
+
+	// responseHooks are called after the responses are written.
+	responseHooks []ResponseHook
+
+	// jobs tracks the background jobs started with Request.Go, and
+	// jobObserver is called when they return.
+	jobs        *jobGroup
+	jobObserver func(context.Context, JobResult)
+
+	// responseKeyCase and requestKeyCase, if set, are the key cases the
+	// response and request bodies are converted to.
+	responseKeyCase KeyCase
+	requestKeyCase  KeyCase
+
+	// serveMuxPatterns indicates if route paths use the net/http.ServeMux
+	// syntax.
+	serveMuxPatterns bool
+
+	// tenantResolver, if set, resolves the tenant of the requests.
+	tenantResolver TenantResolver
+
+	// deprecationHook, if set, is called for the requests to deprecated
+	// routes.
+	deprecationHook func(context.Context, *Request)
+
+	// interceptors transform the results of the endpoints.
+	interceptors []ResponseInterceptor
+
+	// limiter, if set, bounds the number of concurrent requests.
+	limiter *concurrencyLimiter
+
+	// slowRequestFunc, if set, is called for the requests running for longer
+	// than slowThreshold.
+	slowThreshold   time.Duration
+	slowRequestFunc func(context.Context, SlowRequest)
+
+	// unmarshalErrorMessage, if set, formats the messages of the errors
+	// unmarshaling request bodies.
+	unmarshalErrorMessage func(context.Context, *UnmarshalFieldError) string
+
+	// readTimeout and writeTimeout are the default body read and response
+	// write timeouts of the routes, if not zero.
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+
+	// clientDeadlineMax caps the timeouts requested by the clients, if
+	// WithClientDeadlines is used.
+	clientDeadlineMax time.Duration
+
+	// composite, if set, is the composite the router is part of.
+	composite *Composite
 }
 
 type Option func(*Router)
 
 // WithNotFoundHandler is an Option available for NewRouter to configure the
-// not found handler.
+// not found handler. When passed to Group along with WithPathPrefix, it is
+// called for unmatched requests under the group's prefix.
 func WithNotFoundHandler(h http.Handler) Option {
 	return func(r *Router) {
 		r.notFound = h
 	}
 }
 
+// WithPathPrefix is an Option available for NewRouter and Group to prepend a
+// prefix, such as "/api/v2", to the path of the routes registered with the
+// router. The prefixes of nested groups are concatenated.
+func WithPathPrefix(prefix string) Option {
+	return func(r *Router) {
+		r.prefix += prefix
+	}
+}
+
+// WithDumpErrors is an Option available for NewRouter and Group to display
+// internal errors in the response; useful for local debugging.
+func WithDumpErrors() Option {
+	return WithDumpErrorsFunc(func(*http.Request) bool { return true })
+}
+
+// WithDumpErrorsFunc is an Option available for NewRouter and Group to display
+// internal errors in the response to the requests for which fn returns true,
+// e.g. requests from internal IPs or with a debug header.
+func WithDumpErrorsFunc(fn func(req *http.Request) bool) Option {
+	return func(r *Router) {
+		r.dumpErrors = fn
+	}
+}
+
+// WithBaseContext is an Option available for NewRouter and Group to set the
+// context of each request before the route's middleware is called, similar to
+// http.Server.BaseContext. The returned context should be derived from
+// req.Context(), so that it is canceled with the request.
+func WithBaseContext(fn func(req *http.Request) context.Context) Option {
+	return func(r *Router) {
+		r.baseContext = fn
+	}
+}
+
+// WithContextHook is an Option available for NewRouter and Group to derive the
+// context of each request from the parsed request, e.g. to attach a logger
+// labeled with the route. Hooks are called in order, after the base context is
+// set and before the route's middleware is called.
+func WithContextHook(fn func(ctx context.Context, req *Request) context.Context) Option {
+	return func(r *Router) {
+		r.contextHooks = append(r.contextHooks, fn)
+	}
+}
+
+// A PostEncodeHook is called with the JSON-encoded response body before it is
+// written, e.g. to set response headers derived from it.
+type PostEncodeHook func(h http.Header, status int, body []byte)
+
+// WithPostEncodeHook is an Option available for NewRouter and Group to
+// register a hook called with each encoded response body. Hooks are not called
+// for responses streamed with StreamResponse.
+func WithPostEncodeHook(hook PostEncodeHook) Option {
+	return func(r *Router) {
+		r.postEncodeHooks = append(r.postEncodeHooks, hook)
+	}
+}
+
+// A ResponseInterceptor transforms the result of an endpoint before it is
+// encoded, or returns an error sent instead. The result is passed as returned
+// by the endpoint, e.g. as a Response or a HandlerResponse.
+type ResponseInterceptor func(ctx context.Context, req *Request, result interface{}) (interface{}, error)
+
+// WithResponseInterceptor is an Option available for NewRouter and Group to
+// transform the successful results of the endpoints in one place, e.g. to wrap
+// them in an envelope or downgrade them to an older API version. Interceptors
+// are called in order, after the middleware, and not for endpoint errors.
+func WithResponseInterceptor(intercept ResponseInterceptor) Option {
+	return func(r *Router) {
+		r.interceptors = append(r.interceptors, intercept)
+	}
+}
+
+// An EncodeErrorHook is called when a response cannot be encoded, e.g. because
+// it contains an unsupported value, or written, e.g. because the client
+// disconnected.
+type EncodeErrorHook func(req *http.Request, err error)
+
+// WithEncodeErrorHook is an Option available for NewRouter and Group to
+// register a hook called with the errors encoding or writing responses. The
+// errors are also logged, and an unknown error is sent to the client if the
+// response status was not written yet.
+func WithEncodeErrorHook(hook EncodeErrorHook) Option {
+	return func(r *Router) {
+		r.encodeErrorHooks = append(r.encodeErrorHooks, hook)
+	}
+}
+
+// WithBodyDrainLimit is an Option available for NewRouter to configure the
+// maximum number of bytes of a request body which is read and discarded when
+// the endpoint did not consume it, so that the connection can be reused. Larger
+// bodies are left unread and the connection is closed. A limit of 0 disables
+// draining. The default is 256KB.
+func WithBodyDrainLimit(n int64) Option {
+	return func(r *Router) {
+		r.bodyDrainLimit = n
+	}
+}
+
+// WithErrorEncoder is an Option available for NewRouter and Group to configure
+// how errors returned by endpoints are written to the response, e.g. using
+// ProblemJSONEncoder.
+func WithErrorEncoder(enc ErrorEncoder) Option {
+	return func(r *Router) {
+		r.errorEncoder = enc
+	}
+}
+
+// WithRedirectTrailingSlash is an Option available for NewRouter to configure
+// whether requests are redirected to the route with (or without) a trailing
+// slash when only that route exists. It is enabled by default and applies to
+// the whole router.
+func WithRedirectTrailingSlash(enabled bool) Option {
+	return func(r *Router) {
+		r.redirectTrailingSlash = enabled
+	}
+}
+
+// WithRedirectFixedPath is an Option available for NewRouter to configure
+// whether requests are redirected to a cleaned, case-insensitive match of the
+// request path when no route matches exactly. It is enabled by default and
+// applies to the whole router.
+func WithRedirectFixedPath(enabled bool) Option {
+	return func(r *Router) {
+		r.redirectFixedPath = enabled
+	}
+}
+
+// WithHandleMethodNotAllowed is an Option available for NewRouter to configure
+// whether a 405 Method Not Allowed response is returned when a route matches
+// the path but not the method. Otherwise, the not found handler is called. It
+// is enabled by default and applies to the whole router.
+func WithHandleMethodNotAllowed(enabled bool) Option {
+	return func(r *Router) {
+		r.handleMethodNotAllowed = enabled
+	}
+}
+
+// WithCaseInsensitivePaths is an Option available for NewRouter to match the
+// static parts of route paths case-insensitively, without redirecting. URL
+// parameter values keep their original case. It has no effect on groups.
+func WithCaseInsensitivePaths() Option {
+	return func(r *Router) {
+		r.caseInsensitive = true
+	}
+}
+
 // WithDisableJSONIndent is an Option available for NewRouter to configure JSON responses
 // without indenting
 func WithDisableJSONIndent() Option {
@@ -187,16 +677,21 @@ func WithDisableJSONIndent() Option {
 // The compression level can be gzip.DefaultCompression, gzip.NoCompression, gzip.HuffmanOnly
 // or any integer value between gzip.BestSpeed and gzip.BestCompression inclusive.
 func WithCompressionEnabled(level int) Option {
-	return func(r *Router) {
-		r.enableCompression = true
-		r.gzipHandler = gziphandler.MustNewGzipLevelHandler(level)
-	}
+	return WithCompression(CompressionOptions{
+		Compressors: []Compressor{GzipCompressor(level)},
+	})
 }
 
 // NewRouter returns a new initialized Router.
 func NewRouter(options ...Option) *Router {
-	hr := httprouter.New()
-	r := &Router{router: hr}
+	r := &Router{
+		bodyDrainLimit:         defaultBodyDrainLimit,
+		requestIDField:         "request_id",
+		redirectTrailingSlash:  true,
+		redirectFixedPath:      true,
+		handleMethodNotAllowed: true,
+		jobs:                   newJobGroup(),
+	}
 
 	r.options = options
 	for _, option := range options {
@@ -204,37 +699,100 @@ func NewRouter(options ...Option) *Router {
 	}
 
 	if r.notFound == nil {
-		hr.NotFound = notFoundHandler(r)
-	} else {
-		hr.NotFound = r.notFound
+		r.notFound = notFoundHandler(r)
+	}
+	if r.spaRoot != nil {
+		r.notFound = spaFallbackHandler(r, r.notFound)
+	}
+	if r.cors != nil {
+		r.corsPolicies = append(r.corsPolicies, prefixCORS{r.prefix, r.cors})
+	}
+	config := MatcherConfig{
+		NotFound:               http.HandlerFunc(r.serveNotFound),
+		MethodNotAllowed:       methodNotAllowedHandler(r),
+		RedirectTrailingSlash:  r.redirectTrailingSlash,
+		RedirectFixedPath:      r.redirectFixedPath,
+		HandleMethodNotAllowed: r.handleMethodNotAllowed,
+	}
+	newMatcher := r.newMatcher
+	if newMatcher == nil {
+		newMatcher = newHTTPRouterMatcher
 	}
+	r.matcher = newDynamicMatcher(newMatcher, config)
 
+	if r.debugAccess != nil {
+		r.registerDebugEndpoints()
+	}
 	return r
 }
 
-// Use registers a middleware to be used for all routes.
+// Use registers a middleware to be used for all routes. The middleware chain
+// of a route is composed when it is registered, so middleware should be added
+// first; middleware added later still applies to the existing routes, whose
+// chains are then recomposed once, on their next request.
 func (r *Router) Use(ms ...Middleware) {
-	r.middleware = append(r.middleware, ms...)
+	for _, m := range ms {
+		r.use(funcName(m), m)
+	}
+}
+
+// UseNamed registers a middleware like Use, under a name reported by
+// MiddlewareChain.
+func (r *Router) UseNamed(name string, m Middleware) {
+	r.use(name, m)
+}
+
+func (r *Router) use(name string, m Middleware) {
+	r.middleware = append(r.middleware, m)
+	r.middlewareNames = append(r.middlewareNames, name)
+	atomic.AddUint32(&r.root().middlewareVersion, 1)
 }
 
 // Group creates a new subrouter, representing a group of routes, from the given
 // Router. This subrouter may have its own middleware, but will also inherit its
 // parent's middleware. It will also inherit all the parent options which can
 // be overridden by passing new options.
+//
+// If the group has its own path prefix (see WithPathPrefix) along with its own
+// not found handler or error encoder, unmatched requests under the prefix are
+// answered by the group's not found handler, or by a 404 error written with
+// the group's error encoder.
 func (r *Router) Group(groupOptions ...Option) *Router {
 	newRouter := &Router{
 		parent:     r,
-		router:     r.router,
+		matcher:    r.matcher,
 		DumpErrors: r.DumpErrors,
-		options:    r.options,
+		options:    append([]Option(nil), r.options...),
 	}
 	for _, option := range r.options {
 		option(newRouter)
 	}
+	// Options passed to the group override the inherited ones.
+	notFound, errorEncoder, cors := newRouter.notFound, newRouter.errorEncoder, newRouter.cors
+	newRouter.notFound, newRouter.errorEncoder = nil, nil
 	for _, option := range groupOptions {
 		option(newRouter)
 		newRouter.options = append(newRouter.options, option)
 	}
+	ownNotFound, ownErrorEncoder := newRouter.notFound != nil, newRouter.errorEncoder != nil
+	if !ownNotFound {
+		newRouter.notFound = notFound
+	}
+	if !ownErrorEncoder {
+		newRouter.errorEncoder = errorEncoder
+	}
+
+	if newRouter.prefix != r.prefix && (ownNotFound || ownErrorEncoder) {
+		if !ownNotFound {
+			newRouter.notFound = notFoundHandler(newRouter)
+		}
+		root := r.root()
+		root.groupNotFound = append(root.groupNotFound, prefixHandler{newRouter.prefix, newRouter.notFound})
+	}
+	if newRouter.cors != cors {
+		root := r.root()
+		root.corsPolicies = append(root.corsPolicies, prefixCORS{newRouter.prefix, newRouter.cors})
+	}
 	return newRouter
 }
 
@@ -248,120 +806,541 @@ func (r *Router) Group(groupOptions ...Option) *Router {
 //	}
 type RouteMap map[string]Endpoint
 
-// Routes registers all routes in the route map. It x panic if an entry is
-// malformed.
+// Routes registers all routes in the route map. It panics if an entry is
+// malformed, unless WithRegistrationErrors is used.
 func (r *Router) Routes(m RouteMap) {
 	for p, e := range m {
 		parts := strings.Fields(p)
 		if len(parts) != 2 {
-			panic(fmt.Sprintf("invalid RouteMap: %q", p))
+			r.registrationFailed(&RouteError{Path: p, Err: fmt.Errorf("invalid RouteMap: %q", p)})
+			continue
 		}
 		method, path := parts[0], parts[1]
+		if method == http.MethodGet && r.root().serveMuxPatterns && !routeMapHasHead(m, path) {
+			r.handleGetAndHead(path, e)
+			continue
+		}
 		r.Handle(method, path, e)
 	}
 }
 
-// Get is a shortcut for router.Handle(http.MethodGet, path, endpoint).
-func (r *Router) Get(path string, endpoint Endpoint) {
-	r.Handle(http.MethodGet, path, endpoint)
+// routeMapHasHead reports whether the route map has a HEAD route for the
+// path.
+func routeMapHasHead(m RouteMap, path string) bool {
+	for p := range m {
+		if parts := strings.Fields(p); len(parts) == 2 && parts[0] == http.MethodHead && parts[1] == path {
+			return true
+		}
+	}
+	return false
+}
+
+// Get is a shortcut for router.Handle(http.MethodGet, path, endpoint, opts...).
+func (r *Router) Get(path string, endpoint Endpoint, opts ...RouteOption) {
+	r.Handle(http.MethodGet, path, endpoint, opts...)
+}
+
+// Head is a shortcut for router.Handle(http.MethodHead, path, endpoint, opts...).
+func (r *Router) Head(path string, endpoint Endpoint, opts ...RouteOption) {
+	r.Handle(http.MethodHead, path, endpoint, opts...)
 }
 
-// Head is a shortcut for router.Handle(http.MethodHead, path, endpoint).
-func (r *Router) Head(path string, endpoint Endpoint) {
-	r.Handle(http.MethodHead, path, endpoint)
+// Post is a shortcut for router.Handle(http.MethodPost, path, endpoint, opts...).
+func (r *Router) Post(path string, endpoint Endpoint, opts ...RouteOption) {
+	r.Handle(http.MethodPost, path, endpoint, opts...)
 }
 
-// Post is a shortcut for router.Handle(http.MethodPost, path, endpoint).
-func (r *Router) Post(path string, endpoint Endpoint) {
-	r.Handle(http.MethodPost, path, endpoint)
+// Stub registers a planned route, answering with a 501 Not Implemented error
+// with the message, so that an API can be published ahead of its
+// implementation. The route is listed as a stub by RegisteredRoutes.
+func (r *Router) Stub(method, path, message string, opts ...RouteOption) {
+	if message == "" {
+		message = "not implemented"
+	}
+	err := Error(http.StatusNotImplemented, "not_implemented", message)
+	stub := func(ctx context.Context, req *Request) (interface{}, error) {
+		return nil, err
+	}
+	opts = append(opts, func(route *Route) { route.Stub = true })
+	r.Handle(method, path, stub, opts...)
 }
 
-// Handle registers a new endpoint to handle the given path and method.
-func (r *Router) Handle(method, path string, endpoint Endpoint) {
+// Handle registers a new endpoint to handle the given path and method. It can
+// be called while the router serves requests.
+func (r *Router) Handle(method, path string, endpoint Endpoint, opts ...RouteOption) {
+	path = r.prefix + path
+	defer r.recoverRegistration(method, path)
+	var restWildcard string
+	if r.root().serveMuxPatterns {
+		path, restWildcard = translatePattern(path)
+	}
+	route := &Route{Method: method, Path: path, SLOClass: r.sloClass, router: r}
+	for _, opt := range opts {
+		opt(route)
+	}
+	root := r.root()
+	if root.errorBudget != nil {
+		route.budget = newRouteBudget(root.errorBudget, route)
+	}
+	if route.Mock || (r.mockResponses && (route.responseExample != nil || route.ResponseSchema != nil)) {
+		route.Mock = true
+		endpoint = mockEndpoint(route)
+	}
+
+	if route.RequestSchema != nil {
+		endpoint = validateRequestEndpoint(endpoint, route.RequestSchema)
+	}
+	if len(route.Scopes) > 0 {
+		endpoint = requireScopeCheck(endpoint)
+	}
 	endpoint = applyMiddleware(endpoint, r)
-	handler := endpointToHandler(endpoint, path, r)
-	r.router.Handle(method, path, handler)
+	if r.clientDeadlineMax > 0 {
+		endpoint = deadlineEndpoint(endpoint, r.clientDeadlineMax)
+	}
+	if r.slowRequestFunc != nil && r.slowThreshold > 0 {
+		endpoint = slowRequestEndpoint(endpoint, route, r.slowThreshold, r.slowRequestFunc)
+	}
+	handler := endpointToHandler(endpoint, route, r)
+	if route.pool != nil {
+		handler = poolHandle(route.pool, handler, r)
+	}
+	if route.limiter == nil {
+		route.limiter = r.limiter
+	}
+	if route.cachePolicy == nil {
+		route.cachePolicy = r.cachePolicy
+	}
+	if route.readTimeout == 0 {
+		route.readTimeout = r.readTimeout
+	}
+	if route.writeTimeout == 0 {
+		route.writeTimeout = r.writeTimeout
+	}
+	if route.limiter != nil {
+		handler = limitHandle(route.limiter, handler, r)
+	}
+	if policy, ok := root.sloPolicies[route.SLOClass]; ok {
+		handler = sloHandle(policy, handler, r)
+	}
+	if len(route.Params) > 0 {
+		handler = constrainParams(route.Params, handler, http.HandlerFunc(root.serveNotFound))
+	}
+	if restWildcard != "" {
+		handler = trimRestWildcard(restWildcard, handler)
+	}
+	if root.caseInsensitive {
+		handler = caseInsensitiveHandle(path, handler)
+		path = lowerStaticPath(path)
+	}
+
+	root.routesMu.Lock()
+	defer root.routesMu.Unlock()
+	if route.Name != "" {
+		if _, ok := root.namedRoutes[route.Name]; ok {
+			panic(fmt.Sprintf("duplicate route name %q", route.Name))
+		}
+	}
+	r.matcher.Handle(method, path, handler)
+	if route.Name != "" {
+		if root.namedRoutes == nil {
+			root.namedRoutes = make(map[string]*Route)
+		}
+		root.namedRoutes[route.Name] = route
+	}
+	root.routes = append(root.routes, route)
+}
+
+// HandlerFunc converts the endpoint into an http.HandlerFunc, applying the
+// router's middleware, error translation and JSON encoding. It allows an
+// endpoint to be mounted on another router, such as http.ServeMux, e.g. during
+// an incremental migration. Since the URL is not matched by the router, the
+// endpoint's Param and Route return empty values.
+func (r *Router) HandlerFunc(endpoint Endpoint) http.HandlerFunc {
+	h := endpointToHandler(applyMiddleware(endpoint, r), &Route{}, r)
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		h(w, req, nil)
+	})
+	if r.enableCompression {
+		handler = r.compress(handler)
+	}
+	return handler.ServeHTTP
+}
+
+// HandlerFunc is a shortcut for NewRouter(options...).HandlerFunc(endpoint).
+func HandlerFunc(endpoint Endpoint, options ...Option) http.HandlerFunc {
+	return NewRouter(options...).HandlerFunc(endpoint)
 }
 
 // ServeHTTP implements the http.Handler interface.
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	var handler http.Handler = r.router
+	if err := r.root().checkURLLimits(req); err != nil {
+		r.sendError(w, req, err)
+		return
+	}
+	if r.root().serveCORS(w, req) {
+		return
+	}
+	if path := r.root().readinessPath; path != "" && req.URL.Path == path {
+		r.root().serveReadiness(w, req)
+		return
+	}
+	if !r.root().Ready() {
+		if err := r.root().lazyWarmup(req.Context()); err != nil {
+			if err != errWarmingUp {
+				log.Printf("jsonrest: warm-up failed: %v", err)
+			}
+			r.sendError(w, req, errWarmingUp)
+			return
+		}
+	}
+
+	var handler http.Handler = r.matcher
+	if r.root().caseInsensitive {
+		handler = http.HandlerFunc(r.serveCaseInsensitive)
+	}
 	if r.enableCompression {
-		handler = r.gzipHandler(handler)
+		handler = r.compress(handler)
 	}
 	handler.ServeHTTP(w, req)
 }
 
+// serveCaseInsensitive dispatches the request to the route matching the
+// lowercased request path, falling back to the underlying router.
+func (r *Router) serveCaseInsensitive(w http.ResponseWriter, req *http.Request) {
+	if h, ps := r.matcher.Lookup(req.Method, lowerASCII(req.URL.Path)); h != nil {
+		h(w, req, ps)
+		return
+	}
+	r.matcher.ServeHTTP(w, req)
+}
+
+// root returns the top-level router of a group.
+func (r *Router) root() *Router {
+	for r.parent != nil {
+		r = r.parent
+	}
+	return r
+}
+
 // applyMiddleware applies the routers's middleware to the provided endpoint.
+// The chain is composed immediately and recomposed if middleware is later
+// added to the router, one of its parents or its composite.
 func applyMiddleware(e Endpoint, r *Router) Endpoint {
+	root := r.root()
+	var chain atomic.Value // composedChain
+	version := atomic.LoadUint32(&root.middlewareVersion)
+	chain.Store(composedChain{version: version, endpoint: composeMiddleware(e, r)})
 	return func(ctx context.Context, req *Request) (interface{}, error) {
-		e, r := e, r // copy into local var in closure.
+		version := atomic.LoadUint32(&root.middlewareVersion)
+		c := chain.Load().(composedChain)
+		if c.version != version {
+			c = composedChain{version: version, endpoint: composeMiddleware(e, r)}
+			chain.Store(c)
+		}
+		return c.endpoint(ctx, req)
+	}
+}
 
-		// Apply middleware from this router and all parent routers.
-		for {
-			for i := len(r.middleware) - 1; i >= 0; i-- {
-				e = r.middleware[i](e)
-			}
-			if r.parent == nil {
-				break
-			}
-			r = r.parent
+// composedChain is an endpoint wrapped with the middleware of its router, as
+// of the root's middleware version.
+type composedChain struct {
+	version  uint32
+	endpoint Endpoint
+}
+
+// composeMiddleware wraps e with the middleware from r and all its parents.
+func composeMiddleware(e Endpoint, r *Router) Endpoint {
+	for {
+		for i := len(r.middleware) - 1; i >= 0; i-- {
+			e = r.middleware[i](e)
+		}
+		if r.parent == nil {
+			break
 		}
-		return e(ctx, req)
+		r = r.parent
 	}
+	if r.composite != nil {
+		for i := len(r.composite.middleware) - 1; i >= 0; i-- {
+			e = r.composite.middleware[i](e)
+		}
+	}
+	return e
 }
 
-// endpointToHandler converts an endpoint to an httprouter.Handle function.
-func endpointToHandler(e Endpoint, path string, router *Router) func(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
-	return func(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+// endpointToHandler converts an endpoint to a Handle function.
+func endpointToHandler(e Endpoint, route *Route, router *Router) Handle {
+	return func(w http.ResponseWriter, req *http.Request, params Params) {
+		var (
+			request *Request
+			status  int
+			err     error
+		)
+		pooled := router.root().requestPooling
+		if pooled {
+			defer func() {
+				if request != nil && !request.hijacked {
+					request.release()
+				}
+			}()
+		}
+		defer func() {
+			if request != nil {
+				if request.hijacked {
+					status = 0
+				}
+				router.runResponseHooks(request.req.Context(), request, status, err)
+				if len(request.jobs) > 0 {
+					router.startJobs(request)
+				}
+			}
+		}()
+		defer drainBody(req.Body, router.root().bodyDrainLimit)
 		defer func() {
 			if r := recover(); r != nil {
 				log.Printf("panic serving %v: %+v", req.RequestURI, router)
 				debug.PrintStack()
-				router.sendJSON(w, 500, unknownError)
+				status, err = http.StatusInternalServerError, fmt.Errorf("panic: %v", r)
+				if request != nil {
+					req = request.req // may carry a request ID
+					request.captureError = route.budget.takeCapture()
+				}
+				route.budget.record(http.StatusInternalServerError)
+				if request == nil || !request.hijacked {
+					router.sendError(w, req, unknownError)
+				}
 			}
 		}()
 
-		result, err := e(req.Context(), &Request{
-			params:         params,
-			req:            req,
-			responseWriter: w,
-			route:          path,
-		})
+		configureCompression(w, route)
+		setConnDeadlines(w, route.readTimeout, route.writeTimeout)
+		if router.baseContext != nil {
+			req = req.WithContext(router.baseContext(req))
+		}
+		request = newRequest(pooled)
+		request.params = params
+		request.req = req
+		request.responseWriter = w
+		request.route = route.Path
+		request.routeInfo = route
+		request.pageLimits = router.pageLimits
+		request.router = router
+		if len(router.contextHooks) > 0 {
+			ctx := req.Context()
+			for _, hook := range router.contextHooks {
+				ctx = hook(ctx, request)
+			}
+			req = req.WithContext(ctx)
+			request.req = req
+		}
+
+		req = req.WithContext(context.WithValue(req.Context(), requestKey{}, request))
+		request.req = req
+		if router.tenantResolver != nil {
+			var tenant string
+			if tenant, err = router.tenantResolver(request); err != nil {
+				status = translateError(err, false).StatusCode()
+				router.sendError(w, req, err)
+				return
+			}
+			if tenant != "" {
+				request.Set(tenantKey{}, tenant)
+			}
+		}
+		if route.Deprecated {
+			setDeprecationHeaders(w.Header(), route)
+			if router.deprecationHook != nil {
+				router.deprecationHook(req.Context(), request)
+			}
+		}
+		if router.maxDecompressedSize > 0 {
+			if err = decompressRequest(req, router.maxDecompressedSize); err != nil {
+				status = translateError(err, false).StatusCode()
+				router.sendError(w, req, err)
+				return
+			}
+		}
+		var result interface{}
+		result, err = e(req.Context(), request)
+		if request.hijacked {
+			return
+		}
+		for _, intercept := range router.interceptors {
+			if err != nil {
+				break
+			}
+			result, err = intercept(req.Context(), request, result)
+		}
+		if res, ok := result.(Response); ok && res.Range != nil && err == nil {
+			result, err = applyContentRange(w.Header(), res)
+		}
+		if router.serverTiming {
+			if timing := serverTiming(request.Events()); timing != "" {
+				w.Header().Set("Server-Timing", timing)
+			}
+		}
+		status = responseStatus(result, err)
+		if status >= 500 {
+			request.captureError = route.budget.takeCapture()
+		}
+		route.budget.record(status)
 		if err != nil {
-			httpErr := translateError(err, router.DumpErrors)
-			router.sendJSON(w, httpErr.StatusCode(), httpErr)
+			router.sendError(w, request.req, err)
 			return
 		}
+		if status < 300 {
+			route.cachePolicy.apply(req, w.Header())
+		}
+		if status == http.StatusOK && cacheable(result) && notModified(req, w.Header()) {
+			status = http.StatusNotModified
+			w.WriteHeader(status)
+			return
+		}
+
+		send := func(w http.ResponseWriter, status int, v interface{}) {
+			router.sendJSON(w, req, status, v)
+		}
+		if route.stream {
+			send = func(w http.ResponseWriter, status int, v interface{}) {
+				router.streamJSON(w, req, status, v)
+			}
+		}
+		var fields fieldSet
+		if router.fieldsParam != "" {
+			fields = parseFieldSet(req.URL.Query().Get(router.fieldsParam))
+		}
+		if router.validateResponses && route.ResponseSchema != nil && fields == nil {
+			send = router.validatingSender(send, route, req, &status)
+		}
+		if len(request.links) > 0 {
+			send = router.linkSender(send, w, request.links, req)
+		}
+		if fields != nil {
+			send = router.sparseSender(send, fields, req)
+		}
+		if router.responseKeyCase != 0 {
+			send = router.keyCaseSender(send, router.responseKeyCase, req)
+		}
+		if router.localizedFormatting {
+			send = router.localizedSender(send, request.Locale())
+		} else if router.redaction {
+			send = redactSender(send)
+		}
 
 		if res, ok := result.(Response); ok {
-			router.sendJSON(w, res.StatusCode, res.Body)
+			send(w, res.StatusCode, res.Body)
 			return
 		}
 
-		router.sendJSON(w, 200, result)
+		if h, ok := result.(HandlerResponse); ok {
+			h.ServeHTTP(w, req)
+			return
+		}
+
+		send(w, 200, result)
+	}
+}
+
+// defaultBodyDrainLimit is the default value of WithBodyDrainLimit.
+const defaultBodyDrainLimit = 256 << 10
+
+// drainBody reads and discards up to limit bytes of the unread request body,
+// and closes it.
+func drainBody(body io.ReadCloser, limit int64) {
+	if body == nil || body == http.NoBody {
+		return
+	}
+	if limit > 0 {
+		_, _ = io.CopyN(ioutil.Discard, body, limit)
+	}
+	body.Close()
+}
+
+// sendError translates err into an HTTPErrorResponse and writes it to the
+// response with the router's error encoder.
+func (r *Router) sendError(w http.ResponseWriter, req *http.Request, err error) {
+	dump := r.DumpErrors || (r.dumpErrors != nil && r.dumpErrors(req)) || captureError(req)
+	httpErr := translateError(err, dump)
+	if _, ok := err.(HTTPErrorResponse); !ok && dump {
+		if request := RequestFromContext(req.Context()); request != nil {
+			e := httpErr.(*HTTPError)
+			e.Details = append(e.Details, dumpEvents(request.Events())...)
+		}
+	}
+	httpErr = r.localizeError(req, httpErr)
+	if id := RequestIDFromContext(req.Context()); id != "" {
+		httpErr = withRequestID(httpErr, r.root().requestIDField, id)
+	}
+	if r.errorEncoder != nil {
+		r.errorEncoder(w, req, httpErr)
+		return
 	}
+	r.sendJSON(w, req, httpErr.StatusCode(), httpErr)
 }
 
-// sendJSON encodes v as JSON and writes it to the response body. Panics
-// if an encoding error occurs.
-func (r *Router) sendJSON(w http.ResponseWriter, status int, v interface{}) {
-	// TODO: Maybe don't panic? This will encounter an error if the caller
-	// closes the response early.
+// sendJSON encodes v as JSON into a pooled buffer, calls the post-encode
+// hooks and writes the response with its Content-Length. If v cannot be
+// encoded, an unknown error is written with a 500 status instead.
+func (r *Router) sendJSON(w http.ResponseWriter, req *http.Request, status int, v interface{}) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if err := r.encodeJSON(buf, v); err != nil {
+		r.encodeFailed(req, err)
+		status = http.StatusInternalServerError
+		buf.Reset()
+		r.encodeJSON(buf, unknownError)
+	}
 	w.Header().Set("content-type", "application/json; charset=utf-8")
+	for _, hook := range r.postEncodeHooks {
+		hook(w.Header(), status, buf.Bytes())
+	}
+	if v != nil {
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	}
 	w.WriteHeader(status)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		r.encodeFailed(req, err)
+	}
+}
 
-	if v == nil {
-		return
+// encodeFailed logs an error encoding or writing the response to req, and
+// calls the encode error hooks.
+func (r *Router) encodeFailed(req *http.Request, err error) {
+	log.Printf("error writing response to %v: %v", req.RequestURI, err)
+	for _, hook := range r.encodeErrorHooks {
+		hook(req, err)
 	}
+}
 
-	enc := json.NewEncoder(w)
+// encodeJSON writes v as JSON to buf. Nothing is written if v is nil.
+func (r *Router) encodeJSON(buf *bytes.Buffer, v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	enc := json.NewEncoder(buf)
 	if !r.disableJSONIndent {
 		enc.SetIndent("", "  ")
 	}
-	if err := enc.Encode(v); err != nil {
-		panic(err)
+	return enc.Encode(v)
+}
+
+// serveNotFound calls the not found handler of the group with the longest
+// prefix matching the request path, or the router's not found handler.
+func (r *Router) serveNotFound(w http.ResponseWriter, req *http.Request) {
+	h := r.notFound
+	longest := -1
+	for _, g := range r.groupNotFound {
+		if len(g.prefix) > longest && strings.HasPrefix(req.URL.Path, g.prefix) {
+			h, longest = g.handler, len(g.prefix)
+		}
 	}
+	h.ServeHTTP(w, req)
+}
+
+// prefixHandler is a handler for the requests under a path prefix.
+type prefixHandler struct {
+	prefix  string
+	handler http.Handler
 }
 
 // notFoundHandler returns a 404 not found response to the caller.
@@ -369,7 +1348,19 @@ func notFoundHandler(r *Router) http.Handler {
 	endpoint := func(_ context.Context, req *Request) (interface{}, error) {
 		return nil, Error(404, "not_found", "url not found")
 	}
-	h := endpointToHandler(endpoint, "", r)
+	h := endpointToHandler(endpoint, &Route{}, r)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		h(w, req, nil)
+	})
+}
+
+// methodNotAllowedHandler returns a 405 method not allowed response to the
+// caller.
+func methodNotAllowedHandler(r *Router) http.Handler {
+	endpoint := func(_ context.Context, req *Request) (interface{}, error) {
+		return nil, Error(http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+	}
+	h := endpointToHandler(endpoint, &Route{}, r)
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		h(w, req, nil)
 	})
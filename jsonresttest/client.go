@@ -0,0 +1,356 @@
+// Package jsonresttest provides utilities to test the routers, endpoints and
+// middleware of jsonrest, like net/http/httptest does for net/http: a client
+// sending requests to a router with fluent assertions on the responses, golden
+// file snapshots, test doubles and contract tests.
+package jsonresttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// A Client sends requests to a handler, typically a jsonrest.Router, through
+// httptest, so that routing, middleware and error translation are exercised
+// along with the endpoints.
+type Client struct {
+	handler http.Handler
+	header  http.Header
+}
+
+// NewClient returns a Client sending its requests to the handler.
+func NewClient(h http.Handler) *Client {
+	return &Client{handler: h, header: make(http.Header)}
+}
+
+// WithHeader sets a header sent with all the requests of the client.
+func (c *Client) WithHeader(key, value string) *Client {
+	c.header.Set(key, value)
+	return c
+}
+
+// Get starts a GET request to the path.
+func (c *Client) Get(path string) *ClientRequest { return c.Request(http.MethodGet, path) }
+
+// Post starts a POST request to the path, with the JSON encoding of body.
+func (c *Client) Post(path string, body interface{}) *ClientRequest {
+	return c.Request(http.MethodPost, path).WithJSON(body)
+}
+
+// Put starts a PUT request to the path, with the JSON encoding of body.
+func (c *Client) Put(path string, body interface{}) *ClientRequest {
+	return c.Request(http.MethodPut, path).WithJSON(body)
+}
+
+// Patch starts a PATCH request to the path, with the JSON encoding of body.
+func (c *Client) Patch(path string, body interface{}) *ClientRequest {
+	return c.Request(http.MethodPatch, path).WithJSON(body)
+}
+
+// Delete starts a DELETE request to the path.
+func (c *Client) Delete(path string) *ClientRequest {
+	return c.Request(http.MethodDelete, path)
+}
+
+// Request starts a request with the method to the path.
+func (c *Client) Request(method, path string) *ClientRequest {
+	return &ClientRequest{
+		client: c,
+		method: method,
+		path:   path,
+		header: c.header.Clone(),
+	}
+}
+
+// A ClientRequest is a request being built by a Client. It is sent by
+// Do.
+type ClientRequest struct {
+	client *Client
+	method string
+	path   string
+	header http.Header
+	body   []byte
+	err    error
+}
+
+// WithHeader sets a request header.
+func (r *ClientRequest) WithHeader(key, value string) *ClientRequest {
+	r.header.Set(key, value)
+	return r
+}
+
+// WithQuery adds a query parameter to the request URL.
+func (r *ClientRequest) WithQuery(key, value string) *ClientRequest {
+	sep := "?"
+	if strings.Contains(r.path, "?") {
+		sep = "&"
+	}
+	r.path += sep + url.QueryEscape(key) + "=" + url.QueryEscape(value)
+	return r
+}
+
+// WithJSON sets the request body to the JSON encoding of v. A nil v sends no
+// body.
+func (r *ClientRequest) WithJSON(v interface{}) *ClientRequest {
+	if v == nil {
+		return r
+	}
+	r.body, r.err = json.Marshal(v)
+	r.header.Set("Content-Type", "application/json")
+	return r
+}
+
+// WithBody sets the raw request body and its content type.
+func (r *ClientRequest) WithBody(body []byte, contentType string) *ClientRequest {
+	r.body = body
+	r.header.Set("Content-Type", contentType)
+	return r
+}
+
+// Do sends the request and returns its response. It fails the test if the
+// request cannot be built.
+func (r *ClientRequest) Do(t testing.TB) *Response {
+	t.Helper()
+	if r.err != nil {
+		t.Fatalf("jsonresttest: %s %s: encoding body: %v", r.method, r.path, r.err)
+	}
+	var body io.Reader
+	if r.body != nil {
+		body = bytes.NewReader(r.body)
+	}
+	req := httptest.NewRequest(r.method, r.path, body)
+	for key, vals := range r.header {
+		req.Header[key] = vals
+	}
+	w := httptest.NewRecorder()
+	r.client.handler.ServeHTTP(w, req)
+	return &Response{ResponseRecorder: w, t: t, name: r.method + " " + r.path}
+}
+
+// A Response is the response to a ClientRequest, with fluent
+// assertions reporting failures to the test.
+type Response struct {
+	*httptest.ResponseRecorder
+
+	t    testing.TB
+	name string
+}
+
+// ExpectStatus fails the test if the response status code is not code.
+func (r *Response) ExpectStatus(code int) *Response {
+	r.t.Helper()
+	if r.Code != code {
+		r.t.Errorf("%s: got status %d, want %d; body: %s", r.name, r.Code, code, r.Body.String())
+	}
+	return r
+}
+
+// ExpectHeader fails the test if the response header is not value.
+func (r *Response) ExpectHeader(key, value string) *Response {
+	r.t.Helper()
+	if got := r.Header().Get(key); got != value {
+		r.t.Errorf("%s: got header %s %q, want %q", r.name, key, got, value)
+	}
+	return r
+}
+
+// ExpectJSON fails the test if the value at the path of the JSON response
+// body is not the JSON equivalent of want. The path is a dot-separated list of
+// object keys and array indices, e.g. "items.0.name"; an empty path denotes
+// the whole body.
+func (r *Response) ExpectJSON(path string, want interface{}) *Response {
+	r.t.Helper()
+	got, err := r.JSONPath(path)
+	if err != nil {
+		r.t.Errorf("%s: %v", r.name, err)
+		return r
+	}
+	wantValue, err := decodeJSON(want)
+	if err != nil {
+		r.t.Errorf("%s: encoding expected value: %v", r.name, err)
+		return r
+	}
+	if !reflect.DeepEqual(got, wantValue) {
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(wantValue)
+		r.t.Errorf("%s: got %s at %q, want %s", r.name, gotJSON, path, wantJSON)
+	}
+	return r
+}
+
+// ExpectError fails the test if the response is not an error with the status
+// code and error code.
+func (r *Response) ExpectError(status int, code string) *Response {
+	r.t.Helper()
+	return r.ExpectStatus(status).ExpectJSON("error.code", code)
+}
+
+// JSON decodes the JSON response body into v, failing the test on error.
+func (r *Response) JSON(v interface{}) *Response {
+	r.t.Helper()
+	if err := json.Unmarshal(r.Body.Bytes(), v); err != nil {
+		r.t.Fatalf("%s: decoding body: %v; body: %s", r.name, err, r.Body.String())
+	}
+	return r
+}
+
+// JSONPath returns the value at the path of the JSON response body, as
+// decoded by encoding/json into an interface{}. See ExpectJSON for the syntax
+// of the path.
+func (r *Response) JSONPath(path string) (interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal(r.Body.Bytes(), &v); err != nil {
+		return nil, fmt.Errorf("decoding body: %v; body: %s", err, r.Body.String())
+	}
+	if path == "" {
+		return v, nil
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch val := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = val[key]; !ok {
+				return nil, fmt.Errorf("no key %q in body at %q", key, path)
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(val) {
+				return nil, fmt.Errorf("no index %q in body at %q", key, path)
+			}
+			v = val[i]
+		default:
+			return nil, fmt.Errorf("no %q in body at %q", key, path)
+		}
+	}
+	return v, nil
+}
+
+// UpdateGoldenEnv is the environment variable which, when set to a non-empty
+// value, makes ExpectGolden write the golden files instead of comparing them,
+// e.g. JSONREST_UPDATE_GOLDEN=1 go test ./...
+const UpdateGoldenEnv = "JSONREST_UPDATE_GOLDEN"
+
+// ExpectGolden fails the test if the snapshot of the response differs from
+// the golden file testdata/<name>.golden. The snapshot is made of the status
+// code, the sorted response headers except Date and the ignored ones (e.g.
+// X-Request-Id), and the body, as indented JSON with sorted keys if it is
+// valid JSON, as is otherwise. The golden files are written when the
+// UpdateGoldenEnv environment variable is set.
+func (r *Response) ExpectGolden(name string, ignoreHeaders ...string) *Response {
+	r.t.Helper()
+	got := r.snapshot(ignoreHeaders)
+	path := filepath.Join("testdata", filepath.FromSlash(name)+".golden")
+
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			r.t.Fatalf("%s: %v", r.name, err)
+		}
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			r.t.Fatalf("%s: %v", r.name, err)
+		}
+		return r
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		r.t.Errorf("%s: %v (set %s=1 to create it)", r.name, err, UpdateGoldenEnv)
+		return r
+	}
+	if diff := diffLines(string(want), string(got)); diff != "" {
+		r.t.Errorf("%s: response differs from %s (set %s=1 to update it):\n%s", r.name, path, UpdateGoldenEnv, diff)
+	}
+	return r
+}
+
+// snapshot returns the canonical representation of the response compared to
+// golden files.
+func (r *Response) snapshot(ignoreHeaders []string) []byte {
+	ignored := map[string]bool{"Date": true}
+	for _, key := range ignoreHeaders {
+		ignored[http.CanonicalHeaderKey(key)] = true
+	}
+	var keys []string
+	for key := range r.Header() {
+		if !ignored[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d %s\n", r.Code, http.StatusText(r.Code))
+	for _, key := range keys {
+		for _, val := range r.Header()[key] {
+			fmt.Fprintf(&buf, "%s: %s\n", key, val)
+		}
+	}
+	buf.WriteByte('\n')
+
+	body := r.Body.Bytes()
+	var v interface{}
+	if json.Unmarshal(body, &v) == nil {
+		// Marshaling the decoded value sorts the object keys.
+		if b, err := json.MarshalIndent(v, "", "  "); err == nil {
+			body = append(b, '\n')
+		}
+	}
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+// diffLines returns a line-by-line description of the differences between
+// want and got, or an empty string if they are equal. Lines are compared at
+// the same position, which is enough to locate changes in snapshots.
+func diffLines(want, got string) string {
+	if want == got {
+		return ""
+	}
+	wantLines, gotLines := strings.Split(want, "\n"), strings.Split(got, "\n")
+	n := len(wantLines)
+	if len(gotLines) > n {
+		n = len(gotLines)
+	}
+	var buf strings.Builder
+	for i := 0; i < n; i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w == g {
+			continue
+		}
+		if i < len(wantLines) {
+			fmt.Fprintf(&buf, "-%d: %s\n", i+1, w)
+		}
+		if i < len(gotLines) {
+			fmt.Fprintf(&buf, "+%d: %s\n", i+1, g)
+		}
+	}
+	return buf.String()
+}
+
+// decodeJSON returns v as decoded by encoding/json into an interface{}.
+func decodeJSON(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var n interface{}
+	err = json.Unmarshal(b, &n)
+	return n, err
+}
@@ -0,0 +1,100 @@
+package jsonresttest
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	jsonrest "github.com/mbranch/jsonrest-go"
+)
+
+// A ContractCase is a case of a contract test run by RunContractTests.
+type ContractCase struct {
+	// Name is the name of the subtest, e.g. "POST /orders".
+	Name string
+
+	// Method and Path are the method and the URL path of the request.
+	Method string
+	Path   string
+
+	// Header are the headers of the request, e.g. credentials.
+	Header map[string]string
+
+	// Body is the request body, encoded as JSON if not nil.
+	Body interface{}
+
+	// Status is the expected status of the response. Any 2xx status is
+	// accepted if it is 0.
+	Status int
+
+	// Response, if set, is the schema the response body must match.
+	Response *jsonrest.Schema
+}
+
+// GenerateContractCases returns a contract test case for each contract of the
+// router (see jsonrest.Router.Contracts): the route's URL parameters are set to "1",
+// the request body is an example of its request schema (see jsonrest.Schema.Example),
+// and the response must match its response schema. The cases can be adjusted
+// before being run, e.g. to set credentials or valid parameters.
+func GenerateContractCases(r *jsonrest.Router) []ContractCase {
+	var cases []ContractCase
+	for _, c := range r.Contracts() {
+		segments := strings.Split(c.Path, "/")
+		for i, seg := range segments {
+			if strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*") {
+				segments[i] = "1"
+			}
+		}
+		cases = append(cases, ContractCase{
+			Name:     c.Method + " " + c.Path,
+			Method:   c.Method,
+			Path:     strings.Join(segments, "/"),
+			Body:     c.Request.Example(),
+			Response: c.Response,
+		})
+	}
+	return cases
+}
+
+// RunContractTests runs the contract test cases against the handler,
+// typically a jsonrest.Router, in subtests. A case fails if the response status is
+// not the expected one, or if the response body does not match the case's
+// schema. For example:
+//
+//	func TestContracts(t *testing.T) {
+//		r := newRouter()
+//		jsonresttest.RunContractTests(t, r, jsonresttest.GenerateContractCases(r))
+//	}
+func RunContractTests(t *testing.T, h http.Handler, cases []ContractCase) {
+	client := NewClient(h)
+	for _, c := range cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			req := client.Request(c.Method, c.Path)
+			for key, val := range c.Header {
+				req.WithHeader(key, val)
+			}
+			if c.Body != nil {
+				req.WithJSON(c.Body)
+			}
+			res := req.Do(t)
+			if c.Status != 0 {
+				res.ExpectStatus(c.Status)
+			} else if res.Code < 200 || res.Code >= 300 {
+				t.Errorf("%s: got status %d, want 2xx; body: %s", res.name, res.Code, res.Body.String())
+				return
+			}
+			if c.Response == nil || res.Body.Len() == 0 || res.Code >= 300 {
+				return
+			}
+			violations, err := c.Response.ValidateJSON(res.Body.Bytes())
+			if err != nil {
+				t.Errorf("%s: decoding response body: %v", res.name, err)
+				return
+			}
+			for _, v := range violations {
+				t.Errorf("%s: response does not match the schema: %v", res.name, v)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package jsonresttest
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	jsonrest "github.com/mbranch/jsonrest-go"
+)
+
+// A MiddlewareSpy creates middleware recording the order in which they are
+// invoked, to test the wiring of routes without running the real middleware.
+// It is safe for concurrent use.
+type MiddlewareSpy struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+// NewMiddlewareSpy returns a new MiddlewareSpy.
+func NewMiddlewareSpy() *MiddlewareSpy {
+	return &MiddlewareSpy{}
+}
+
+// Middleware returns a middleware recording the name when it is invoked, then
+// calling the next endpoint. Register it with jsonrest.Router.UseNamed for
+// jsonrest.Router.MiddlewareChain and ExpectMiddleware to report the name
+// too.
+func (s *MiddlewareSpy) Middleware(name string) jsonrest.Middleware {
+	return func(next jsonrest.Endpoint) jsonrest.Endpoint {
+		return func(ctx context.Context, req *jsonrest.Request) (interface{}, error) {
+			s.mu.Lock()
+			s.calls = append(s.calls, name)
+			s.mu.Unlock()
+			return next(ctx, req)
+		}
+	}
+}
+
+// Calls returns the names of the invoked middleware, in invocation order.
+func (s *MiddlewareSpy) Calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+// Reset forgets the recorded invocations.
+func (s *MiddlewareSpy) Reset() {
+	s.mu.Lock()
+	s.calls = nil
+	s.mu.Unlock()
+}
+
+// A StubEndpoint is an endpoint returning canned results, in the order they
+// are added; the last one is returned by all the subsequent calls. It is safe
+// for concurrent use.
+type StubEndpoint struct {
+	mu      sync.Mutex
+	results []stubResult
+	calls   int
+}
+
+// stubResult is a canned result of a StubEndpoint.
+type stubResult struct {
+	val interface{}
+	err error
+}
+
+// NewStubEndpoint returns a StubEndpoint. Without canned results, its endpoint
+// returns a nil value, sent as an empty response.
+func NewStubEndpoint() *StubEndpoint {
+	return &StubEndpoint{}
+}
+
+// Returns adds a canned successful result.
+func (s *StubEndpoint) Returns(val interface{}) *StubEndpoint {
+	s.mu.Lock()
+	s.results = append(s.results, stubResult{val: val})
+	s.mu.Unlock()
+	return s
+}
+
+// Fails adds a canned error.
+func (s *StubEndpoint) Fails(err error) *StubEndpoint {
+	s.mu.Lock()
+	s.results = append(s.results, stubResult{err: err})
+	s.mu.Unlock()
+	return s
+}
+
+// Endpoint returns the endpoint returning the canned results.
+func (s *StubEndpoint) Endpoint() jsonrest.Endpoint {
+	return func(ctx context.Context, req *jsonrest.Request) (interface{}, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.calls++
+		if len(s.results) == 0 {
+			return nil, nil
+		}
+		i := s.calls - 1
+		if i >= len(s.results) {
+			i = len(s.results) - 1
+		}
+		return s.results[i].val, s.results[i].err
+	}
+}
+
+// Calls returns the number of times the endpoint was called.
+func (s *StubEndpoint) Calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+// ExpectMiddleware fails the test if the middleware chain of the route
+// registered for the method and path, as returned by
+// jsonrest.Router.MiddlewareChain, does not contain the named middleware in
+// this order. Other middleware may be interleaved.
+func ExpectMiddleware(t testing.TB, r *jsonrest.Router, method, path string, names ...string) {
+	t.Helper()
+	chain := r.MiddlewareChain(method, path)
+	if chain == nil {
+		t.Errorf("%s %s: no such route", method, path)
+		return
+	}
+	i := 0
+	for _, name := range chain {
+		if i < len(names) && name == names[i] {
+			i++
+		}
+	}
+	if i < len(names) {
+		t.Errorf("%s %s: middleware chain %q does not contain %q in order", method, path, chain, names)
+	}
+}
@@ -0,0 +1,153 @@
+package jsonresttest_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mbranch/assert-go"
+	jsonrest "github.com/mbranch/jsonrest-go"
+	"github.com/mbranch/jsonrest-go/jsonresttest"
+)
+
+func TestClient(t *testing.T) {
+	r := jsonrest.NewRouter()
+	r.Get("/users/:id", func(ctx context.Context, req *jsonrest.Request) (interface{}, error) {
+		if req.Param("id") != "1" {
+			return nil, jsonrest.NotFound("user not found")
+		}
+		req.SetResponseHeader("X-Auth", req.Header("Authorization"))
+		return m{"id": 1, "tags": []string{"a", req.Query("tag")}}, nil
+	})
+	r.Post("/users", func(ctx context.Context, req *jsonrest.Request) (interface{}, error) {
+		var body m
+		if err := req.BindBody(&body); err != nil {
+			return nil, err
+		}
+		return body, nil
+	})
+
+	tc := jsonresttest.NewClient(r).WithHeader("Authorization", "Bearer x")
+	tc.Get("/users/1").WithQuery("tag", "b c").Do(t).
+		ExpectStatus(200).
+		ExpectHeader("X-Auth", "Bearer x").
+		ExpectJSON("id", 1).
+		ExpectJSON("tags.1", "b c").
+		ExpectJSON("", m{"id": 1, "tags": []string{"a", "b c"}})
+	tc.Get("/users/2").Do(t).ExpectError(404, "not_found")
+	tc.Post("/users", m{"name": "x"}).Do(t).ExpectStatus(200).ExpectJSON("name", "x")
+
+	var got m
+	tc.Get("/users/1").Do(t).JSON(&got)
+	assert.Equal(t, got["id"], float64(1))
+
+	_, err := tc.Get("/users/1").Do(t).JSONPath("tags.5")
+	assert.Equal(t, err.Error(), `no index "5" in body at "tags.5"`)
+}
+
+func TestExpectGolden(t *testing.T) {
+	r := jsonrest.NewRouter()
+	r.Get("/users/:id", func(ctx context.Context, req *jsonrest.Request) (interface{}, error) {
+		req.SetResponseHeader("X-Request-Id", "random")
+		return m{"name": "alice", "id": req.Param("id"), "tags": []string{"a", "b"}}, nil
+	})
+	tc := jsonresttest.NewClient(r)
+	tc.Get("/users/1").Do(t).ExpectGolden("golden/user", "X-Request-Id")
+
+	if os.Getenv(jsonresttest.UpdateGoldenEnv) == "" {
+		rt := &recordingT{TB: t}
+		tc.Get("/users/2").Do(rt).ExpectGolden("golden/user", "X-Request-Id")
+		assert.Equal(t, len(rt.errors), 1)
+		assert.True(t, strings.Contains(rt.errors[0], `-6:   "id": "1",`+"\n"+`+6:   "id": "2",`))
+	}
+}
+
+func TestDoubles(t *testing.T) {
+	spy := jsonresttest.NewMiddlewareSpy()
+	stub := jsonresttest.NewStubEndpoint().
+		Returns(m{"ok": true}).
+		Fails(jsonrest.NotFound("gone"))
+
+	r := jsonrest.NewRouter()
+	r.UseNamed("auth", spy.Middleware("auth"))
+	admin := r.Group()
+	admin.UseNamed("audit", spy.Middleware("audit"))
+	admin.Get("/admin", stub.Endpoint())
+	r.Get("/public", jsonresttest.NewStubEndpoint().Endpoint())
+
+	tc := jsonresttest.NewClient(r)
+	tc.Get("/admin").Do(t).ExpectStatus(200).ExpectJSON("ok", true)
+	tc.Get("/admin").Do(t).ExpectError(404, "not_found")
+	tc.Get("/admin").Do(t).ExpectError(404, "not_found")
+	w := tc.Get("/public").Do(t).ExpectStatus(200)
+	assert.Equal(t, w.Body.String(), "")
+	assert.Equal(t, stub.Calls(), 3)
+	assert.Equal(t, spy.Calls(), []string{"auth", "audit", "auth", "audit", "auth", "audit", "auth"})
+	spy.Reset()
+	assert.Equal(t, len(spy.Calls()), 0)
+
+	jsonresttest.ExpectMiddleware(t, r, "GET", "/admin", "auth", "audit")
+	jsonresttest.ExpectMiddleware(t, r, "GET", "/public", "auth")
+
+	rt := &recordingT{TB: t}
+	jsonresttest.ExpectMiddleware(rt, r, "GET", "/public", "audit")
+	jsonresttest.ExpectMiddleware(rt, r, "GET", "/admin", "audit", "auth")
+	jsonresttest.ExpectMiddleware(rt, r, "GET", "/missing")
+	assert.Equal(t, rt.errors, []string{
+		`GET /public: middleware chain ["auth"] does not contain ["audit"] in order`,
+		`GET /admin: middleware chain ["auth" "audit"] does not contain ["audit" "auth"] in order`,
+		`GET /missing: no such route`,
+	})
+}
+
+func TestContracts(t *testing.T) {
+	type order struct {
+		ID     int    `json:"id"`
+		Status string `json:"status"`
+	}
+	create := jsonrest.MustParseSchema(`{
+		"type": "object",
+		"required": ["sku", "qty"],
+		"properties": {
+			"sku": {"type": "string", "minLength": 3},
+			"qty": {"type": "integer", "minimum": 1},
+			"gift": {"type": "boolean"}
+		}
+	}`)
+	r := jsonrest.NewRouter()
+	r.Post("/orders", func(ctx context.Context, req *jsonrest.Request) (interface{}, error) {
+		return jsonrest.Response{StatusCode: 201, Body: order{ID: 1, Status: "new"}}, nil
+	}, jsonrest.RequestSchema(create), jsonrest.ResponseSchema(jsonrest.SchemaOf(order{})))
+	r.Get("/orders/:id", func(ctx context.Context, req *jsonrest.Request) (interface{}, error) {
+		if req.Param("id") != "1" {
+			return nil, jsonrest.NotFound("order not found")
+		}
+		return order{ID: 1, Status: "new"}, nil
+	}, jsonrest.ResponseSchema(jsonrest.SchemaOf(order{})), jsonrest.Name("order"))
+	r.Get("/health", func(ctx context.Context, req *jsonrest.Request) (interface{}, error) {
+		return nil, nil
+	})
+	cases := jsonresttest.GenerateContractCases(r)
+	assert.Equal(t, len(cases), 2)
+	assert.Equal(t, cases[0].Name, "POST /orders")
+	assert.Equal(t, cases[0].Body, map[string]interface{}{"sku": "example", "qty": int64(1), "gift": true})
+	assert.Equal(t, cases[1].Path, "/orders/1")
+	jsonresttest.RunContractTests(t, r, cases)
+}
+
+// recordingT is a testing.TB recording the errors instead of failing the
+// test.
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+type m map[string]interface{}
@@ -0,0 +1,335 @@
+package jsonrest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The standard JSON-RPC 2.0 error codes.
+const (
+	RPCParseError     = -32700
+	RPCInvalidRequest = -32600
+	RPCMethodNotFound = -32601
+	RPCInvalidParams  = -32602
+	RPCInternalError  = -32603
+
+	// RPCServerError is the code of the errors which are not mapped to a
+	// standard code.
+	RPCServerError = -32000
+)
+
+// An RPCMethod is a JSON-RPC method. The params are the raw JSON object or
+// array of the call, or nil if it has none. Errors are mapped to JSON-RPC
+// errors as described in JSONRPCServer.Mount.
+type RPCMethod func(ctx context.Context, req *Request, params json.RawMessage) (interface{}, error)
+
+// JSONRPCOptions configures a JSONRPCServer.
+type JSONRPCOptions struct {
+	// MaxBatch is the maximum number of calls of a batch. It defaults to 20.
+	MaxBatch int
+
+	// MaxBodySize is the maximum size of a request body. It defaults to 1
+	// MiB.
+	MaxBodySize int64
+}
+
+// A JSONRPCServer exposes methods with JSON-RPC 2.0 over a single POST route,
+// for the clients which prefer RPC semantics. The methods are either
+// registered directly, or dispatched to the routes of the router.
+type JSONRPCServer struct {
+	opts JSONRPCOptions
+
+	mu      sync.RWMutex
+	methods map[string]RPCMethod
+	router  *Router
+}
+
+// NewJSONRPCServer returns a JSONRPCServer without methods.
+func NewJSONRPCServer(opts JSONRPCOptions) *JSONRPCServer {
+	if opts.MaxBatch <= 0 {
+		opts.MaxBatch = 20
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 1 << 20
+	}
+	return &JSONRPCServer{opts: opts, methods: map[string]RPCMethod{}}
+}
+
+// Register registers the method with the name, replacing the method
+// previously registered with the name, if any.
+func (s *JSONRPCServer) Register(name string, method RPCMethod) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.methods[name] = method
+}
+
+// RegisterRoute registers a method dispatching the calls to the route of the
+// router the server is mounted on, with the given HTTP method and path, e.g.
+// RegisterRoute("users.get", "GET", "/users/:id"). The params of the calls
+// must be an object: its members named after the path parameters fill the
+// path, and the other members are sent as the query string of GET, HEAD and
+// DELETE requests, or as the JSON body of the other requests. The calls run
+// the middleware of the route, with the headers of the JSON-RPC request.
+func (s *JSONRPCServer) RegisterRoute(name, method, path string) {
+	s.Register(name, func(ctx context.Context, req *Request, params json.RawMessage) (interface{}, error) {
+		s.mu.RLock()
+		router := s.router
+		s.mu.RUnlock()
+		if router == nil {
+			return nil, fmt.Errorf("jsonrest: JSON-RPC server is not mounted")
+		}
+
+		args := map[string]json.RawMessage{}
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &args); err != nil {
+				return nil, BadRequest("params must be an object")
+			}
+		}
+		segments := strings.Split(path, "/")
+		for i, seg := range segments {
+			if seg == "" || (seg[0] != ':' && seg[0] != '*') {
+				continue
+			}
+			raw, ok := args[seg[1:]]
+			if !ok {
+				return nil, BadRequest("missing param " + seg[1:])
+			}
+			delete(args, seg[1:])
+			var value interface{}
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return nil, BadRequest("invalid param " + seg[1:])
+			}
+			switch v := value.(type) {
+			case string:
+				segments[i] = url.PathEscape(v)
+			case float64, bool:
+				segments[i] = string(raw)
+			default:
+				return nil, BadRequest("param " + seg[1:] + " must be a string, number or boolean")
+			}
+		}
+
+		br := BatchRequest{Method: method, Path: strings.Join(segments, "/")}
+		switch method {
+		case http.MethodGet, http.MethodHead, http.MethodDelete:
+			query := url.Values{}
+			for k, raw := range args {
+				var v string
+				if err := json.Unmarshal(raw, &v); err != nil {
+					v = string(raw)
+				}
+				query.Set(k, v)
+			}
+			if len(query) > 0 {
+				br.Path += "?" + query.Encode()
+			}
+		default:
+			br.Body, _ = json.Marshal(args)
+		}
+
+		res := router.serveBatchRequest(req.Raw(), br)
+		if res.Status >= 400 {
+			return nil, rpcHTTPError(res)
+		}
+		return res.Body, nil
+	})
+}
+
+// Methods returns the sorted names of the registered methods.
+func (s *JSONRPCServer) Methods() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.methods))
+	for name := range s.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Mount registers the POST route of the server at path on the router. The
+// route runs the router's middleware, and the methods registered with
+// RegisterRoute are dispatched through its root router.
+//
+// A call, or a batch of calls, is answered with a 200 status, or a 204 status
+// if it only has notifications. The errors returned by the methods are mapped
+// to JSON-RPC errors by their status: 400 and 422 errors to invalid params
+// (-32602), 500 errors to internal errors (-32603), and other errors to
+// server errors (-32000). The data of the error carries the status, code and
+// details of *HTTPError values:
+//
+//	{"jsonrpc": "2.0", "id": 1, "error": {"code": -32602, "message": "name is required", "data": {"status": 422, "code": "unprocessable_entity"}}}
+//
+// Internal errors are obfuscated as by the router.
+func (s *JSONRPCServer) Mount(r *Router, path string, routeOpts ...RouteOption) {
+	s.mu.Lock()
+	s.router = r.root()
+	s.mu.Unlock()
+	r.Post(path, func(ctx context.Context, req *Request) (interface{}, error) {
+		if req.Raw().Body == nil {
+			return rpcErrorResponse(nil, RPCInvalidRequest, "missing request body"), nil
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(req.Raw().Body, s.opts.MaxBodySize+1))
+		if err != nil {
+			return nil, BadRequest("cannot read request body").Wrap(err)
+		}
+		if int64(len(body)) > s.opts.MaxBodySize {
+			return nil, errBodyTooLarge()
+		}
+		body = []byte(strings.TrimSpace(string(body)))
+		if !json.Valid(body) {
+			return rpcErrorResponse(nil, RPCParseError, "parse error"), nil
+		}
+
+		if len(body) == 0 || body[0] != '[' {
+			if res := s.call(ctx, req, body); res != nil {
+				return res, nil
+			}
+			return Response{StatusCode: http.StatusNoContent}, nil
+		}
+		var calls []json.RawMessage
+		json.Unmarshal(body, &calls)
+		if len(calls) == 0 {
+			return rpcErrorResponse(nil, RPCInvalidRequest, "empty batch"), nil
+		}
+		if len(calls) > s.opts.MaxBatch {
+			return rpcErrorResponse(nil, RPCInvalidRequest, fmt.Sprintf("batch exceeds the maximum of %d calls", s.opts.MaxBatch)), nil
+		}
+		responses := []*rpcResponse{}
+		for _, call := range calls {
+			if res := s.call(ctx, req, call); res != nil {
+				responses = append(responses, res)
+			}
+		}
+		if len(responses) == 0 {
+			return Response{StatusCode: http.StatusNoContent}, nil
+		}
+		return responses, nil
+	}, routeOpts...)
+}
+
+// rpcResponse is a JSON-RPC response.
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError is a JSON-RPC error.
+type rpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func rpcErrorResponse(id json.RawMessage, code int, message string) *rpcResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &rpcResponse{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: code, Message: message}}
+}
+
+// call runs the JSON-RPC call, and returns its response, or nil if it is a
+// notification.
+func (s *JSONRPCServer) call(ctx context.Context, req *Request, raw json.RawMessage) *rpcResponse {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &members); err != nil {
+		return rpcErrorResponse(nil, RPCInvalidRequest, "invalid request")
+	}
+	id, hasID := members["id"]
+	if hasID {
+		var v interface{}
+		json.Unmarshal(id, &v)
+		switch v.(type) {
+		case string, float64, nil:
+		default:
+			return rpcErrorResponse(nil, RPCInvalidRequest, "invalid request id")
+		}
+	}
+	var version, name string
+	if json.Unmarshal(members["jsonrpc"], &version) != nil || version != "2.0" ||
+		json.Unmarshal(members["method"], &name) != nil || name == "" {
+		return rpcErrorResponse(id, RPCInvalidRequest, "invalid request")
+	}
+	params := members["params"]
+	if len(params) > 0 && params[0] != '{' && params[0] != '[' {
+		return rpcErrorResponse(id, RPCInvalidParams, "params must be an object or an array")
+	}
+
+	s.mu.RLock()
+	method := s.methods[name]
+	s.mu.RUnlock()
+	var res *rpcResponse
+	if method == nil {
+		res = rpcErrorResponse(id, RPCMethodNotFound, "method not found")
+	} else if result, err := method(ctx, req, params); err != nil {
+		res = &rpcResponse{JSONRPC: "2.0", ID: id, Error: s.rpcError(req, err)}
+	} else {
+		if result == nil {
+			result = json.RawMessage("null")
+		}
+		res = &rpcResponse{JSONRPC: "2.0", ID: id, Result: result}
+	}
+	if !hasID {
+		return nil
+	}
+	return res
+}
+
+// rpcError maps an error returned by a method to a JSON-RPC error.
+func (s *JSONRPCServer) rpcError(req *Request, err error) *rpcError {
+	r := s.router
+	dump := r.DumpErrors || (r.dumpErrors != nil && r.dumpErrors(req.Raw())) || captureError(req.Raw())
+	httpErr := translateError(err, dump)
+	status := httpErr.StatusCode()
+	code := RPCServerError
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		code = RPCInvalidParams
+	case http.StatusInternalServerError:
+		code = RPCInternalError
+	}
+	e, ok := httpErr.(*HTTPError)
+	if !ok {
+		return &rpcError{Code: code, Message: http.StatusText(status), Data: httpErr}
+	}
+	return &rpcError{Code: code, Message: e.Message, Data: struct {
+		Status  int      `json:"status"`
+		Code    string   `json:"code"`
+		Details []string `json:"details,omitempty"`
+	}{status, e.Code, e.Details}}
+}
+
+// rpcHTTPError decodes the error response of a route, rendered as an error
+// envelope or as problem details.
+func rpcHTTPError(res BatchResponse) *HTTPError {
+	var body struct {
+		Error struct {
+			Code    string   `json:"code"`
+			Message string   `json:"message"`
+			Details []string `json:"details"`
+		} `json:"error"`
+		Detail  string   `json:"detail"`
+		Code    string   `json:"code"`
+		Details []string `json:"details"`
+	}
+	json.Unmarshal(res.Body, &body)
+	if body.Error.Code == "" {
+		body.Error.Code, body.Error.Message, body.Error.Details = body.Code, body.Detail, body.Details
+	}
+	if body.Error.Message == "" {
+		body.Error.Message = http.StatusText(res.Status)
+	}
+	err := Error(res.Status, body.Error.Code, body.Error.Message)
+	err.Details = body.Error.Details
+	return err
+}
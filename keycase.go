@@ -0,0 +1,174 @@
+package jsonrest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// A KeyCase is a naming convention of JSON object keys.
+type KeyCase int
+
+// The key cases supported by WithJSONKeyCase.
+const (
+	// SnakeCase keys are lower case words separated by underscores, e.g.
+	// "user_id".
+	SnakeCase KeyCase = iota + 1
+
+	// CamelCase keys are words starting with an upper case letter, except
+	// the first one, e.g. "userId".
+	CamelCase
+)
+
+// WithJSONKeyCase is an Option available for NewRouter and Group to convert
+// the object keys of the successful responses to the key case, e.g. so that
+// structs tagged with snake_case keys can be served to clients expecting
+// camelCase. Leading underscores, as in "_links", are kept.
+func WithJSONKeyCase(c KeyCase) Option {
+	return func(r *Router) {
+		r.responseKeyCase = c
+	}
+}
+
+// WithRequestJSONKeyCase is an Option available for NewRouter and Group to
+// convert the object keys of the request bodies bound with BindBody to the
+// key case, e.g. to accept camelCase keys for structs tagged with snake_case
+// keys.
+func WithRequestJSONKeyCase(c KeyCase) Option {
+	return func(r *Router) {
+		r.requestKeyCase = c
+	}
+}
+
+// keyCaseSender wraps send to convert the keys of the response.
+func (r *Router) keyCaseSender(send func(http.ResponseWriter, int, interface{}), c KeyCase, req *http.Request) func(http.ResponseWriter, int, interface{}) {
+	return func(w http.ResponseWriter, status int, v interface{}) {
+		if v == nil {
+			send(w, status, v)
+			return
+		}
+		b, err := json.Marshal(v)
+		if err == nil {
+			b, err = convertKeys(b, c)
+		}
+		if err != nil {
+			r.sendError(w, req, err)
+			return
+		}
+		send(w, status, json.RawMessage(b))
+	}
+}
+
+// convertRequestKeys replaces the request body with one whose keys are
+// converted to the key case.
+func convertRequestKeys(req *http.Request, c KeyCase) error {
+	b, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	req.Body.Close()
+	if converted, err := convertKeys(b, c); err == nil {
+		b = converted
+	}
+	// Malformed bodies are left as-is, to be reported when decoded.
+	req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return nil
+}
+
+// convertKeys returns the JSON value with its object keys converted to the
+// key case.
+func convertKeys(b []byte, c KeyCase) ([]byte, error) {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || (b[0] != '{' && b[0] != '[') {
+		return b, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(b[0])
+	for n := 0; dec.More(); n++ {
+		if n > 0 {
+			buf.WriteByte(',')
+		}
+		if b[0] == '{' {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, _ := tok.(string)
+			k, _ := json.Marshal(convertKey(key, c))
+			buf.Write(k)
+			buf.WriteByte(':')
+		}
+		var val json.RawMessage
+		if err := dec.Decode(&val); err != nil {
+			return nil, err
+		}
+		converted, err := convertKeys(val, c)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(converted)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	if b[0] == '{' {
+		buf.WriteByte('}')
+	} else {
+		buf.WriteByte(']')
+	}
+	return buf.Bytes(), nil
+}
+
+// convertKey converts the key to the key case.
+func convertKey(key string, c KeyCase) string {
+	trimmed := strings.TrimLeft(key, "_")
+	words := splitWords(trimmed)
+	if len(words) == 0 {
+		return key
+	}
+	var sb strings.Builder
+	sb.WriteString(key[:len(key)-len(trimmed)])
+	for i, w := range words {
+		w = strings.ToLower(w)
+		switch {
+		case c == SnakeCase && i > 0:
+			sb.WriteByte('_')
+		case c == CamelCase && i > 0:
+			r := []rune(w)
+			r[0] = unicode.ToUpper(r[0])
+			w = string(r)
+		}
+		sb.WriteString(w)
+	}
+	return sb.String()
+}
+
+// splitWords splits a key into words, on underscores, hyphens and case
+// changes, e.g. "HTTPServer_id" into "HTTP", "Server" and "id".
+func splitWords(s string) []string {
+	var words []string
+	r := []rune(s)
+	start := 0
+	for i := 0; i <= len(r); i++ {
+		switch {
+		case i == len(r) || r[i] == '_' || r[i] == '-':
+			if i > start {
+				words = append(words, string(r[start:i]))
+			}
+			start = i + 1
+		case i > start && unicode.IsUpper(r[i]) &&
+			(!unicode.IsUpper(r[i-1]) || (i+1 < len(r) && unicode.IsLower(r[i+1]))):
+			words = append(words, string(r[start:i]))
+			start = i
+		}
+	}
+	return words
+}
@@ -0,0 +1,34 @@
+package jsonrest
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// WithURLLimits is an Option available for NewRouter to set the maximum length
+// in bytes of the escaped request path and of the raw query string. Requests
+// exceeding either limit are rejected with a 414 error before being routed. A
+// limit of 0 disables the check.
+func WithURLLimits(maxPath, maxQuery int) Option {
+	return func(r *Router) {
+		r.maxPathLength, r.maxQueryLength = maxPath, maxQuery
+	}
+}
+
+// checkURLLimits returns an error if the request URL exceeds the configured
+// limits.
+func (r *Router) checkURLLimits(req *http.Request) error {
+	if n := len(req.URL.EscapedPath()); r.maxPathLength > 0 && n > r.maxPathLength {
+		return uriTooLong("path", r.maxPathLength)
+	}
+	if n := len(req.URL.RawQuery); r.maxQueryLength > 0 && n > r.maxQueryLength {
+		return uriTooLong("query string", r.maxQueryLength)
+	}
+	return nil
+}
+
+// uriTooLong returns a 414 error for the part of the URL exceeding max bytes.
+func uriTooLong(part string, max int) *HTTPError {
+	return Error(http.StatusRequestURITooLong, "uri_too_long",
+		"request "+part+" exceeds "+strconv.Itoa(max)+" bytes")
+}
@@ -0,0 +1,180 @@
+package jsonrest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// A Link is a hypermedia link of a response to a related resource.
+type Link struct {
+	Rel  string
+	Href string
+}
+
+// Links is a list of links, rendered in JSON responses as an object mapping
+// each relation to its href, e.g. {"self": {"href": "/users/1"}}.
+type Links []Link
+
+// MarshalJSON implements the json.Marshaler interface, preserving the order of
+// the links.
+func (l Links) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, link := range l {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		rel, _ := json.Marshal(link.Rel)
+		href, _ := json.Marshal(link.Href)
+		buf.Write(rel)
+		buf.WriteString(`:{"href":`)
+		buf.Write(href)
+		buf.WriteByte('}')
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// header returns the value of the Link header (RFC 5988) of the links.
+func (l Links) header() string {
+	values := make([]string, len(l))
+	for i, link := range l {
+		values[i] = "<" + link.Href + `>; rel="` + link.Rel + `"`
+	}
+	return strings.Join(values, ", ")
+}
+
+// A LinkMode tells where the links of a response are rendered.
+type LinkMode int
+
+// Link modes, which may be combined.
+const (
+	// LinksInHeader renders the links in the Link header.
+	LinksInHeader LinkMode = 1 << iota
+	// LinksInBody renders the links in the _links field of JSON object
+	// responses.
+	LinksInBody
+)
+
+// WithLinks is an Option available for NewRouter and Group to set where the
+// links added to responses are rendered. By default, they are rendered both in
+// the Link header and in the response body.
+func WithLinks(mode LinkMode) Option {
+	return func(r *Router) {
+		r.linkMode = mode
+	}
+}
+
+// Name is a RouteOption that names the route, so that its URL can be built by
+// Router.URL and Request.AddRouteLink. Route names must be unique.
+func Name(name string) RouteOption {
+	return func(r *Route) {
+		r.Name = name
+	}
+}
+
+// URL returns the path of the named route, replacing its parameters with the
+// values given as key-value pairs, e.g. r.URL("user", "id", "42"). Parameter
+// values are escaped, except the catch-all one.
+func (r *Router) URL(name string, params ...string) (string, error) {
+	root := r.root()
+	root.routesMu.RLock()
+	route, ok := root.namedRoutes[name]
+	root.routesMu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("jsonrest: unknown route name %q", name)
+	}
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("jsonrest: odd number of parameters for route %q", name)
+	}
+	values := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		values[params[i]] = params[i+1]
+	}
+
+	segments := strings.Split(route.Path, "/")
+	for i, seg := range segments {
+		if len(seg) == 0 || (seg[0] != ':' && seg[0] != '*') {
+			continue
+		}
+		v, ok := values[seg[1:]]
+		if !ok {
+			return "", fmt.Errorf("jsonrest: missing parameter %q for route %q", seg[1:], name)
+		}
+		if seg[0] == '*' {
+			segments[i] = strings.TrimPrefix(v, "/")
+		} else {
+			segments[i] = url.PathEscape(v)
+		}
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// AddLink adds a link to the response, replacing the link with the same
+// relation, if any.
+func (r *Request) AddLink(rel, href string) {
+	for i, link := range r.links {
+		if link.Rel == rel {
+			r.links[i].Href = href
+			return
+		}
+	}
+	r.links = append(r.links, Link{Rel: rel, Href: href})
+}
+
+// AddRouteLink adds a link to the URL of the named route to the response. See
+// Router.URL.
+func (r *Request) AddRouteLink(rel, name string, params ...string) error {
+	href, err := r.router.URL(name, params...)
+	if err != nil {
+		return err
+	}
+	r.AddLink(rel, href)
+	return nil
+}
+
+// Links returns the links added to the response.
+func (r *Request) Links() Links {
+	return r.links
+}
+
+// linkSender sets the Link header and wraps send to add the links to the
+// response body, according to the router's link mode.
+func (r *Router) linkSender(send func(http.ResponseWriter, int, interface{}), w http.ResponseWriter, links Links, req *http.Request) func(http.ResponseWriter, int, interface{}) {
+	mode := r.linkMode
+	if mode == 0 {
+		mode = LinksInHeader | LinksInBody
+	}
+	if mode&LinksInHeader != 0 {
+		w.Header().Add("Link", links.header())
+	}
+	if mode&LinksInBody == 0 {
+		return send
+	}
+	return func(w http.ResponseWriter, status int, v interface{}) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			r.sendError(w, req, err)
+			return
+		}
+		b = bytes.TrimSpace(b)
+		if len(b) < 2 || b[0] != '{' {
+			send(w, status, v)
+			return
+		}
+		l, _ := links.MarshalJSON()
+		out := make([]byte, 0, len(b)+len(l)+10)
+		out = append(out, b[:len(b)-1]...)
+		if len(b) > 2 {
+			out = append(out, ',')
+		}
+		out = append(out, `"_links":`...)
+		out = append(out, l...)
+		out = append(out, '}')
+		send(w, status, json.RawMessage(out))
+	}
+}
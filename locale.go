@@ -0,0 +1,159 @@
+package jsonrest
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WithLocales is an Option available for NewRouter and Group to set the
+// locales supported by the API, e.g. "en-US", "fr-FR". The first one is the
+// default locale. See Request.Locale.
+func WithLocales(supported ...string) Option {
+	return func(r *Router) {
+		r.locales = supported
+	}
+}
+
+// Locale returns the supported locale best matching the request's
+// Accept-Language header, or the default locale. It returns an empty string
+// if the router has no supported locales.
+func (r *Request) Locale() string {
+	if r.router == nil {
+		return ""
+	}
+	return negotiateLocale(r.req.Header.Get("Accept-Language"), r.router.locales)
+}
+
+// AcceptedLanguages returns the language ranges of the request's
+// Accept-Language header, lowercased and sorted by decreasing preference,
+// without the ranges with a zero quality.
+func (r *Request) AcceptedLanguages() []string {
+	return acceptedLanguages(r.req.Header.Get("Accept-Language"))
+}
+
+// NegotiateLocale returns the locale of supported best matching the request's
+// Accept-Language header, or the first one. Unlike Locale, it does not depend
+// on the locales of the router, e.g. to pick among the languages of a
+// resource.
+func (r *Request) NegotiateLocale(supported ...string) string {
+	return negotiateLocale(r.req.Header.Get("Accept-Language"), supported)
+}
+
+type localeKey struct{}
+
+// LocaleFromContext returns the locale of the request whose endpoint or error
+// localizer was called with the context, as returned by Request.Locale, or an
+// empty string.
+func LocaleFromContext(ctx context.Context) string {
+	if locale, ok := ctx.Value(localeKey{}).(string); ok {
+		return locale
+	}
+	if r := RequestFromContext(ctx); r != nil {
+		return r.Locale()
+	}
+	return ""
+}
+
+// An ErrorLocalizer returns the message of an error in the locale of the
+// request, available through LocaleFromContext, given the error code and the
+// default message. It returns the default message if it has no translation.
+type ErrorLocalizer func(ctx context.Context, code, defaultMsg string) string
+
+// WithErrorLocalizer is an Option available for NewRouter and Group to
+// translate the messages of the errors sent to the clients, while their codes
+// stay stable for machines. The locale is negotiated among the locales of
+// WithLocales.
+func WithErrorLocalizer(localizer ErrorLocalizer) Option {
+	return func(r *Router) {
+		r.errorLocalizer = localizer
+	}
+}
+
+// localizeError returns a copy of err with its message translated by the
+// router's error localizer, if any.
+func (r *Router) localizeError(req *http.Request, err HTTPErrorResponse) HTTPErrorResponse {
+	httpErr, ok := err.(*HTTPError)
+	if !ok || r.errorLocalizer == nil {
+		return err
+	}
+	locale := negotiateLocale(req.Header.Get("Accept-Language"), r.locales)
+	ctx := context.WithValue(req.Context(), localeKey{}, locale)
+	e := *httpErr // shallow copy
+	e.Message = r.errorLocalizer(ctx, e.Code, e.Message)
+	return &e
+}
+
+// negotiateLocale returns the supported locale best matching the
+// Accept-Language header value. A language range matches a locale exactly or
+// by its primary language, e.g. "fr-CA" matches "fr-FR" if no better match
+// exists.
+func negotiateLocale(header string, supported []string) string {
+	if len(supported) == 0 {
+		return ""
+	}
+	for _, tag := range acceptedLanguages(header) {
+		if tag == "*" {
+			return supported[0]
+		}
+		for _, s := range supported {
+			if strings.ToLower(s) == tag {
+				return s
+			}
+		}
+		for _, s := range supported {
+			if primaryLanguage(s) == primaryLanguage(tag) {
+				return s
+			}
+		}
+	}
+	return supported[0]
+}
+
+// acceptedLanguages returns the lowercased language ranges of the
+// Accept-Language header value, sorted by decreasing quality, without the
+// ranges with a zero quality.
+func acceptedLanguages(header string) []string {
+	type languageRange struct {
+		tag string
+		q   float64
+	}
+	var ranges []languageRange
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, languageRange{tag, q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	tags := make([]string, len(ranges))
+	for i, lr := range ranges {
+		tags[i] = lr.tag
+	}
+	return tags
+}
+
+// primaryLanguage returns the lowercased primary language subtag of the
+// language tag, e.g. "en" for "en-US".
+func primaryLanguage(tag string) string {
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	return strings.ToLower(tag)
+}
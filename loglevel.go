@@ -0,0 +1,176 @@
+package jsonrest
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// A LogLevel is the verbosity of request logs.
+type LogLevel int
+
+// Log levels, from the most to the least verbose.
+const (
+	LevelDebug LogLevel = iota - 1
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String returns the name of the level, e.g. "DEBUG".
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// A LogLevelRule sets the log level of the requests matching all its non-empty
+// criteria.
+type LogLevelRule struct {
+	// Header and HeaderValue match the requests with the header value, e.g.
+	// a debug token sent by a customer.
+	Header      string
+	HeaderValue string
+
+	// Principal matches the requests of the caller, see
+	// Request.Principal.
+	Principal string
+
+	// Route matches the requests of the route, given as its pattern (e.g.
+	// "/users/:id") optionally prefixed with the method (e.g.
+	// "GET /users/:id").
+	Route string
+
+	Level LogLevel
+}
+
+// matches reports whether the request matches the rule.
+func (rule *LogLevelRule) matches(req *Request) bool {
+	if rule.Header != "" && req.Header(rule.Header) != rule.HeaderValue {
+		return false
+	}
+	if rule.Principal != "" && req.Principal() != rule.Principal {
+		return false
+	}
+	if rule.Route != "" {
+		route := rule.Route
+		if i := strings.IndexByte(route, ' '); i >= 0 {
+			if !strings.EqualFold(route[:i], req.Method()) {
+				return false
+			}
+			route = strings.TrimSpace(route[i+1:])
+		}
+		if route != req.Route() {
+			return false
+		}
+	}
+	return true
+}
+
+// LogLevels holds the log levels of requests, which can be changed at runtime,
+// e.g. to debug the traffic of one customer in production without enabling
+// debug logs globally. It is safe for concurrent use.
+type LogLevels struct {
+	logger *log.Logger
+
+	mu    sync.RWMutex
+	level LogLevel
+	rules []LogLevelRule
+}
+
+// NewLogLevels returns log levels with the default level, writing to the
+// logger (the standard logger if nil).
+func NewLogLevels(level LogLevel, logger *log.Logger) *LogLevels {
+	return &LogLevels{level: level, logger: logger}
+}
+
+// SetLevel sets the default level of requests.
+func (l *LogLevels) SetLevel(level LogLevel) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level = level
+}
+
+// SetRules replaces the rules elevating the log level of matching requests.
+// The first matching rule applies.
+func (l *LogLevels) SetRules(rules ...LogLevelRule) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rules = append([]LogLevelRule(nil), rules...)
+}
+
+// levelOf returns the log level of the request.
+func (l *LogLevels) levelOf(req *Request) LogLevel {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for i := range l.rules {
+		if l.rules[i].matches(req) {
+			return l.rules[i].Level
+		}
+	}
+	return l.level
+}
+
+// WithLogLevels is an Option available for NewRouter and Group to set the log
+// levels of requests, used by Request.Logf.
+func WithLogLevels(levels *LogLevels) Option {
+	return func(r *Router) {
+		r.logLevels = levels
+	}
+}
+
+// LogLevel returns the log level of the request, evaluated when called so that
+// rules on the principal apply once it is set. It is LevelInfo if the router
+// has no log levels.
+func (r *Request) LogLevel() LogLevel {
+	if r.router == nil || r.router.logLevels == nil {
+		return LevelInfo
+	}
+	return r.router.logLevels.levelOf(r)
+}
+
+// Logf logs the message if the level is enabled for the request. The message
+// is prefixed with the level, the method and path of the request, and its ID
+// if any.
+func (r *Request) Logf(level LogLevel, format string, args ...interface{}) {
+	if level < r.LogLevel() {
+		return
+	}
+	prefix := fmt.Sprintf("[%v] %s %s", level, r.Method(), r.URL().Path)
+	if id := RequestIDFromContext(r.req.Context()); id != "" {
+		prefix += " request_id=" + id
+	}
+	redacted := make([]interface{}, len(args))
+	for i, arg := range args {
+		redacted[i] = redactForLog(arg)
+	}
+	msg := prefix + ": " + fmt.Sprintf(format, redacted...)
+
+	var logger *log.Logger
+	if r.router != nil && r.router.logLevels != nil {
+		logger = r.router.logLevels.logger
+	}
+	if logger == nil {
+		log.Print(msg)
+		return
+	}
+	logger.Print(msg)
+}
+
+// Logf logs the message with the request of the context, see Request.Logf. It
+// is a no-op if the context has no request.
+func Logf(ctx context.Context, level LogLevel, format string, args ...interface{}) {
+	if req := RequestFromContext(ctx); req != nil {
+		req.Logf(level, format, args...)
+	}
+}
@@ -0,0 +1,101 @@
+package jsonrest
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Param is a single URL parameter, consisting of a key and a value.
+type Param = httprouter.Param
+
+// Params is a Param-slice, as returned by a Matcher.
+type Params = httprouter.Params
+
+// Handle is a function that can be registered to a Matcher to handle requests.
+// The third parameter holds the values of the URL parameters.
+type Handle = func(http.ResponseWriter, *http.Request, Params)
+
+// A Matcher is the routing backend of a Router: it matches incoming requests
+// to the handles registered for a method and path. The syntax of the path, and
+// which paths may conflict with each other, is defined by the matcher.
+type Matcher interface {
+	// ServeHTTP dispatches the request to the handle whose method and path
+	// match it. Unmatched requests are served as described by the matcher's
+	// MatcherConfig.
+	http.Handler
+
+	// Handle registers the handle for the given method and path. It panics if
+	// the path is invalid or conflicts with a registered route.
+	Handle(method, path string, handle Handle)
+
+	// Lookup returns the handle and URL parameters of the route matching the
+	// method and path. The handle is nil if no route matches.
+	Lookup(method, path string) (Handle, Params)
+}
+
+// MatcherConfig configures how a Matcher serves requests for which no route
+// matches.
+type MatcherConfig struct {
+	// NotFound is called when no route matches.
+	NotFound http.Handler
+
+	// MethodNotAllowed is called when a route matches the path but not the
+	// method, if HandleMethodNotAllowed is set.
+	MethodNotAllowed http.Handler
+
+	// RedirectTrailingSlash, if set, redirects to the route with (or without)
+	// a trailing slash when only that route exists.
+	RedirectTrailingSlash bool
+
+	// RedirectFixedPath, if set, redirects to a cleaned, case-insensitive match
+	// of the request path.
+	RedirectFixedPath bool
+
+	// HandleMethodNotAllowed, if set, calls MethodNotAllowed when a route
+	// matches the path but not the method. Otherwise NotFound is called.
+	HandleMethodNotAllowed bool
+}
+
+// NewMatcherFunc creates a Matcher for the given configuration.
+type NewMatcherFunc func(MatcherConfig) Matcher
+
+// WithMatcher is an Option available for NewRouter to replace the default
+// routing backend, which is based on github.com/julienschmidt/httprouter. It
+// has no effect on groups.
+func WithMatcher(fn NewMatcherFunc) Option {
+	return func(r *Router) {
+		r.newMatcher = fn
+	}
+}
+
+// httpRouterMatcher is the default Matcher, based on httprouter.
+type httpRouterMatcher struct {
+	*httprouter.Router
+}
+
+// newHTTPRouterMatcher creates a Matcher based on httprouter. Paths use the
+// httprouter syntax, e.g. /users/:id or /files/*filepath.
+func newHTTPRouterMatcher(c MatcherConfig) Matcher {
+	hr := httprouter.New()
+	hr.NotFound = c.NotFound
+	hr.MethodNotAllowed = c.MethodNotAllowed
+	hr.RedirectTrailingSlash = c.RedirectTrailingSlash
+	hr.RedirectFixedPath = c.RedirectFixedPath
+	hr.HandleMethodNotAllowed = c.HandleMethodNotAllowed
+	return httpRouterMatcher{hr}
+}
+
+// Handle implements the Matcher interface.
+func (m httpRouterMatcher) Handle(method, path string, handle Handle) {
+	m.Router.Handle(method, path, handle)
+}
+
+// Lookup implements the Matcher interface.
+func (m httpRouterMatcher) Lookup(method, path string) (Handle, Params) {
+	h, ps, _ := m.Router.Lookup(method, path)
+	if h == nil {
+		return nil, nil
+	}
+	return h, ps
+}
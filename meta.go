@@ -0,0 +1,24 @@
+package jsonrest
+
+import "context"
+
+type requestKey struct{}
+
+// RequestFromContext returns the Request whose endpoint was called with the
+// context, or nil. It allows code which only has the context to reach the
+// request's meta values.
+func RequestFromContext(ctx context.Context) *Request {
+	r, _ := ctx.Value(requestKey{}).(*Request)
+	return r
+}
+
+// MetaFromContext returns the meta value for the key of the request whose
+// endpoint was called with the context, e.g. a value set by a middleware. It
+// returns nil if the context does not belong to a request.
+func MetaFromContext(ctx context.Context, key interface{}) interface{} {
+	r := RequestFromContext(ctx)
+	if r == nil {
+		return nil
+	}
+	return r.Get(key)
+}
@@ -0,0 +1,80 @@
+package jsonrest
+
+import (
+	"context"
+	"mime"
+	"strings"
+)
+
+// A RequestPredicate reports whether a request matches a condition, e.g. to
+// apply a middleware conditionally with Unless or Only.
+type RequestPredicate func(r *Request) bool
+
+// Unless returns a middleware applying m to the requests not matching skip.
+// For example, to skip authentication for health checks:
+//
+//	r.Use(jsonrest.Unless(authMiddleware, jsonrest.Paths("/health", "/ready")))
+func Unless(m Middleware, skip RequestPredicate) Middleware {
+	return func(next Endpoint) Endpoint {
+		wrapped := m(next)
+		return func(ctx context.Context, req *Request) (interface{}, error) {
+			if skip(req) {
+				return next(ctx, req)
+			}
+			return wrapped(ctx, req)
+		}
+	}
+}
+
+// Only returns a middleware applying m to the requests matching match.
+func Only(m Middleware, match RequestPredicate) Middleware {
+	return Unless(m, func(r *Request) bool { return !match(r) })
+}
+
+// Paths returns a predicate matching the requests whose URL path or route
+// pattern is one of paths. A path ending with "*" matches the paths starting
+// with the rest of it.
+func Paths(paths ...string) RequestPredicate {
+	return func(r *Request) bool {
+		path := r.URL().Path
+		for _, p := range paths {
+			if prefix := strings.TrimSuffix(p, "*"); prefix != p {
+				if strings.HasPrefix(path, prefix) {
+					return true
+				}
+			} else if p == path || p == r.Route() {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Methods returns a predicate matching the requests with one of the methods.
+func Methods(methods ...string) RequestPredicate {
+	return func(r *Request) bool {
+		for _, m := range methods {
+			if strings.EqualFold(m, r.Method()) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ContentTypes returns a predicate matching the requests whose Content-Type
+// media type is one of types, ignoring its parameters.
+func ContentTypes(types ...string) RequestPredicate {
+	return func(r *Request) bool {
+		mediaType, _, err := mime.ParseMediaType(r.Header("Content-Type"))
+		if err != nil {
+			return false
+		}
+		for _, t := range types {
+			if strings.EqualFold(t, mediaType) {
+				return true
+			}
+		}
+		return false
+	}
+}
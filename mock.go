@@ -0,0 +1,54 @@
+package jsonrest
+
+import "context"
+
+// ResponseExample is a RouteOption setting the example response of the route,
+// served by mock routes (see Router.Mock and WithMockResponses). It can be a
+// Response to set the status code of the example, e.g.:
+//
+//	jsonrest.ResponseExample(jsonrest.Response{StatusCode: 201, Body: Order{ID: 42}})
+func ResponseExample(v interface{}) RouteOption {
+	return func(r *Route) {
+		r.responseExample = v
+	}
+}
+
+// Mock registers a mock route, declared by its options alone, serving its
+// example response (see ResponseExample), or else an example of its response
+// schema (see ResponseSchema and Schema.Example), or else an empty response.
+// Requests are still validated against the route's request schema, so that a
+// mock API can be served from the same declarations as the real one. Mock
+// responses have an X-Mock-Response header, and the route is listed as a mock
+// by RegisteredRoutes.
+func (r *Router) Mock(method, path string, opts ...RouteOption) {
+	opts = append(opts, func(route *Route) { route.Mock = true })
+	r.Handle(method, path, nil, opts...)
+}
+
+// WithMockResponses is an Option available for NewRouter and Group to serve
+// the example responses of the routes declaring one, or a response schema,
+// instead of calling their endpoints, as if they were registered with
+// Router.Mock. It allows frontend teams to run a realistic mock API built
+// from the same route declarations as the real one, e.g. behind a flag:
+//
+//	r := jsonrest.NewRouter(jsonrest.WithMockResponses())
+//	registerRoutes(r)
+func WithMockResponses() Option {
+	return func(r *Router) {
+		r.mockResponses = true
+	}
+}
+
+// mockEndpoint returns the endpoint of a mock route.
+func mockEndpoint(route *Route) Endpoint {
+	return func(ctx context.Context, req *Request) (interface{}, error) {
+		req.SetResponseHeader("X-Mock-Response", "true")
+		if route.responseExample != nil {
+			return route.responseExample, nil
+		}
+		if route.ResponseSchema != nil {
+			return route.ResponseSchema.Example(), nil
+		}
+		return nil, nil
+	}
+}
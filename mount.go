@@ -0,0 +1,50 @@
+package jsonrest
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// mountMethods are the methods routed to mounted handlers.
+var mountMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+type mountPrefixKey struct{}
+
+// Mount routes the requests under prefix to the handler, after applying the
+// router's middleware. Like http.StripPrefix, the prefix is removed from the
+// URL path seen by the handler; the stripped prefix is available through
+// MountPrefix, so that the handler can generate correct links.
+func (r *Router) Mount(prefix string, h http.Handler) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	e := func(_ context.Context, req *Request) (interface{}, error) {
+		return ServeHandler(http.HandlerFunc(func(w http.ResponseWriter, original *http.Request) {
+			stripped := req.StrippedPrefix()
+			ctx := context.WithValue(original.Context(), mountPrefixKey{}, MountPrefix(original)+stripped)
+			r2 := original.WithContext(ctx)
+			u := *original.URL
+			u.Path = req.RemainingPath()
+			u.RawPath = strings.TrimPrefix(u.RawPath, stripped)
+			r2.URL = &u
+			h.ServeHTTP(w, r2)
+		})), nil
+	}
+	for _, method := range mountMethods {
+		r.Handle(method, prefix+"/*mountpath", e)
+	}
+}
+
+// MountPrefix returns the prefix stripped from the request path by Mount, or
+// an empty string if the request was not routed to a mounted handler. The
+// original path is MountPrefix(req) + req.URL.Path.
+func MountPrefix(req *http.Request) string {
+	prefix, _ := req.Context().Value(mountPrefixKey{}).(string)
+	return prefix
+}
@@ -0,0 +1,105 @@
+package jsonrest
+
+import (
+	"context"
+	"crypto/x509"
+)
+
+// PeerCertificates returns the certificate chain presented by the client over
+// TLS, leaf first, or nil if the request was not made over TLS or the client
+// sent no certificate. Whether the chain was verified depends on the
+// ClientAuth setting of the server's tls.Config; ClientCertMiddleware only
+// accepts verified chains.
+func (r *Request) PeerCertificates() []*x509.Certificate {
+	if r.req.TLS == nil {
+		return nil
+	}
+	return r.req.TLS.PeerCertificates
+}
+
+// ClientCertOptions configures ClientCertMiddleware.
+type ClientCertOptions struct {
+	// CommonNames and SANs are the allowed subject common names and
+	// subject alternative names (DNS names, email addresses and URIs) of
+	// the client certificates. A certificate is allowed if it matches
+	// either list. If both are empty, all verified certificates are
+	// allowed.
+	CommonNames []string
+	SANs        []string
+
+	// Verify, if set, is called with the verified chain of allowed
+	// certificates, leaf first, for additional checks, e.g. against a
+	// revocation list. A returned error is sent as the response, so it
+	// should be a 403 error (see Forbidden).
+	Verify func(ctx context.Context, req *Request, chain []*x509.Certificate) error
+}
+
+// ClientCertMiddleware returns a middleware requiring the clients to present a
+// TLS certificate verified by the server, for mutual TLS authentication.
+// Requests without a verified certificate are rejected with a 401 error, and
+// certificates not allowed by the options with a 403 error. The subject
+// common name of the certificate is set as the principal of the request (see
+// Request.Principal).
+//
+// The certificates are verified by the TLS layer, so the server's tls.Config
+// must set ClientCAs and a ClientAuth of at least VerifyClientCertIfGiven:
+//
+//	srv := &http.Server{
+//		Handler: r,
+//		TLSConfig: &tls.Config{
+//			ClientCAs:  pool,
+//			ClientAuth: tls.VerifyClientCertIfGiven,
+//		},
+//	}
+func ClientCertMiddleware(opts ClientCertOptions) Middleware {
+	allowed := make(map[string]bool, len(opts.CommonNames))
+	sans := make(map[string]bool, len(opts.SANs))
+	for _, cn := range opts.CommonNames {
+		allowed[cn] = true
+	}
+	for _, san := range opts.SANs {
+		sans[san] = true
+	}
+
+	return func(next Endpoint) Endpoint {
+		return func(ctx context.Context, req *Request) (interface{}, error) {
+			tls := req.req.TLS
+			if tls == nil || len(tls.VerifiedChains) == 0 || len(tls.VerifiedChains[0]) == 0 {
+				return nil, Unauthorized("client certificate required")
+			}
+			chain := tls.VerifiedChains[0]
+			leaf := chain[0]
+			if (len(allowed) > 0 || len(sans) > 0) && !allowed[leaf.Subject.CommonName] && !matchSANs(leaf, sans) {
+				return nil, Forbidden("client certificate not allowed")
+			}
+			if opts.Verify != nil {
+				if err := opts.Verify(ctx, req, chain); err != nil {
+					return nil, err
+				}
+			}
+			req.SetPrincipal(leaf.Subject.CommonName)
+			return next(ctx, req)
+		}
+	}
+}
+
+// matchSANs reports whether one of the subject alternative names of the
+// certificate is in sans.
+func matchSANs(cert *x509.Certificate, sans map[string]bool) bool {
+	for _, name := range cert.DNSNames {
+		if sans[name] {
+			return true
+		}
+	}
+	for _, email := range cert.EmailAddresses {
+		if sans[email] {
+			return true
+		}
+	}
+	for _, uri := range cert.URIs {
+		if sans[uri.String()] {
+			return true
+		}
+	}
+	return false
+}
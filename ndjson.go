@@ -0,0 +1,107 @@
+package jsonrest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// The buffered output of NDJSON is flushed to the client every
+// ndjsonFlushRows values, or when a value is emitted ndjsonFlushInterval
+// after the last flush.
+const (
+	ndjsonFlushRows     = 1000
+	ndjsonFlushInterval = time.Second
+)
+
+// NDJSON returns an endpoint result streaming the values emitted by fn to the
+// client as JSON Lines (application/x-ndjson), one value per line, e.g. to
+// export large result sets row by row:
+//
+//	return jsonrest.NDJSON(func(ctx context.Context, emit func(v interface{}) error) error {
+//	    for rows.Next() {
+//	        ...
+//	        if err := emit(row); err != nil {
+//	            return err
+//	        }
+//	    }
+//	    return rows.Err()
+//	}), nil
+//
+// The output is buffered and flushed periodically. emit returns an error once
+// the client disconnects or the response cannot be written, which fn should
+// return. If fn returns an error before emitting any value, it is sent as an
+// error response; otherwise the response is cut short and the error logged.
+func NDJSON(fn func(ctx context.Context, emit func(v interface{}) error) error) HandlerResponse {
+	return ServeHandler(ndjsonHandler(fn))
+}
+
+// ndjsonHandler is the handler of the result returned by NDJSON.
+type ndjsonHandler func(ctx context.Context, emit func(v interface{}) error) error
+
+// ServeHTTP implements the http.Handler interface.
+func (fn ndjsonHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	bw := bufferedWriterPool.Get().(*bufio.Writer)
+	bw.Reset(w)
+	defer func() {
+		bw.Reset(nil)
+		bufferedWriterPool.Put(bw)
+	}()
+
+	enc := json.NewEncoder(bw)
+	flusher, _ := w.(http.Flusher)
+	flush := func() error {
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	started := false
+	rows := 0
+	lastFlush := time.Now()
+	emit := func(v interface{}) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !started {
+			w.Header().Set("content-type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		rows++
+		if rows%ndjsonFlushRows == 0 || time.Since(lastFlush) >= ndjsonFlushInterval {
+			lastFlush = time.Now()
+			return flush()
+		}
+		return nil
+	}
+
+	err := fn(ctx, emit)
+	if err != nil && !started {
+		router := &Router{}
+		if request := RequestFromContext(ctx); request != nil && request.router != nil {
+			router = request.router
+		}
+		router.sendError(w, req, err)
+		return
+	}
+	if !started {
+		w.Header().Set("content-type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+	}
+	if err != nil && ctx.Err() == nil {
+		log.Printf("jsonrest: streaming %v: %v", req.RequestURI, err)
+	}
+	_ = flush()
+}
@@ -0,0 +1,459 @@
+package jsonrest
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // registers crypto.SHA256
+	_ "crypto/sha512" // registers crypto.SHA384 and crypto.SHA512
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OIDCOptions configures an OIDCProvider.
+type OIDCOptions struct {
+	// Issuer is the URL of the OpenID Connect provider, e.g.
+	// "https://example.eu.auth0.com/". Its metadata is discovered at
+	// Issuer + "/.well-known/openid-configuration". It is required.
+	Issuer string
+
+	// Audiences are the accepted audiences of the tokens, e.g. the client
+	// ID or the API identifier. A token must be intended for one of them.
+	// It is required.
+	Audiences []string
+
+	// Client fetches the provider metadata and keys. It defaults to an
+	// http.Client with a 10 seconds timeout.
+	Client *http.Client
+
+	// RefreshInterval is how often the keys are refetched, so that rotated
+	// keys are picked up. Tokens signed with an unknown key also trigger a
+	// refetch, at most once a minute. It defaults to 1 hour.
+	RefreshInterval time.Duration
+
+	// Leeway is the clock skew tolerated when checking the expiry of the
+	// tokens. It defaults to 1 minute.
+	Leeway time.Duration
+
+	// Optional indicates if requests without a bearer token are handled
+	// normally by the middleware, without claims, instead of being
+	// rejected with a 401 error.
+	Optional bool
+}
+
+// Claims are the claims of a verified token, as decoded from JSON.
+type Claims map[string]interface{}
+
+// Subject returns the "sub" claim.
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+// String returns the claim if it is a string, or an empty string.
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Strings returns the claim if it is a string or an array of strings, or nil.
+// Space-separated claims such as "scope" are split.
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+type claimsKey struct{}
+
+// Claims returns the claims of the token verified by OIDCProvider.Middleware,
+// or nil.
+func (r *Request) Claims() Claims {
+	c, _ := r.Get(claimsKey{}).(Claims)
+	return c
+}
+
+// An OIDCProvider verifies the ID and access tokens issued by an OpenID
+// Connect provider, such as Auth0, Keycloak or Okta, with the keys published
+// at its JWKS URL. It is safe for concurrent use.
+type OIDCProvider struct {
+	opts    OIDCOptions
+	jwksURL string
+
+	mu         sync.Mutex
+	keys       map[string]crypto.PublicKey
+	fetchedAt  time.Time
+	missAt     time.Time     // last refresh for an unknown key
+	failedAt   time.Time     // last failed refresh
+	refreshing chan struct{} // closed when the running refresh is done
+}
+
+// oidcRefreshBackoff is the minimum interval between two refreshes for
+// unknown keys, and after a failed refresh.
+const oidcRefreshBackoff = time.Minute
+
+// NewOIDCProvider discovers the metadata of the provider and fetches its keys.
+func NewOIDCProvider(ctx context.Context, opts OIDCOptions) (*OIDCProvider, error) {
+	if opts.Issuer == "" || len(opts.Audiences) == 0 {
+		return nil, errors.New("jsonrest: OIDCOptions.Issuer and Audiences are required")
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = time.Hour
+	}
+	if opts.Leeway <= 0 {
+		opts.Leeway = time.Minute
+	}
+
+	var metadata struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	discovery := strings.TrimSuffix(opts.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := fetchJSON(ctx, opts.Client, discovery, &metadata); err != nil {
+		return nil, fmt.Errorf("jsonrest: discovering OIDC provider: %v", err)
+	}
+	if metadata.Issuer != opts.Issuer {
+		return nil, fmt.Errorf("jsonrest: OIDC provider issuer %q does not match %q", metadata.Issuer, opts.Issuer)
+	}
+	if metadata.JWKSURI == "" {
+		return nil, errors.New("jsonrest: OIDC provider metadata has no jwks_uri")
+	}
+
+	p := &OIDCProvider{opts: opts, jwksURL: metadata.JWKSURI}
+	if err := p.refresh(ctx); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Middleware returns a middleware authenticating the requests with a bearer
+// token in their Authorization header. Requests with a missing or invalid
+// token are rejected with a 401 error. The claims of the token are available
+// through Request.Claims, and its subject is set as the principal of the
+// request (see Request.Principal). The scopes required by the route (see
+// Scopes) must be granted by the "scope" or "scp" claim of the token; with
+// OIDCOptions.Optional, the requests without a token to routes requiring
+// scopes are rejected with a 401 error.
+func (p *OIDCProvider) Middleware() Middleware {
+	return func(next Endpoint) Endpoint {
+		return func(ctx context.Context, req *Request) (interface{}, error) {
+			auth := req.Header("Authorization")
+			if auth == "" && p.opts.Optional {
+				// Anonymous requests are only rejected by the routes
+				// requiring scopes.
+				if err := checkScopes(req, nil); err != nil {
+					return nil, err
+				}
+				return next(ctx, req)
+			}
+			if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+				req.SetResponseHeader("WWW-Authenticate", "Bearer")
+				return nil, Unauthorized("missing bearer token")
+			}
+			claims, err := p.Verify(ctx, strings.TrimSpace(auth[7:]))
+			if err != nil {
+				req.SetResponseHeader("WWW-Authenticate", `Bearer error="invalid_token"`)
+				return nil, Unauthorized("invalid bearer token").Wrap(err)
+			}
+			req.Set(claimsKey{}, claims)
+			req.SetPrincipal(claims.Subject())
+			if err := checkScopes(req, claimScopes(req)); err != nil {
+				return nil, err
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+// Verify verifies the signature of the token, and that it was issued by the
+// provider for one of the audiences and has not expired, and returns its
+// claims.
+func (p *OIDCProvider) Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyJWS(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if claims.String("iss") != p.opts.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", claims.String("iss"))
+	}
+	if !p.audienceAllowed(claims.Strings("aud")) {
+		return nil, errors.New("unexpected audience")
+	}
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(p.opts.Leeway)) {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(p.opts.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("token not valid yet")
+	}
+	return claims, nil
+}
+
+// audienceAllowed reports whether one of the audiences of a token is allowed.
+func (p *OIDCProvider) audienceAllowed(auds []string) bool {
+	for _, aud := range auds {
+		for _, allowed := range p.opts.Audiences {
+			if aud == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// key returns the key identified by kid. Stale keys are refreshed in the
+// background while still in use; requests for an unknown key wait for the
+// refresh, or for ctx to be done. At most one refresh runs at a time, and
+// refreshes are not attempted for oidcRefreshBackoff after a failed one, so
+// that an unavailable provider does not stall the requests.
+func (p *OIDCProvider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	now := time.Now()
+	key, ok := p.keys[kid]
+	stale := now.Sub(p.fetchedAt) > p.opts.RefreshInterval
+	miss := !ok && now.Sub(p.missAt) > oidcRefreshBackoff
+	if (stale || miss) && p.refreshing == nil && now.Sub(p.failedAt) > oidcRefreshBackoff {
+		if miss {
+			p.missAt = now
+		}
+		p.refreshing = make(chan struct{})
+		go p.refreshInBackground(p.refreshing)
+	}
+	done := p.refreshing
+	p.mu.Unlock()
+
+	if !ok && done != nil {
+		select {
+		case <-done:
+			p.mu.Lock()
+			key, ok = p.keys[kid]
+			p.mu.Unlock()
+		case <-ctx.Done():
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// refreshInBackground refreshes the keys, independently of the request which
+// triggered it, and closes done. The cached keys are kept if the provider is
+// unavailable.
+func (p *OIDCProvider) refreshInBackground(done chan struct{}) {
+	keys, err := p.fetchKeys(context.Background())
+	p.mu.Lock()
+	if err == nil {
+		p.keys, p.fetchedAt = keys, time.Now()
+	} else {
+		p.failedAt = time.Now()
+	}
+	p.refreshing = nil
+	p.mu.Unlock()
+	close(done)
+}
+
+func (p *OIDCProvider) refresh(ctx context.Context) error {
+	keys, err := p.fetchKeys(ctx)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys, p.fetchedAt = keys, time.Now()
+	return nil
+}
+
+// fetchKeys fetches the keys of the provider.
+func (p *OIDCProvider) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := fetchJSON(ctx, p.opts.Client, p.jwksURL, &set); err != nil {
+		return nil, fmt.Errorf("jsonrest: fetching OIDC keys: %v", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		// Keys of unsupported types are skipped.
+		if pub, err := k.publicKey(); err == nil {
+			keys[k.Kid] = pub
+		}
+	}
+	return keys, nil
+}
+
+// jsonWebKey is a public key of a JWK set (RFC 7517).
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey returns the RSA or ECDSA public key.
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+		if err1 != nil || err2 != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err1 := base64.RawURLEncoding.DecodeString(k.X)
+		y, err2 := base64.RawURLEncoding.DecodeString(k.Y)
+		if err1 != nil || err2 != nil {
+			return nil, errors.New("invalid EC key")
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("invalid EC key")
+		}
+		return pub, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// jwsHashes are the hash functions of the supported signature algorithms, by
+// their suffix.
+var jwsHashes = map[string]crypto.Hash{
+	"256": crypto.SHA256,
+	"384": crypto.SHA384,
+	"512": crypto.SHA512,
+}
+
+// verifyJWS verifies the signature of the signing input with the algorithm
+// (RS*, PS* or ES*) and the key. Symmetric algorithms and "none" are not
+// supported, since the keys are public.
+func verifyJWS(alg string, key crypto.PublicKey, input string, sig []byte) error {
+	hash, ok := jwsHashes[strings.TrimLeft(alg, "RSPE")]
+	if len(alg) != 5 || !ok {
+		return fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	h := hash.New()
+	io.WriteString(h, input)
+	digest := h.Sum(nil)
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			if rsa.VerifyPKCS1v15(pub, hash, digest, sig) == nil {
+				return nil
+			}
+		case "PS":
+			if rsa.VerifyPSS(pub, hash, digest, sig, nil) == nil {
+				return nil
+			}
+		}
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if alg[:2] == "ES" && len(sig) == 2*size {
+			r := new(big.Int).SetBytes(sig[:size])
+			s := new(big.Int).SetBytes(sig[size:])
+			if ecdsa.Verify(pub, digest, r, s) {
+				return nil
+			}
+		}
+	}
+	return errors.New("invalid token signature")
+}
+
+// decodeSegment decodes a base64url-encoded JSON segment of a token.
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return errors.New("malformed token")
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return errors.New("malformed token")
+	}
+	return nil
+}
+
+// fetchJSON fetches the JSON document at the URL into v.
+func fetchJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %v: unexpected status %v", url, resp.Status)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,154 @@
+package jsonrest
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Default limits for Request.Pagination, see WithPaginationLimits.
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// Pagination holds the pagination parameters of a list request, either
+// page-based (page and per_page query parameters) or cursor-based (cursor and
+// limit query parameters).
+type Pagination struct {
+	// Page is the 1-based page number. It is 0 for cursor-based requests.
+	Page int
+	// Limit is the maximum number of items to return.
+	Limit int
+	// Cursor is the opaque position to start from for cursor-based
+	// requests.
+	Cursor string
+}
+
+// Offset returns the number of items to skip for page-based requests.
+func (p Pagination) Offset() int {
+	if p.Page < 1 {
+		return 0
+	}
+	return (p.Page - 1) * p.Limit
+}
+
+// paginationLimits holds the default and maximum page sizes.
+type paginationLimits struct {
+	def, max int
+}
+
+// WithPaginationLimits is an Option available for NewRouter and Group to set
+// the default and maximum number of items returned by Request.Pagination.
+// They default to DefaultPageLimit and MaxPageLimit.
+func WithPaginationLimits(defaultLimit, maxLimit int) Option {
+	return func(r *Router) {
+		r.pageLimits = paginationLimits{defaultLimit, maxLimit}
+	}
+}
+
+// Pagination parses the pagination query parameters of the request. A request
+// with a cursor or limit parameter is cursor-based, otherwise it is
+// page-based and the page defaults to 1. The limit is capped to the maximum
+// page size. It returns a 400 error if a parameter is not a positive integer.
+func (r *Request) Pagination() (Pagination, error) {
+	limits := r.pageLimits
+	if limits.def <= 0 {
+		limits.def = DefaultPageLimit
+	}
+	if limits.max <= 0 {
+		limits.max = MaxPageLimit
+	}
+
+	q := r.req.URL.Query()
+	p := Pagination{Limit: limits.def}
+	limitParam := "per_page"
+	if _, ok := q["cursor"]; ok || q.Get("limit") != "" {
+		p.Cursor = q.Get("cursor")
+		limitParam = "limit"
+	} else {
+		p.Page = 1
+		if v := q.Get("page"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return Pagination{}, BadRequest("page must be a positive integer")
+			}
+			p.Page = n
+		}
+	}
+	if v := q.Get(limitParam); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return Pagination{}, BadRequest(limitParam + " must be a positive integer")
+		}
+		p.Limit = n
+	}
+	if p.Limit > limits.max {
+		p.Limit = limits.max
+	}
+	return p, nil
+}
+
+// PaginatedResponse is the response body of a paginated list.
+type PaginatedResponse struct {
+	Data       interface{} `json:"data"`
+	Total      int         `json:"total"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	PrevCursor string      `json:"prev_cursor,omitempty"`
+}
+
+// Paginate sets the Link header (RFC 5988) of the response to the first,
+// prev, next and last pages of res, relative to the request URL, and returns
+// res. For cursor-based requests, only the prev and next links are set, from
+// the cursors of res.
+func (r *Request) Paginate(p Pagination, res PaginatedResponse) PaginatedResponse {
+	var links []string
+	link := func(rel string, params map[string]string) {
+		u := *r.req.URL
+		q := u.Query()
+		for k, v := range params {
+			q.Set(k, v)
+		}
+		u.RawQuery = q.Encode()
+		u.Scheme, u.Host = "", ""
+		links = append(links, "<"+u.String()+`>; rel="`+rel+`"`)
+	}
+
+	if p.Page == 0 {
+		limit := strconv.Itoa(p.Limit)
+		if res.PrevCursor != "" {
+			link("prev", map[string]string{"cursor": res.PrevCursor, "limit": limit})
+		}
+		if res.NextCursor != "" {
+			link("next", map[string]string{"cursor": res.NextCursor, "limit": limit})
+		}
+	} else if p.Limit > 0 {
+		last := (res.Total + p.Limit - 1) / p.Limit
+		if last < 1 {
+			last = 1
+		}
+		page := func(rel string, n int) {
+			link(rel, map[string]string{"page": strconv.Itoa(n), "per_page": strconv.Itoa(p.Limit)})
+		}
+		page("first", 1)
+		if p.Page > 1 {
+			page("prev", minInt(p.Page-1, last))
+		}
+		if p.Page < last {
+			page("next", p.Page+1)
+		}
+		page("last", last)
+	}
+
+	if len(links) > 0 {
+		r.responseWriter.Header().Set("Link", strings.Join(links, ", "))
+	}
+	return res
+}
+
+// minInt returns the smaller of a and b.
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,386 @@
+package jsonrest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An UploadRequest describes a file a client is about to upload directly to
+// an object store.
+type UploadRequest struct {
+	// Key is the key of the object, chosen by PresignOptions.Key.
+	Key         string
+	ContentType string
+	Size        int64
+
+	// Expires is when the signed URL expires.
+	Expires time.Time
+}
+
+// A SignedUpload tells a client how to upload a file directly to an object
+// store.
+type SignedUpload struct {
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Key       string            `json:"key"`
+	ExpiresAt time.Time         `json:"expires_at"`
+
+	// Token authenticates the completion callback of the upload, see
+	// UploadCallbackEndpoint.
+	Token string `json:"token"`
+}
+
+// An UploadSigner issues presigned upload URLs for an object store, such as
+// S3, GCS or Azure Blob Storage. The URL, method and headers of the returned
+// SignedUpload are set; its other fields are set by PresignedUploadEndpoint.
+// Signers should bind the size and content type of the upload to the URL,
+// e.g. by signing the Content-Length and Content-Type headers.
+type UploadSigner interface {
+	SignUpload(ctx context.Context, upload UploadRequest) (*SignedUpload, error)
+}
+
+// UploadSignerFunc adapts a function to the UploadSigner interface.
+type UploadSignerFunc func(ctx context.Context, upload UploadRequest) (*SignedUpload, error)
+
+// SignUpload implements the UploadSigner interface.
+func (f UploadSignerFunc) SignUpload(ctx context.Context, upload UploadRequest) (*SignedUpload, error) {
+	return f(ctx, upload)
+}
+
+// A CompletedUpload is an upload reported as complete by a client, see
+// UploadCallbackEndpoint. The content type and size are the ones declared by
+// the client to PresignedUploadEndpoint: they are only enforced by signers
+// binding them to the URL, such as S3UploadSigner.
+type CompletedUpload struct {
+	Key         string
+	ContentType string
+	Size        int64
+}
+
+// PresignOptions configures PresignedUploadEndpoint and
+// UploadCallbackEndpoint.
+type PresignOptions struct {
+	// Signer issues the presigned URLs. It is required.
+	Signer UploadSigner
+
+	// Secret authenticates the tokens of the completion callbacks. It is
+	// required, and must be shared by the instances of the service.
+	Secret []byte
+
+	// MaxSize is the maximum size of the uploads, if positive. It is checked
+	// against the size declared by the client, which the Signer must bind
+	// to the URL for the limit to be enforced.
+	MaxSize int64
+
+	// ContentTypes are the allowed content types of the uploads. All
+	// content types are allowed if it is empty.
+	ContentTypes []string
+
+	// Expiry is how long the presigned URLs are valid. It defaults to 15
+	// minutes. The callback tokens are valid for an additional hour.
+	Expiry time.Duration
+
+	// Key returns the key of the object for the file name sent by the
+	// client. It defaults to "uploads/" followed by a random ID and the
+	// base name of the file.
+	Key func(ctx context.Context, req *Request, filename string) (string, error)
+
+	// OnComplete is called by UploadCallbackEndpoint with the completed
+	// upload, e.g. to record it, and its result is sent as the response.
+	OnComplete func(ctx context.Context, req *Request, upload CompletedUpload) (interface{}, error)
+}
+
+// PresignedUploadEndpoint returns an endpoint issuing presigned upload URLs,
+// so that large files are uploaded directly to an object store instead of
+// transiting through the API. The request body describes the file:
+//
+//	{"filename": "report.pdf", "content_type": "application/pdf", "size": 1048576}
+//
+// and the response is a SignedUpload, with a 201 status. Once the file is
+// uploaded, the client reports it to the UploadCallbackEndpoint with its key
+// and token. Invalid files are rejected with 400, 413 or 415 errors.
+func PresignedUploadEndpoint(opts PresignOptions) Endpoint {
+	opts = opts.withDefaults()
+	return func(ctx context.Context, req *Request) (interface{}, error) {
+		var in struct {
+			Filename    string `json:"filename"`
+			ContentType string `json:"content_type"`
+			Size        int64  `json:"size"`
+		}
+		if err := req.BindBody(&in); err != nil {
+			return nil, err
+		}
+		if in.Filename == "" || in.Size <= 0 {
+			return nil, BadRequest("filename and a positive size are required")
+		}
+		if opts.MaxSize > 0 && in.Size > opts.MaxSize {
+			return nil, Error(http.StatusRequestEntityTooLarge, "upload_too_large", "file exceeds the maximum size of "+strconv.FormatInt(opts.MaxSize, 10)+" bytes")
+		}
+		if !contentTypeAllowed(in.ContentType, opts.ContentTypes) {
+			return nil, Error(http.StatusUnsupportedMediaType, "unsupported_media_type", fmt.Sprintf("content type %q is not allowed", in.ContentType))
+		}
+
+		key, err := opts.Key(ctx, req, in.Filename)
+		if err != nil {
+			return nil, err
+		}
+		upload := UploadRequest{Key: key, ContentType: in.ContentType, Size: in.Size, Expires: time.Now().Add(opts.Expiry).UTC().Truncate(time.Second)}
+		signed, err := opts.Signer.SignUpload(ctx, upload)
+		if err != nil {
+			return nil, err
+		}
+		signed.Key, signed.ExpiresAt = key, upload.Expires
+		signed.Token = uploadToken(opts.Secret, req.Principal(), CompletedUpload{key, in.ContentType, in.Size}, upload.Expires.Add(time.Hour))
+		return Response{StatusCode: http.StatusCreated, Body: signed}, nil
+	}
+}
+
+// UploadCallbackEndpoint returns an endpoint called by the clients once they
+// uploaded a file with a URL issued by PresignedUploadEndpoint, with the key
+// and token of the SignedUpload:
+//
+//	{"key": "uploads/3f2a.../report.pdf", "token": "..."}
+//
+// The token is verified, so that clients can only report their own uploads,
+// and the upload is passed to PresignOptions.OnComplete. Invalid or expired
+// tokens are rejected with a 403 error. OnComplete should check that the
+// object exists, since the token does not prove that it was uploaded.
+func UploadCallbackEndpoint(opts PresignOptions) Endpoint {
+	opts = opts.withDefaults()
+	if opts.OnComplete == nil {
+		panic("jsonrest: PresignOptions.OnComplete is required")
+	}
+	return func(ctx context.Context, req *Request) (interface{}, error) {
+		var in struct {
+			Key   string `json:"key"`
+			Token string `json:"token"`
+		}
+		if err := req.BindBody(&in); err != nil {
+			return nil, err
+		}
+		upload, ok := verifyUploadToken(opts.Secret, req.Principal(), in.Key, in.Token)
+		if !ok {
+			return nil, Forbidden("invalid or expired upload token")
+		}
+		return opts.OnComplete(ctx, req, upload)
+	}
+}
+
+func (opts PresignOptions) withDefaults() PresignOptions {
+	if opts.Signer == nil || len(opts.Secret) == 0 {
+		panic("jsonrest: PresignOptions.Signer and Secret are required")
+	}
+	if opts.Expiry <= 0 {
+		opts.Expiry = 15 * time.Minute
+	}
+	if opts.Key == nil {
+		opts.Key = defaultUploadKey
+	}
+	return opts
+}
+
+// defaultUploadKey returns "uploads/<random ID>/<base name of the file>".
+func defaultUploadKey(ctx context.Context, req *Request, filename string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	name := path.Base(strings.Replace(filename, "\\", "/", -1))
+	if name == "." || name == "/" || name == ".." {
+		name = "file"
+	}
+	return "uploads/" + hex.EncodeToString(b) + "/" + name, nil
+}
+
+func contentTypeAllowed(contentType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, ct := range allowed {
+		if strings.EqualFold(ct, contentType) {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadToken returns the token of the upload for the principal, valid until
+// expires: the base64-encoded content type, size and expiry, and the
+// HMAC-SHA256 of the upload's fields.
+func uploadToken(secret []byte, principal string, upload CompletedUpload, expires time.Time) string {
+	claims := strings.Join([]string{upload.ContentType, strconv.FormatInt(upload.Size, 10), strconv.FormatInt(expires.Unix(), 10)}, "\n")
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(principal + "\n" + upload.Key + "\n" + claims))
+	return base64.RawURLEncoding.EncodeToString([]byte(claims)) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyUploadToken verifies the token of the upload of the key, and returns
+// the upload.
+func verifyUploadToken(secret []byte, principal, key, token string) (CompletedUpload, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return CompletedUpload{}, false
+	}
+	claims, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return CompletedUpload{}, false
+	}
+	fields := strings.Split(string(claims), "\n")
+	if len(fields) != 3 {
+		return CompletedUpload{}, false
+	}
+	size, err1 := strconv.ParseInt(fields[1], 10, 64)
+	expires, err2 := strconv.ParseInt(fields[2], 10, 64)
+	if err1 != nil || err2 != nil || time.Now().After(time.Unix(expires, 0)) {
+		return CompletedUpload{}, false
+	}
+	upload := CompletedUpload{Key: key, ContentType: fields[0], Size: size}
+	if !hmac.Equal([]byte(token), []byte(uploadToken(secret, principal, upload, time.Unix(expires, 0)))) {
+		return CompletedUpload{}, false
+	}
+	return upload, true
+}
+
+// S3UploadSigner is an UploadSigner issuing presigned PUT URLs for Amazon S3
+// and compatible object stores, such as MinIO or Cloudflare R2, with AWS
+// Signature Version 4. The Content-Length and Content-Type headers are
+// signed, so that the object has the declared size and type: the client must
+// send the headers returned in the SignedUpload.
+type S3UploadSigner struct {
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// SessionToken is the session token of temporary credentials, if any.
+	SessionToken string
+
+	// Endpoint is the URL of the object store, e.g.
+	// "http://localhost:9000", for path-style URLs. It defaults to
+	// virtual-hosted-style URLs of Amazon S3 in the region.
+	Endpoint string
+}
+
+// SignUpload implements the UploadSigner interface.
+func (s *S3UploadSigner) SignUpload(ctx context.Context, upload UploadRequest) (*SignedUpload, error) {
+	scheme, host, p := "https", s.Bucket+".s3."+s.Region+".amazonaws.com", "/"+upload.Key
+	if s.Endpoint != "" {
+		u, err := url.Parse(s.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("jsonrest: invalid S3 endpoint: %v", err)
+		}
+		scheme, host, p = u.Scheme, u.Host, strings.TrimSuffix(u.Path, "/")+"/"+s.Bucket+"/"+upload.Key
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	expires := upload.Expires.Sub(now)
+	size := strconv.FormatInt(upload.Size, 10)
+	headers := map[string]string{"content-length": size}
+	if upload.ContentType != "" {
+		headers["content-type"] = upload.ContentType
+	}
+	query := s3PresignQuery(http.MethodPut, host, p, headers, s.Region, s.AccessKeyID, s.SecretAccessKey, s.SessionToken, now, expires)
+
+	signed := &SignedUpload{
+		Method:  http.MethodPut,
+		URL:     scheme + "://" + host + awsEscapePath(p) + "?" + query,
+		Headers: map[string]string{"Content-Length": size},
+	}
+	if upload.ContentType != "" {
+		signed.Headers["Content-Type"] = upload.ContentType
+	}
+	return signed, nil
+}
+
+// s3PresignQuery returns the query string of a presigned S3 request (AWS
+// Signature Version 4, with an unsigned payload). The headers, with lowercase
+// names, are signed along with the host.
+func s3PresignQuery(method, host, p string, headers map[string]string, region, accessKeyID, secret, sessionToken string, now time.Time, expires time.Duration) string {
+	date := now.Format("20060102")
+	scope := date + "/" + region + "/s3/aws4_request"
+	headers["host"] = host
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	params := map[string]string{
+		"X-Amz-Algorithm":     "AWS4-HMAC-SHA256",
+		"X-Amz-Credential":    accessKeyID + "/" + scope,
+		"X-Amz-Date":          now.Format("20060102T150405Z"),
+		"X-Amz-Expires":       strconv.Itoa(int(expires / time.Second)),
+		"X-Amz-SignedHeaders": strings.Join(names, ";"),
+	}
+	if sessionToken != "" {
+		params["X-Amz-Security-Token"] = sessionToken
+	}
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = awsEscape(k) + "=" + awsEscape(params[k])
+	}
+	query := strings.Join(pairs, "&")
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	canonicalRequest := strings.Join([]string{
+		method, awsEscapePath(p), query, canonicalHeaders.String(), strings.Join(names, ";"), "UNSIGNED-PAYLOAD",
+	}, "\n")
+	digest := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", params["X-Amz-Date"], scope, hex.EncodeToString(digest[:])}, "\n")
+
+	key := []byte("AWS4" + secret)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	return query + "&X-Amz-Signature=" + hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsEscape escapes s as required by AWS Signature Version 4: all bytes but
+// the unreserved characters are percent-encoded.
+func awsEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// awsEscapePath escapes the segments of the path with awsEscape.
+func awsEscapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, seg := range segments {
+		segments[i] = awsEscape(seg)
+	}
+	return strings.Join(segments, "/")
+}
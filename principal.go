@@ -0,0 +1,16 @@
+package jsonrest
+
+type principalKey struct{}
+
+// SetPrincipal records the identity of the authenticated caller, e.g. a user
+// or service ID. It is meant to be called by an authentication middleware, so
+// that other features (such as audit records) can use it.
+func (r *Request) SetPrincipal(principal string) {
+	r.Set(principalKey{}, principal)
+}
+
+// Principal returns the identity of the authenticated caller set by
+// SetPrincipal, or an empty string.
+func (r *Request) Principal() string {
+	return r.GetString(principalKey{})
+}
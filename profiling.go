@@ -0,0 +1,145 @@
+package jsonrest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// maxProfileDuration caps the duration of the CPU profiles and execution
+// traces.
+const maxProfileDuration = 5 * time.Minute
+
+// EnableProfiling registers the profiling endpoints under the prefix, e.g.
+// "/debug", protected by the middleware, if any:
+//
+//   - GET prefix/pprof/ lists the runtime/pprof profiles.
+//   - GET prefix/pprof/profile?seconds=30 records a CPU profile.
+//   - GET prefix/pprof/trace?seconds=5 records an execution trace.
+//   - GET prefix/pprof/cmdline returns the command line.
+//   - GET prefix/pprof/NAME?debug=N returns the named profile, e.g. heap or
+//     goroutine; gc=1 runs a garbage collection first for heap.
+//   - GET prefix/vars returns the command line and the runtime.MemStats,
+//     like the default variables of the expvar package.
+//
+// The profiles are in the format of the pprof tool, e.g. go tool pprof
+// http://host/debug/pprof/heap. Unlike net/http/pprof and expvar, no handler
+// is registered on http.DefaultServeMux.
+func (r *Router) EnableProfiling(prefix string, ms ...Middleware) {
+	g := r.Group()
+	g.Use(ms...)
+	g.Get(prefix+"/pprof/*name", profileEndpoint)
+	g.Get(prefix+"/vars", func(ctx context.Context, req *Request) (interface{}, error) {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		return M{"cmdline": os.Args, "memstats": stats}, nil
+	})
+}
+
+// profileEndpoint serves the profile named by the name URL parameter, see
+// EnableProfiling.
+func profileEndpoint(ctx context.Context, req *Request) (interface{}, error) {
+	name := req.Param("name")
+	if len(name) > 0 && name[0] == '/' {
+		name = name[1:]
+	}
+	switch name {
+	case "":
+		type profile struct {
+			Name  string `json:"name"`
+			Count int    `json:"count"`
+		}
+		profiles := []profile{}
+		for _, p := range pprof.Profiles() {
+			profiles = append(profiles, profile{p.Name(), p.Count()})
+		}
+		sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+		return profiles, nil
+	case "cmdline":
+		return M{"cmdline": os.Args}, nil
+	case "profile", "trace":
+		d, err := profileDuration(req, name)
+		if err != nil {
+			return nil, err
+		}
+		router := req.router
+		return ServeHandler(http.HandlerFunc(func(w http.ResponseWriter, hreq *http.Request) {
+			recordProfile(router, w, hreq, name, d)
+		})), nil
+	}
+
+	p := pprof.Lookup(name)
+	if p == nil {
+		return nil, NotFound(fmt.Sprintf("unknown profile %q", name))
+	}
+	debug, _ := strconv.Atoi(req.Query("debug"))
+	if name == "heap" && req.Query("gc") == "1" {
+		runtime.GC()
+	}
+	return ServeHandler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		setProfileHeaders(w, name, debug > 0)
+		p.WriteTo(w, debug)
+	})), nil
+}
+
+// profileDuration returns the duration of the CPU profile or trace requested
+// with the seconds query parameter, which defaults to 30 seconds for CPU
+// profiles and 1 second for traces.
+func profileDuration(req *Request, name string) (time.Duration, error) {
+	d := 30 * time.Second
+	if name == "trace" {
+		d = time.Second
+	}
+	if v := req.Query("seconds"); v != "" {
+		secs, err := strconv.ParseFloat(v, 64)
+		if err != nil || secs <= 0 {
+			return 0, BadRequest("seconds must be a positive number")
+		}
+		d = time.Duration(secs * float64(time.Second))
+	}
+	if d > maxProfileDuration {
+		d = maxProfileDuration
+	}
+	return d, nil
+}
+
+// recordProfile writes a CPU profile or an execution trace recorded for d, or
+// until the request is canceled. Errors are sent by the router.
+func recordProfile(r *Router, w http.ResponseWriter, req *http.Request, name string, d time.Duration) {
+	start, stop := pprof.StartCPUProfile, pprof.StopCPUProfile
+	if name == "trace" {
+		start, stop = trace.Start, trace.Stop
+	}
+	setProfileHeaders(w, name, false)
+	if err := start(w); err != nil {
+		w.Header().Del("Content-Disposition")
+		r.sendError(w, req, Error(http.StatusInternalServerError, "profiling_failed", err.Error()))
+		return
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-req.Context().Done():
+	}
+	stop()
+}
+
+// setProfileHeaders sets the headers of a profile response, in text or binary
+// format.
+func setProfileHeaders(w http.ResponseWriter, name string, text bool) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if text {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+}
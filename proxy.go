@@ -0,0 +1,154 @@
+package jsonrest
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+// A ProxyOption configures Proxy.
+type ProxyOption func(*proxyConfig)
+
+// proxyConfig is the configuration of Proxy.
+type proxyConfig struct {
+	pathTemplate string
+	transport    http.RoundTripper
+}
+
+// ProxyPath is a ProxyOption rewriting the path of the upstream requests from
+// the template, relative to the target path, with the route parameters
+// substituted, e.g. "/v2/accounts/:id/orders/*rest" for the route
+// "/orders/:id/*rest". By default, the request path is used as-is.
+func ProxyPath(template string) ProxyOption {
+	return func(c *proxyConfig) {
+		c.pathTemplate = template
+	}
+}
+
+// ProxyTransport is a ProxyOption setting the transport of the upstream
+// requests. It defaults to http.DefaultTransport.
+func ProxyTransport(rt http.RoundTripper) ProxyOption {
+	return func(c *proxyConfig) {
+		c.transport = rt
+	}
+}
+
+// Proxy returns an endpoint forwarding requests to the target, like
+// httputil.NewSingleHostReverseProxy.
+//
+// Validators (ETag, Last-Modified) and conditional request headers are
+// forwarded as-is. If the upstream ignores the conditional headers of a GET or
+// HEAD request, the proxy honors them itself, answering 304 Not Modified when
+// the validators of the upstream response match.
+//
+// Upstream failures are answered with JSON errors, written with the router's
+// error encoder: a 504 error if the upstream timed out, a 502 error if it
+// cannot be reached, and an error with the upstream status if it answered
+// with a 5xx status and a body which is not JSON.
+func Proxy(target *url.URL, opts ...ProxyOption) Endpoint {
+	var config proxyConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = config.transport
+	if config.pathTemplate != "" {
+		director := proxy.Director
+		proxy.Director = func(req *http.Request) {
+			director(req)
+			if r := RequestFromContext(req.Context()); r != nil {
+				req.URL.Path = singleJoiningSlash(target.Path, expandPathTemplate(config.pathTemplate, r.params))
+				req.URL.RawPath = ""
+			}
+		}
+	}
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		if resp.StatusCode >= 500 && !isJSONResponse(resp.Header) {
+			resp.Body.Close()
+			return &upstreamError{status: resp.StatusCode}
+		}
+		return honorConditionals(resp)
+	}
+	proxy.ErrorHandler = proxyError
+	return func(_ context.Context, req *Request) (interface{}, error) {
+		return ServeHandler(proxy), nil
+	}
+}
+
+// upstreamError is returned by the ModifyResponse function of Proxy for the
+// upstream failures with a non-JSON body.
+type upstreamError struct {
+	status int
+}
+
+func (e *upstreamError) Error() string {
+	return "upstream error: " + http.StatusText(e.status)
+}
+
+// proxyError writes the JSON error translating the failure of the upstream
+// request.
+func proxyError(w http.ResponseWriter, req *http.Request, err error) {
+	var httpErr *HTTPError
+	var upErr *upstreamError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &upErr):
+		httpErr = Error(upErr.status, "upstream_error", "the upstream service failed")
+	case errors.Is(err, context.Canceled):
+		// The client went away; the response is not read.
+		httpErr = Error(http.StatusBadGateway, "bad_gateway", "the upstream request was canceled")
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		httpErr = Error(http.StatusGatewayTimeout, "gateway_timeout", "the upstream service timed out")
+	default:
+		httpErr = Error(http.StatusBadGateway, "bad_gateway", "the upstream service is unavailable")
+	}
+	router := &Router{}
+	if r := RequestFromContext(req.Context()); r != nil && r.router != nil {
+		router = r.router
+	}
+	router.sendError(w, req, httpErr.Wrap(err))
+}
+
+// isJSONResponse reports whether the response has a JSON content type.
+func isJSONResponse(h http.Header) bool {
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// expandPathTemplate substitutes the route parameters of the path template.
+func expandPathTemplate(template string, params Params) string {
+	segments := strings.Split(template, "/")
+	for i, seg := range segments {
+		if len(seg) < 2 || (seg[0] != ':' && seg[0] != '*') {
+			continue
+		}
+		val := params.ByName(seg[1:])
+		if seg[0] == '*' {
+			val = strings.TrimPrefix(val, "/")
+		}
+		segments[i] = val
+	}
+	return strings.Join(segments, "/")
+}
+
+// honorConditionals turns a successful upstream response into a 304 Not
+// Modified response if it satisfies the conditional headers of the request.
+func honorConditionals(resp *http.Response) error {
+	if resp.StatusCode != http.StatusOK || !notModified(resp.Request, resp.Header) {
+		return nil
+	}
+	resp.Body.Close()
+	resp.Body = http.NoBody
+	resp.ContentLength = 0
+	resp.StatusCode = http.StatusNotModified
+	resp.Status = http.StatusText(http.StatusNotModified)
+	for _, h := range []string{"Content-Length", "Content-Type", "Content-Encoding"} {
+		resp.Header.Del(h)
+	}
+	return nil
+}
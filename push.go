@@ -0,0 +1,33 @@
+package jsonrest
+
+import "net/http"
+
+// Push initiates an HTTP/2 server push of the target, e.g. a critical
+// sub-resource of the response. It is a no-op if push is not supported by the
+// connection or disabled by the client. See http.Pusher.
+func (r *Request) Push(target string, opts *http.PushOptions) error {
+	pusher, ok := r.responseWriter.(http.Pusher)
+	if !ok {
+		return nil
+	}
+	if err := pusher.Push(target, opts); err != http.ErrNotSupported {
+		return err
+	}
+	return nil
+}
+
+// EarlyHints adds the links, e.g. `</app.css>; rel=preload; as=style`, to the
+// Link header of the response, and sends them to the client ahead of the
+// response in a 103 Early Hints informational response, if supported by the
+// server (Go 1.19 and later). It must be called before the response is
+// written.
+func (r *Request) EarlyHints(links ...string) {
+	h := r.responseWriter.Header()
+	for _, link := range links {
+		h.Add("Link", link)
+	}
+	if !informationalResponses {
+		return
+	}
+	r.responseWriter.WriteHeader(http.StatusEarlyHints)
+}
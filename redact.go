@@ -0,0 +1,119 @@
+package jsonrest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Redacted is the value replacing the fields tagged with `jsonrest:"redact"`
+// in responses and logs.
+const Redacted = "[REDACTED]"
+
+// WithRedaction is an Option available for NewRouter and Group to mask or
+// omit the fields tagged with `jsonrest:"redact"` in responses. The values
+// logged with Logf and AddEvent are always redacted.
+func WithRedaction() Option {
+	return func(r *Router) {
+		r.redaction = true
+	}
+}
+
+// redactTag reports whether the struct field is tagged to be redacted, and
+// whether it is omitted rather than masked. For example:
+//
+//	type User struct {
+//	    Email    string `json:"email" jsonrest:"redact"`      // masked
+//	    Password string `json:"password" jsonrest:"redact,omit"` // omitted
+//	}
+func redactTag(sf reflect.StructField) (redact, omit bool) {
+	tag, ok := sf.Tag.Lookup("jsonrest")
+	if !ok {
+		return false, false
+	}
+	for _, opt := range strings.Split(tag, ",") {
+		switch opt {
+		case "redact":
+			redact = true
+		case "omit":
+			omit = true
+		}
+	}
+	return redact, omit
+}
+
+// redactTypes caches the result of mayRedact by type.
+var redactTypes sync.Map // map[reflect.Type]bool
+
+// mayRedact reports whether values of the type may hold fields to redact,
+// either in their static type or in interface values.
+func mayRedact(t reflect.Type) bool {
+	if v, ok := redactTypes.Load(t); ok {
+		return v.(bool)
+	}
+	may := typeMayRedact(t, make(map[reflect.Type]bool))
+	redactTypes.Store(t, may)
+	return may
+}
+
+func typeMayRedact(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	if visiting[t] {
+		return false
+	}
+	visiting[t] = true
+	if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return typeMayRedact(t.Elem(), visiting)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if sf.PkgPath != "" && !sf.Anonymous {
+				continue
+			}
+			if redact, _ := redactTag(sf); redact || typeMayRedact(sf.Type, visiting) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// redactSender wraps send to mask the redacted fields of the response.
+func redactSender(send func(http.ResponseWriter, int, interface{})) func(http.ResponseWriter, int, interface{}) {
+	return func(w http.ResponseWriter, status int, v interface{}) {
+		send(w, status, redactValue(v))
+	}
+}
+
+// redactValue returns a value encoding like v, with its redacted fields
+// masked or omitted.
+func redactValue(v interface{}) interface{} {
+	if v == nil || !mayRedact(reflect.TypeOf(v)) {
+		return v
+	}
+	return localizeValue(v, nil, true)
+}
+
+// redactForLog returns the value to log for v: v itself, or its JSON
+// encoding with the redacted fields masked or omitted.
+func redactForLog(v interface{}) interface{} {
+	if v == nil || !mayRedact(reflect.TypeOf(v)) {
+		return v
+	}
+	if _, ok := v.(error); ok {
+		return v
+	}
+	b, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return fmt.Sprintf("%T(%v)", v, Redacted)
+	}
+	return string(b)
+}
@@ -0,0 +1,90 @@
+package jsonrest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A RouteError is an error that occurred while registering a route, e.g. a
+// malformed RouteMap entry or a path conflicting with another route.
+type RouteError struct {
+	Method string
+	Path   string
+	Err    error
+}
+
+// Error implements the error interface.
+func (err *RouteError) Error() string {
+	route := strings.TrimSpace(err.Method + " " + err.Path)
+	return fmt.Sprintf("jsonrest: invalid route %s: %v", route, err.Err)
+}
+
+// Unwrap returns the underlying error.
+func (err *RouteError) Unwrap() error {
+	return err.Err
+}
+
+// RouteErrors lists the errors that occurred while registering routes.
+type RouteErrors []*RouteError
+
+// Error implements the error interface.
+func (errs RouteErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// WithRegistrationErrors is an Option available for NewRouter to record the
+// errors that occur while registering routes instead of panicking, so that
+// services configuring their routes dynamically can report them gracefully.
+// The invalid routes are skipped; the errors are returned by Err.
+func WithRegistrationErrors() Option {
+	return func(r *Router) {
+		r.collectErrors = true
+	}
+}
+
+// Err returns the RouteErrors recorded while registering routes with the
+// router and its groups, or nil. See WithRegistrationErrors.
+func (r *Router) Err() error {
+	if errs := r.root().registrationErrors; len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// MustBuild panics if errors were recorded while registering routes. See
+// WithRegistrationErrors.
+func (r *Router) MustBuild() {
+	if err := r.Err(); err != nil {
+		panic(err)
+	}
+}
+
+// registrationFailed panics with the error, or records it if the router
+// collects registration errors.
+func (r *Router) registrationFailed(err *RouteError) {
+	root := r.root()
+	if !root.collectErrors {
+		panic(err.Err.Error())
+	}
+	root.registrationErrors = append(root.registrationErrors, err)
+}
+
+// recoverRegistration records a panic that occurred while registering the
+// route, if the router collects registration errors.
+func (r *Router) recoverRegistration(method, path string) {
+	root := r.root()
+	if !root.collectErrors {
+		return
+	}
+	if p := recover(); p != nil {
+		err, ok := p.(error)
+		if !ok {
+			err = fmt.Errorf("%v", p)
+		}
+		root.registrationErrors = append(root.registrationErrors, &RouteError{Method: method, Path: path, Err: err})
+	}
+}
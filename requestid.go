@@ -0,0 +1,61 @@
+package jsonrest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// HeaderRequestID is the default header carrying the request ID.
+const HeaderRequestID = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// RequestIDMiddleware returns a middleware assigning an ID to each request,
+// which can be quoted to correlate failures with logs. The ID is read from the
+// given header (HeaderRequestID if empty), or randomly generated if the header
+// is missing. It is echoed in the response header, available through
+// RequestIDFromContext, and included in the body of *HTTPError responses (see
+// WithRequestIDField).
+func RequestIDMiddleware(header string) Middleware {
+	if header == "" {
+		header = HeaderRequestID
+	}
+	return func(next Endpoint) Endpoint {
+		return func(ctx context.Context, req *Request) (interface{}, error) {
+			id := req.Header(header)
+			if id == "" {
+				id = newRequestID()
+			}
+			req.SetResponseHeader(header, id)
+			ctx = context.WithValue(ctx, requestIDKey{}, id)
+			req.req = req.req.WithContext(ctx)
+			return next(ctx, req)
+		}
+	}
+}
+
+// RequestIDFromContext returns the ID assigned to the request by
+// RequestIDMiddleware, or an empty string.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithRequestIDField is an Option available for NewRouter to configure the
+// name of the error field holding the request ID. It defaults to
+// "request_id".
+func WithRequestIDField(name string) Option {
+	return func(r *Router) {
+		r.requestIDField = name
+	}
+}
+
+// newRequestID returns a random 128-bit ID, hex-encoded.
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
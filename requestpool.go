@@ -0,0 +1,59 @@
+package jsonrest
+
+import "sync"
+
+// WithRequestPooling is an Option available for NewRouter to reuse the Request
+// values passed to endpoints, reducing allocations on busy servers. A Request
+// must then not be used after the endpoint returns, including by goroutines it
+// started: copy the values they need instead.
+func WithRequestPooling() Option {
+	return func(r *Router) {
+		r.requestPooling = true
+	}
+}
+
+// requestPool holds the Request values reused when request pooling is
+// enabled.
+var requestPool = sync.Pool{
+	New: func() interface{} {
+		return new(Request)
+	},
+}
+
+// newRequest returns an empty Request, from requestPool if pooled is true.
+func newRequest(pooled bool) *Request {
+	if pooled {
+		return requestPool.Get().(*Request)
+	}
+	return new(Request)
+}
+
+// release resets r and returns it to requestPool. The meta map and events
+// slice are kept to be reused.
+func (r *Request) release() {
+	r.metaMu.Lock()
+	for key := range r.meta {
+		delete(r.meta, key)
+	}
+	r.metaMu.Unlock()
+	r.eventsMu.Lock()
+	for i := range r.events {
+		r.events[i] = Event{}
+	}
+	r.events = r.events[:0]
+	r.eventsMu.Unlock()
+
+	r.params = nil
+	r.req = nil
+	r.responseWriter = nil
+	r.route = ""
+	r.routeInfo = nil
+	r.pageLimits = paginationLimits{}
+	r.captureError = false
+	r.links = nil
+	r.router = nil
+	r.hijacked = false
+	r.jobs = nil
+	r.scopesChecked = false
+	requestPool.Put(r)
+}
@@ -0,0 +1,153 @@
+package jsonrest
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// A Route describes an endpoint registered with a Router.
+type Route struct {
+	Method string
+	Path   string
+
+	// Name is the name of the route, if any.
+	Name string
+
+	// Params lists the constraints on the route's URL parameters.
+	Params []ParamConstraint
+
+	// SLOClass is the name of the route's SLO class, if any.
+	SLOClass string
+
+	// Stub indicates that the route is planned but not implemented yet, see
+	// Router.Stub.
+	Stub bool
+
+	// Deprecated indicates that the route is deprecated, and will be removed
+	// at the Sunset time, if set. DeprecationLink is the URL of the
+	// documentation of the deprecation, if any. See Deprecated.
+	Deprecated      bool
+	Sunset          time.Time
+	DeprecationLink string
+
+	// Scopes are the scopes a caller must be granted to call the route, see
+	// Scopes.
+	Scopes []string
+
+	// RequestSchema is the schema of the request bodies, if any, see
+	// RequestSchema.
+	RequestSchema *Schema
+
+	// ResponseSchema is the schema of the successful response bodies, if
+	// any, see ResponseSchema.
+	ResponseSchema *Schema
+
+	// Mock indicates that the route serves example responses instead of
+	// calling its endpoint, see Router.Mock and WithMockResponses.
+	Mock bool
+
+	responseExample interface{}
+
+	stream bool
+	pool   *WorkerPool
+	budget *routeBudget
+	router *Router
+
+	limiter     *concurrencyLimiter
+	cachePolicy *CachePolicy
+
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+
+	noCompression      bool
+	compressionMinSize int
+}
+
+// A RouteOption configures a route when it is registered.
+type RouteOption func(*Route)
+
+// RegisteredRoutes returns the routes registered with the router and its
+// groups, in registration order.
+func (r *Router) RegisteredRoutes() []Route {
+	root := r.root()
+	root.routesMu.RLock()
+	defer root.routesMu.RUnlock()
+	routes := make([]Route, len(root.routes))
+	for i, route := range root.routes {
+		routes[i] = *route
+	}
+	return routes
+}
+
+// StreamResponse is a RouteOption that streams the encoded response to the
+// client through a pooled buffered writer, instead of encoding it at once. If
+// the response is a slice or an array, its elements are encoded one at a time,
+// so that memory usage is bounded by the largest element rather than the
+// whole response. It is meant for very large responses, such as reports.
+func StreamResponse() RouteOption {
+	return func(r *Route) {
+		r.stream = true
+	}
+}
+
+// A ParamConstraint restricts the values of a URL parameter. Requests with a
+// value that does not satisfy the constraint are answered with the router's
+// not found handler, before any middleware or the endpoint is called.
+type ParamConstraint struct {
+	// Name is the name of the URL parameter.
+	Name string
+
+	// Type is the JSON type of the parameter, e.g. "integer" or "string".
+	Type string
+
+	// Pattern is the regular expression matching the parameter, if any.
+	Pattern string
+
+	match func(string) bool
+}
+
+// ParamInt is a RouteOption that requires the URL parameter to be a base 10
+// integer.
+func ParamInt(name string) RouteOption {
+	return func(r *Route) {
+		r.Params = append(r.Params, ParamConstraint{
+			Name: name,
+			Type: "integer",
+			match: func(val string) bool {
+				_, err := strconv.ParseInt(val, 10, 64)
+				return err == nil
+			},
+		})
+	}
+}
+
+// ParamRegexp is a RouteOption that requires the URL parameter to fully match
+// the regular expression. Registering the route panics if expr cannot be
+// compiled, unless WithRegistrationErrors is used.
+func ParamRegexp(name, expr string) RouteOption {
+	return func(r *Route) {
+		re := regexp.MustCompile(`^(?:` + expr + `)$`)
+		r.Params = append(r.Params, ParamConstraint{
+			Name:    name,
+			Type:    "string",
+			Pattern: expr,
+			match:   re.MatchString,
+		})
+	}
+}
+
+// constrainParams wraps the handle so that requests whose URL parameters do
+// not satisfy the constraints are served by notFound.
+func constrainParams(constraints []ParamConstraint, h Handle, notFound http.Handler) Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps Params) {
+		for _, c := range constraints {
+			if !c.match(ps.ByName(c.Name)) {
+				notFound.ServeHTTP(w, req)
+				return
+			}
+		}
+		h(w, req, ps)
+	}
+}
@@ -0,0 +1,196 @@
+package jsonrest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// A RouteFormat is an output format of Router.PrintRoutes.
+type RouteFormat string
+
+// The formats of Router.PrintRoutes.
+const (
+	RouteFormatTable    RouteFormat = "table"
+	RouteFormatJSON     RouteFormat = "json"
+	RouteFormatMarkdown RouteFormat = "markdown"
+)
+
+// A RouteIssue is a problem with the registered routes found by
+// Router.LintRoutes.
+type RouteIssue struct {
+	Method  string `json:"method,omitempty"`
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (i RouteIssue) String() string {
+	return strings.TrimSpace(i.Method+" "+i.Path) + ": " + i.Message
+}
+
+// LintRoutes checks the registered routes, for build pipelines and code
+// review. It reports:
+//
+//   - the errors recorded while registering routes, such as duplicate route
+//     names, if WithRegistrationErrors is enabled;
+//   - the unreachable routes, whose requests are matched by another route;
+//   - the resources which can be modified (with PUT, PATCH or DELETE), but
+//     not read with GET.
+func (r *Router) LintRoutes() []RouteIssue {
+	root := r.root()
+	var issues []RouteIssue
+	for _, err := range root.registrationErrors {
+		issues = append(issues, RouteIssue{err.Method, err.Path, err.Err.Error()})
+	}
+
+	routes := r.RegisteredRoutes()
+	methods := make(map[string]map[string]bool)
+	var paths []string
+	for _, route := range routes {
+		if methods[route.Path] == nil {
+			methods[route.Path] = make(map[string]bool)
+			paths = append(paths, route.Path)
+		}
+		methods[route.Path][route.Method] = true
+
+		if !root.routeReachable(route) {
+			issues = append(issues, RouteIssue{route.Method, route.Path, "unreachable: requests are matched by another route"})
+		}
+	}
+	for _, path := range paths {
+		m := methods[path]
+		if (m[http.MethodPut] || m[http.MethodPatch] || m[http.MethodDelete]) && !m[http.MethodGet] {
+			issues = append(issues, RouteIssue{"", path, "missing GET method: the resource can be modified but not read"})
+		}
+	}
+	return issues
+}
+
+// routeReachable reports whether a request to a sample path of the route is
+// matched by it, according to the names of the matched URL parameters.
+func (r *Router) routeReachable(route Route) bool {
+	var want []string
+	segments := strings.Split(route.Path, "/")
+	for i, seg := range segments {
+		if strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*") {
+			want = append(want, seg[1:])
+			segments[i] = "jsonrest-sample"
+		}
+	}
+	sample := strings.Join(segments, "/")
+	if r.caseInsensitive {
+		sample = strings.ToLower(sample)
+	}
+	handle, params := r.matcher.Lookup(route.Method, sample)
+	if handle == nil || len(params) != len(want) {
+		return false
+	}
+	for i, p := range params {
+		if p.Key != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// PrintRoutes writes the registered routes, followed by the issues found by
+// LintRoutes, in the format: an aligned text table, a JSON document with
+// "routes" and "issues" arrays, or a markdown table.
+func (r *Router) PrintRoutes(w io.Writer, format RouteFormat) error {
+	routes := r.RegisteredRoutes()
+	issues := r.LintRoutes()
+
+	switch format {
+	case RouteFormatJSON:
+		type route struct {
+			Method     string   `json:"method"`
+			Path       string   `json:"path"`
+			Name       string   `json:"name,omitempty"`
+			Scopes     []string `json:"scopes,omitempty"`
+			Stub       bool     `json:"stub,omitempty"`
+			Mock       bool     `json:"mock,omitempty"`
+			Deprecated bool     `json:"deprecated,omitempty"`
+		}
+		doc := struct {
+			Routes []route      `json:"routes"`
+			Issues []RouteIssue `json:"issues"`
+		}{[]route{}, issues}
+		for _, rt := range routes {
+			doc.Routes = append(doc.Routes, route{rt.Method, rt.Path, rt.Name, rt.Scopes, rt.Stub, rt.Mock, rt.Deprecated})
+		}
+		if doc.Issues == nil {
+			doc.Issues = []RouteIssue{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(doc)
+
+	case RouteFormatTable:
+		var table strings.Builder
+		tw := tabwriter.NewWriter(&table, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "METHOD\tPATH\tNAME\tSCOPES\tFLAGS")
+		for _, rt := range sortedRoutes(routes) {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", rt.Method, rt.Path, rt.Name, strings.Join(rt.Scopes, ","), routeFlags(rt))
+		}
+		tw.Flush()
+		var b strings.Builder
+		for _, line := range strings.SplitAfter(table.String(), "\n") {
+			if line != "" {
+				b.WriteString(strings.TrimRight(line, " \n") + "\n")
+			}
+		}
+		for _, issue := range issues {
+			fmt.Fprintf(&b, "issue: %v\n", issue)
+		}
+		_, err := io.WriteString(w, b.String())
+		return err
+
+	case RouteFormatMarkdown:
+		var b strings.Builder
+		b.WriteString("| Method | Path | Name | Scopes | Flags |\n")
+		b.WriteString("|---|---|---|---|---|\n")
+		for _, rt := range sortedRoutes(routes) {
+			fmt.Fprintf(&b, "| %s | `%s` | %s | %s | %s |\n", rt.Method, rt.Path, rt.Name, strings.Join(rt.Scopes, ", "), routeFlags(rt))
+		}
+		if len(issues) > 0 {
+			b.WriteString("\n**Issues**\n\n")
+			for _, issue := range issues {
+				fmt.Fprintf(&b, "- %v\n", issue)
+			}
+		}
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+	return fmt.Errorf("jsonrest: unknown route format %q", format)
+}
+
+// sortedRoutes returns the routes sorted by path and method.
+func sortedRoutes(routes []Route) []Route {
+	sorted := append([]Route(nil), routes...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Path != sorted[j].Path {
+			return sorted[i].Path < sorted[j].Path
+		}
+		return sorted[i].Method < sorted[j].Method
+	})
+	return sorted
+}
+
+// routeFlags describes the route's stub, mock and deprecation flags.
+func routeFlags(rt Route) string {
+	var flags []string
+	if rt.Stub {
+		flags = append(flags, "stub")
+	}
+	if rt.Mock {
+		flags = append(flags, "mock")
+	}
+	if rt.Deprecated {
+		flags = append(flags, "deprecated")
+	}
+	return strings.Join(flags, ",")
+}
@@ -0,0 +1,83 @@
+package jsonrest
+
+import (
+	"net/http"
+	"strings"
+)
+
+// caseInsensitiveHandle wraps a handle registered with a lowercased path so
+// that URL parameters are extracted from the original request path, keeping
+// their case.
+func caseInsensitiveHandle(pattern string, h Handle) Handle {
+	return func(w http.ResponseWriter, req *http.Request, _ Params) {
+		h(w, req, paramsFromPath(pattern, req.URL.Path))
+	}
+}
+
+// paramsFromPath extracts the URL parameters of the route pattern from a path
+// known to match it. Since lowerASCII preserves length, the static parts of
+// the pattern and path have the same length even if their case differs.
+func paramsFromPath(pattern, path string) Params {
+	var ps Params
+	for len(pattern) > 0 && len(path) > 0 {
+		switch pattern[0] {
+		case ':':
+			end := strings.IndexByte(pattern, '/')
+			if end < 0 {
+				end = len(pattern)
+			}
+			n := strings.IndexByte(path, '/')
+			if n < 0 {
+				n = len(path)
+			}
+			ps = append(ps, Param{Key: pattern[1:end], Value: path[:n]})
+			pattern, path = pattern[end:], path[n:]
+		case '/':
+			if len(pattern) > 1 && pattern[1] == '*' {
+				// Catch-all values include the leading slash.
+				ps = append(ps, Param{Key: pattern[2:], Value: path})
+				return ps
+			}
+			fallthrough
+		default:
+			pattern, path = pattern[1:], path[1:]
+		}
+	}
+	return ps
+}
+
+// lowerStaticPath lowercases the static parts of the route pattern, leaving
+// parameter names untouched.
+func lowerStaticPath(pattern string) string {
+	var b strings.Builder
+	for len(pattern) > 0 {
+		if c := pattern[0]; c == ':' || c == '*' {
+			end := strings.IndexByte(pattern, '/')
+			if end < 0 {
+				end = len(pattern)
+			}
+			b.WriteString(pattern[:end])
+			pattern = pattern[end:]
+			continue
+		}
+		end := strings.IndexAny(pattern, ":*")
+		if end < 0 {
+			end = len(pattern)
+		}
+		b.WriteString(lowerASCII(pattern[:end]))
+		pattern = pattern[end:]
+	}
+	return b.String()
+}
+
+// lowerASCII lowercases the ASCII letters in s. Unlike strings.ToLower, the
+// length of s is always preserved.
+func lowerASCII(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
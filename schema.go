@@ -0,0 +1,635 @@
+package jsonrest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// A Schema is a JSON Schema describing a request or response body. It
+// supports the subset of JSON Schema used by OpenAPI to describe JSON APIs:
+// types, object properties, array items, enums, numeric and length bounds,
+// patterns, and the date-time, date, uuid, email and uri formats. Other
+// keywords, such as $ref and the combinators, are ignored when parsed.
+type Schema struct {
+	// Type is "object", "array", "string", "number", "integer" or
+	// "boolean". Any value is valid if it is empty.
+	Type     string `json:"type,omitempty"`
+	Nullable bool   `json:"nullable,omitempty"`
+
+	Format      string        `json:"format,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Enum        []interface{} `json:"enum,omitempty"`
+
+	// Default and Examples are not validated, but returned by Example.
+	Default  interface{}   `json:"default,omitempty"`
+	Examples []interface{} `json:"examples,omitempty"`
+
+	// Properties, Required and AdditionalProperties describe objects.
+	// Closed disallows properties not listed in Properties, i.e.
+	// "additionalProperties": false.
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Closed               bool               `json:"-"`
+
+	Items    *Schema `json:"items,omitempty"`
+	MinItems *int    `json:"minItems,omitempty"`
+	MaxItems *int    `json:"maxItems,omitempty"`
+
+	Minimum   *float64 `json:"minimum,omitempty"`
+	Maximum   *float64 `json:"maximum,omitempty"`
+	MinLength *int     `json:"minLength,omitempty"`
+	MaxLength *int     `json:"maxLength,omitempty"`
+	Pattern   string   `json:"pattern,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+type schemaAlias Schema
+
+// MarshalJSON implements the json.Marshaler interface.
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	aux := struct {
+		*schemaAlias
+		AdditionalProperties interface{} `json:"additionalProperties,omitempty"`
+	}{schemaAlias: (*schemaAlias)(s)}
+	if s.Closed {
+		aux.AdditionalProperties = false
+	} else if s.AdditionalProperties != nil {
+		aux.AdditionalProperties = s.AdditionalProperties
+	}
+	return json.Marshal(aux)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. A type array
+// including "null", as in JSON Schema, sets Nullable.
+func (s *Schema) UnmarshalJSON(b []byte) error {
+	aux := struct {
+		*schemaAlias
+		Type                 json.RawMessage `json:"type"`
+		AdditionalProperties json.RawMessage `json:"additionalProperties"`
+	}{schemaAlias: (*schemaAlias)(s)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+
+	if len(aux.Type) > 0 {
+		var types []string
+		if aux.Type[0] == '"' {
+			types = make([]string, 1)
+			if err := json.Unmarshal(aux.Type, &types[0]); err != nil {
+				return err
+			}
+		} else if err := json.Unmarshal(aux.Type, &types); err != nil {
+			return err
+		}
+		for _, t := range types {
+			switch {
+			case t == "null":
+				s.Nullable = true
+			case s.Type != "":
+				return fmt.Errorf("unsupported schema type %v", string(aux.Type))
+			default:
+				s.Type = t
+			}
+		}
+	}
+
+	switch string(aux.AdditionalProperties) {
+	case "", "true":
+	case "false":
+		s.Closed = true
+	default:
+		if err := json.Unmarshal(aux.AdditionalProperties, &s.AdditionalProperties); err != nil {
+			return err
+		}
+	}
+	if s.Pattern != "" {
+		var err error
+		if s.pattern, err = regexp.Compile(s.Pattern); err != nil {
+			return fmt.Errorf("invalid schema pattern %q: %v", s.Pattern, err)
+		}
+	}
+	return nil
+}
+
+// ParseSchema parses a JSON Schema.
+func ParseSchema(data []byte) (*Schema, error) {
+	s := new(Schema)
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("jsonrest: invalid schema: %v", err)
+	}
+	return s, nil
+}
+
+// MustParseSchema is like ParseSchema but panics if the schema is invalid. It
+// simplifies the initialization of global variables holding schemas.
+func MustParseSchema(data string) *Schema {
+	s, err := ParseSchema([]byte(data))
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// SchemaOf derives the schema of the JSON encoding of v's type. Struct fields
+// are named after their json tag, and are required unless they are pointers or
+// tagged with omitempty. Pointers are nullable.
+func SchemaOf(v interface{}) *Schema {
+	return schemaOfType(reflect.TypeOf(v), map[reflect.Type]bool{})
+}
+
+func schemaOfType(t reflect.Type, visiting map[reflect.Type]bool) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t, nullable = t.Elem(), true
+	}
+	s := &Schema{Nullable: nullable}
+	switch {
+	case t == timeType:
+		s.Type, s.Format = "string", "date-time"
+		return s
+	case t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType):
+		// The encoding is unknown.
+		return s
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		s.Type = "string"
+		return s
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		s.Type = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s.Type = "integer"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		zero := 0.0
+		s.Type, s.Minimum = "integer", &zero
+	case reflect.Float32, reflect.Float64:
+		s.Type = "number"
+	case reflect.String:
+		s.Type = "string"
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			// Byte slices are encoded as base64 strings, byte arrays as
+			// arrays of numbers.
+			s.Type, s.Format, s.Nullable = "string", "byte", true
+			break
+		}
+		s.Type, s.Items = "array", schemaOfType(t.Elem(), visiting)
+		s.Nullable = s.Nullable || t.Kind() == reflect.Slice
+	case reflect.Map:
+		s.Type, s.Nullable = "object", true
+		s.AdditionalProperties = schemaOfType(t.Elem(), visiting)
+	case reflect.Struct:
+		s.Type = "object"
+		if visiting[t] {
+			// Recursive types are not expanded.
+			return s
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+		s.Properties = make(map[string]*Schema)
+		addStructProperties(s, t, visiting)
+	}
+	return s
+}
+
+// addStructProperties adds the fields of the struct type to the properties of
+// s, as encoded by encoding/json.
+func addStructProperties(s *Schema, t reflect.Type, visiting map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" || (sf.PkgPath != "" && !sf.Anonymous) {
+			continue
+		}
+		name, opts := tag, ""
+		if i := strings.IndexByte(tag, ','); i >= 0 {
+			name, opts = tag[:i], tag[i+1:]
+		}
+		ft := sf.Type
+		if sf.Anonymous && name == "" {
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				addStructProperties(s, ft, visiting)
+				continue
+			}
+			if sf.PkgPath != "" {
+				continue
+			}
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		prop := schemaOfType(ft, visiting)
+		if strings.Contains(","+opts+",", ",string,") && (prop.Type == "integer" || prop.Type == "number" || prop.Type == "boolean") {
+			prop = &Schema{Type: "string", Nullable: prop.Nullable}
+		}
+		s.Properties[name] = prop
+		if ft.Kind() != reflect.Ptr && !strings.Contains(","+opts+",", ",omitempty,") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// A SchemaViolation is a value not matching a schema.
+type SchemaViolation struct {
+	// Pointer is the JSON Pointer (RFC 6901) of the value, e.g.
+	// "/items/0/qty", or an empty string for the whole document.
+	Pointer string
+	Message string
+}
+
+func (v SchemaViolation) String() string {
+	if v.Pointer == "" {
+		return v.Message
+	}
+	return v.Pointer + ": " + v.Message
+}
+
+// Validate validates the value, as decoded from JSON into an interface{},
+// against the schema, and returns the violations, in document order.
+func (s *Schema) Validate(v interface{}) []SchemaViolation {
+	var violations []SchemaViolation
+	s.validate(v, "", &violations)
+	return violations
+}
+
+// ValidateJSON validates the JSON document against the schema.
+func (s *Schema) ValidateJSON(data []byte) ([]SchemaViolation, error) {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	return s.Validate(v), nil
+}
+
+func (s *Schema) validate(v interface{}, ptr string, violations *[]SchemaViolation) {
+	fail := func(format string, args ...interface{}) {
+		*violations = append(*violations, SchemaViolation{ptr, fmt.Sprintf(format, args...)})
+	}
+	if v == nil {
+		if !s.Nullable && s.Type != "" {
+			fail("expected %v, got null", s.Type)
+		}
+		return
+	}
+	if got := jsonTypeOf(v); s.Type != "" && got != s.Type && !(s.Type == "number" && got == "integer") {
+		fail("expected %v, got %v", s.Type, got)
+		return
+	}
+	if len(s.Enum) > 0 && !inEnum(v, s.Enum) {
+		fail("value must be one of %v", enumString(s.Enum))
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			child := ptr + "/" + escapePointer(name)
+			if prop, ok := s.Properties[name]; ok {
+				prop.validate(v[name], child, violations)
+			} else if s.Closed {
+				*violations = append(*violations, SchemaViolation{child, "unexpected property"})
+			} else if s.AdditionalProperties != nil {
+				s.AdditionalProperties.validate(v[name], child, violations)
+			}
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("expected at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("expected at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, e := range v {
+				s.Items.validate(e, ptr+"/"+strconv.Itoa(i), violations)
+			}
+		}
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.MinLength != nil && n < *s.MinLength {
+			fail("expected at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("expected at most %d characters", *s.MaxLength)
+		}
+		if re := s.compiledPattern(); re != nil && !re.MatchString(v) {
+			fail("value does not match pattern %q", s.Pattern)
+		}
+		if !validFormat(s.Format, v) {
+			fail("invalid %v %q", s.Format, v)
+		}
+	case json.Number, float64:
+		f := jsonFloat(v)
+		if s.Minimum != nil && f < *s.Minimum {
+			fail("value must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			fail("value must be at most %v", *s.Maximum)
+		}
+	}
+}
+
+// compiledPattern returns the compiled pattern of the schema. Patterns of
+// schemas built in Go rather than parsed are compiled on demand; invalid
+// patterns are reported by RequestSchema when the route is registered.
+func (s *Schema) compiledPattern() *regexp.Regexp {
+	if s.Pattern == "" {
+		return nil
+	}
+	if s.pattern != nil && s.pattern.String() == s.Pattern {
+		return s.pattern
+	}
+	re, _ := regexp.Compile(s.Pattern)
+	return re
+}
+
+// compile compiles the patterns of the schema and its subschemas, and returns
+// an error if one is invalid.
+func (s *Schema) compile() error {
+	if s == nil {
+		return nil
+	}
+	if s.Pattern != "" {
+		var err error
+		if s.pattern, err = regexp.Compile(s.Pattern); err != nil {
+			return fmt.Errorf("invalid schema pattern %q: %v", s.Pattern, err)
+		}
+	}
+	for _, prop := range s.Properties {
+		if err := prop.compile(); err != nil {
+			return err
+		}
+	}
+	if err := s.AdditionalProperties.compile(); err != nil {
+		return err
+	}
+	return s.Items.compile()
+}
+
+// jsonTypeOf returns the JSON Schema type of a decoded JSON value.
+func jsonTypeOf(v interface{}) string {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number, float64:
+		if f := jsonFloat(v); f == math.Trunc(f) && !math.IsInf(f, 0) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func jsonFloat(v interface{}) float64 {
+	switch v := v.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	case float64:
+		return v
+	}
+	return 0
+}
+
+// inEnum reports whether the value is one of the enum values.
+func inEnum(v interface{}, enum []interface{}) bool {
+	for _, e := range enum {
+		if isJSONNumber(v) && isJSONNumber(e) {
+			if jsonFloat(v) == jsonFloat(e) {
+				return true
+			}
+		} else if reflect.DeepEqual(v, e) {
+			return true
+		}
+	}
+	return false
+}
+
+func isJSONNumber(v interface{}) bool {
+	switch v.(type) {
+	case json.Number, float64:
+		return true
+	}
+	return false
+}
+
+func enumString(enum []interface{}) string {
+	values := make([]string, len(enum))
+	for i, e := range enum {
+		b, _ := json.Marshal(e)
+		values[i] = string(b)
+	}
+	return strings.Join(values, ", ")
+}
+
+// validFormat reports whether the string is valid for the format. Unknown
+// formats are not checked.
+func validFormat(format, s string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, s)
+		return err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", s)
+		return err == nil
+	case "uuid":
+		return isUUID(s)
+	case "email":
+		i := strings.LastIndexByte(s, '@')
+		return i > 0 && i < len(s)-1 && !strings.ContainsAny(s, " \t\r\n")
+	case "uri":
+		u, err := url.Parse(s)
+		return err == nil && u.IsAbs()
+	}
+	return true
+}
+
+// escapePointer escapes a JSON Pointer reference token.
+func escapePointer(s string) string {
+	return strings.Replace(strings.Replace(s, "~", "~0", -1), "/", "~1", -1)
+}
+
+// RequestSchema is a RouteOption validating the request bodies against the
+// schema before the endpoint is called, after the middleware. Bodies not
+// matching it are rejected with a 422 error listing the violations, and
+// malformed bodies with a 400 error. The schema is available in the
+// RequestSchema field of the route, e.g. for documentation. It panics if a
+// pattern of the schema is invalid.
+//
+// For example:
+//
+//	r.Post("/orders", createOrder, jsonrest.RequestSchema(jsonrest.SchemaOf(CreateOrder{})))
+func RequestSchema(s *Schema) RouteOption {
+	if err := s.compile(); err != nil {
+		panic("jsonrest: " + err.Error())
+	}
+	return func(r *Route) {
+		r.RequestSchema = s
+	}
+}
+
+// validateRequestEndpoint wraps the endpoint to validate the request bodies
+// against the schema.
+func validateRequestEndpoint(endpoint Endpoint, s *Schema) Endpoint {
+	return func(ctx context.Context, req *Request) (interface{}, error) {
+		data, err := ioutil.ReadAll(req.req.Body)
+		req.req.Body.Close()
+		if err != nil {
+			if httpErr, ok := err.(*HTTPError); ok {
+				return nil, httpErr
+			}
+			return nil, BadRequest("cannot read request body").Wrap(err)
+		}
+		req.req.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+		// The body is validated as BindBody decodes it, with its keys
+		// converted to the request key case.
+		if req.router != nil && req.router.requestKeyCase != 0 {
+			if converted, err := convertKeys(data, req.router.requestKeyCase); err == nil {
+				data = converted
+			}
+		}
+		var violations []SchemaViolation
+		if len(bytes.TrimSpace(data)) == 0 {
+			violations = s.Validate(nil)
+		} else if violations, err = s.ValidateJSON(data); err != nil {
+			msg := "malformed or unexpected json"
+			if details := jsonErrorDetails(err, data); details != "" {
+				msg += ": " + details
+			}
+			return nil, BadRequest(msg).Wrap(err)
+		}
+		if len(violations) > 0 {
+			return nil, schemaError("request body does not match the schema", violations)
+		}
+		return endpoint(ctx, req)
+	}
+}
+
+// schemaError returns a 422 error listing the violations.
+func schemaError(msg string, violations []SchemaViolation) *HTTPError {
+	err := UnprocessableEntity(msg)
+	for _, v := range violations {
+		err.Details = append(err.Details, v.String())
+	}
+	return err
+}
+
+// ResponseSchema is a RouteOption declaring the schema of the successful
+// response bodies of the route, e.g. for documentation. Responses are
+// validated against it if WithResponseValidation is enabled. It panics if a
+// pattern of the schema is invalid.
+//
+// For example:
+//
+//	r.Get("/orders/:id", getOrder, jsonrest.ResponseSchema(jsonrest.SchemaOf(Order{})))
+func ResponseSchema(s *Schema) RouteOption {
+	if err := s.compile(); err != nil {
+		panic("jsonrest: " + err.Error())
+	}
+	return func(r *Route) {
+		r.ResponseSchema = s
+	}
+}
+
+// WithResponseValidation is an Option available for NewRouter and Group to
+// validate the successful responses of the routes against their
+// ResponseSchema, and log the mismatches. Responses are validated as they are
+// sent, e.g. with their keys converted by WithJSONKeyCase, except for the
+// sparse fieldsets selected with WithSparseFieldsets, which are not
+// validated. If strict, mismatching responses are replaced with a 500 error
+// listing the violations, so that tests fail loudly. It is meant for
+// development, CI and integration environments, to catch contract drift
+// before clients do; it slows down the responses.
+func WithResponseValidation(strict bool) Option {
+	return func(r *Router) {
+		r.validateResponses, r.strictResponses = true, strict
+	}
+}
+
+// validatingSender wraps send to validate the successful responses against
+// the route's response schema, and, in strict mode, to send an error instead
+// of mismatching responses, updating the status.
+func (r *Router) validatingSender(send func(http.ResponseWriter, int, interface{}), route *Route, req *http.Request, status *int) func(http.ResponseWriter, int, interface{}) {
+	return func(w http.ResponseWriter, st int, v interface{}) {
+		if st < 300 {
+			if err := r.validateResponse(route, v); err != nil {
+				*status = http.StatusInternalServerError
+				r.sendError(w, req, err)
+				return
+			}
+		}
+		send(w, st, v)
+	}
+}
+
+// validateResponse validates the response body against the route's response
+// schema.
+func (r *Router) validateResponse(route *Route, body interface{}) error {
+	if body == nil {
+		return nil
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		// The encoding error is reported when the response is sent.
+		return nil
+	}
+	violations, err := route.ResponseSchema.ValidateJSON(data)
+	if err != nil || len(violations) == 0 {
+		return nil
+	}
+	details := make([]string, len(violations))
+	for i, v := range violations {
+		details[i] = v.String()
+	}
+	log.Printf("jsonrest: response of %v %v does not match the schema: %v", route.Method, route.Path, strings.Join(details, "; "))
+	if !r.strictResponses {
+		return nil
+	}
+	return &HTTPError{
+		Status:  http.StatusInternalServerError,
+		Code:    "response_schema_mismatch",
+		Message: "response body does not match the schema",
+		Details: details,
+	}
+}
@@ -0,0 +1,114 @@
+package jsonrest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Scopes is a RouteOption declaring the scopes a caller must be granted to
+// call the route, e.g. "orders:write". They are enforced by ScopeMiddleware
+// and OIDCProvider.Middleware, and listed by Router.RegisteredRoutes and
+// Router.RequiredScopes for documentation, so that both cannot drift apart.
+// The requests to a route with scopes that neither middleware checked are
+// rejected with a 500 error instead of being served.
+func Scopes(scopes ...string) RouteOption {
+	return func(r *Route) {
+		r.Scopes = append(append([]string(nil), r.Scopes...), scopes...)
+	}
+}
+
+// ScopeMiddleware returns a middleware enforcing the scopes declared by the
+// routes with Scopes. granted returns the scopes granted to the caller; it
+// defaults to the "scope" or "scp" claim of the token verified by
+// OIDCProvider.Middleware (see Request.Claims). It must run after the
+// authentication middleware. Requests from unauthenticated callers are
+// rejected with a 401 error, and requests missing a scope with a 403 error.
+func ScopeMiddleware(granted func(req *Request) []string) Middleware {
+	if granted == nil {
+		granted = claimScopes
+	}
+	return func(next Endpoint) Endpoint {
+		return func(ctx context.Context, req *Request) (interface{}, error) {
+			if req.routeInfo != nil && len(req.routeInfo.Scopes) > 0 {
+				if err := checkScopes(req, granted(req)); err != nil {
+					return nil, err
+				}
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+// RequiredScopes returns the scopes declared by the routes registered with
+// the router and its groups, sorted.
+func (r *Router) RequiredScopes() []string {
+	seen := make(map[string]bool)
+	scopes := []string{}
+	for _, route := range r.RegisteredRoutes() {
+		for _, scope := range route.Scopes {
+			if !seen[scope] {
+				seen[scope] = true
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+// requireScopeCheck returns an endpoint rejecting the requests whose scopes
+// were not checked by the middleware, so that a route declaring scopes fails
+// closed when ScopeMiddleware is missing.
+func requireScopeCheck(endpoint Endpoint) Endpoint {
+	return func(ctx context.Context, req *Request) (interface{}, error) {
+		if !req.scopesChecked {
+			return nil, fmt.Errorf("jsonrest: scopes of %s %s not checked: use ScopeMiddleware or OIDCProvider.Middleware", req.Method(), req.Route())
+		}
+		return endpoint(ctx, req)
+	}
+}
+
+// checkScopes returns an error if one of the scopes of the request's route is
+// not granted.
+func checkScopes(req *Request, granted []string) error {
+	req.scopesChecked = true
+	if req.routeInfo == nil || len(req.routeInfo.Scopes) == 0 {
+		return nil
+	}
+	if len(granted) == 0 && req.Principal() == "" {
+		return Unauthorized("authentication required")
+	}
+	has := make(map[string]bool, len(granted))
+	for _, scope := range granted {
+		has[scope] = true
+	}
+	var missing []string
+	for _, scope := range req.routeInfo.Scopes {
+		if !has[scope] {
+			missing = append(missing, scope)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	req.SetResponseHeader("WWW-Authenticate", `Bearer error="insufficient_scope", scope=`+strconv.Quote(strings.Join(req.routeInfo.Scopes, " ")))
+	err := Error(http.StatusForbidden, "insufficient_scope", "missing required scopes")
+	for _, scope := range missing {
+		err.Details = append(err.Details, "missing scope "+strconv.Quote(scope))
+	}
+	return err
+}
+
+// claimScopes returns the scopes granted by the "scope" or "scp" claim of the
+// request's token.
+func claimScopes(req *Request) []string {
+	claims := req.Claims()
+	if scopes := claims.Strings("scope"); len(scopes) > 0 {
+		return scopes
+	}
+	return claims.Strings("scp")
+}
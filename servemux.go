@@ -0,0 +1,114 @@
+package jsonrest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// WithServeMuxPatterns is an Option available for NewRouter to accept the
+// path patterns of net/http.ServeMux (Go 1.22) in Handle, RouteMap and
+// HandlePattern, easing the migration of code written for it: "{id}"
+// wildcards match a path segment, and a final "{path...}" wildcard the rest
+// of the path, without its leading slash like Request.PathValue. As with
+// ServeMux, the GET routes of a RouteMap also match HEAD requests, unless the
+// map has a HEAD route for the same path. Unlike ServeMux, a pattern ending
+// with a slash only matches that path, as if it ended with "{$}". Patterns
+// with a host are not supported.
+func WithServeMuxPatterns() Option {
+	return func(r *Router) {
+		r.serveMuxPatterns = true
+	}
+}
+
+// patternMethods are the methods a pattern without a method is registered
+// for.
+var patternMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// HandlePattern registers the endpoint for a net/http.ServeMux pattern with
+// an optional method, e.g. "GET /users/{id}". A pattern without a method is
+// registered for all the common methods, and a GET pattern also matches HEAD
+// requests, like with ServeMux. The path uses the ServeMux syntax if
+// WithServeMuxPatterns is set, or the router's syntax otherwise.
+func (r *Router) HandlePattern(pattern string, endpoint Endpoint, opts ...RouteOption) {
+	method, path := "", strings.TrimSpace(pattern)
+	if i := strings.IndexAny(path, " \t"); i >= 0 {
+		method, path = path[:i], strings.TrimSpace(path[i:])
+	}
+	if method == "" {
+		for _, m := range patternMethods {
+			r.Handle(m, path, endpoint, opts...)
+		}
+		return
+	}
+	if method == http.MethodGet {
+		r.handleGetAndHead(path, endpoint, opts...)
+		return
+	}
+	r.Handle(method, path, endpoint, opts...)
+}
+
+// handleGetAndHead registers the endpoint for the GET and HEAD requests to
+// the path, like a ServeMux GET pattern. The HEAD route is not registered if
+// the GET route is invalid, so that its error is not recorded twice.
+func (r *Router) handleGetAndHead(path string, endpoint Endpoint, opts ...RouteOption) {
+	failed := len(r.root().registrationErrors)
+	r.Handle(http.MethodGet, path, endpoint, opts...)
+	if len(r.root().registrationErrors) == failed {
+		r.Handle(http.MethodHead, path, endpoint, opts...)
+	}
+}
+
+// translatePattern converts the path of a net/http.ServeMux pattern to the
+// httprouter syntax, e.g. "/users/{id}" to "/users/:id", and returns the name
+// of its final "{name...}" wildcard, if any. It panics if the pattern is
+// invalid.
+func translatePattern(pattern string) (path, rest string) {
+	if !strings.HasPrefix(pattern, "/") {
+		panic(fmt.Errorf("unsupported pattern %q: patterns with a host are not supported", pattern))
+	}
+	segments := strings.Split(pattern, "/")
+	for i, seg := range segments {
+		if !strings.HasPrefix(seg, "{") {
+			if strings.ContainsAny(seg, "{}") {
+				panic(fmt.Errorf("invalid pattern %q: wildcards must be full path segments", pattern))
+			}
+			continue
+		}
+		if !strings.HasSuffix(seg, "}") {
+			panic(fmt.Errorf("invalid pattern %q: unterminated wildcard", pattern))
+		}
+		name := seg[1 : len(seg)-1]
+		last := i == len(segments)-1
+		switch {
+		case name == "$" && last:
+			segments[i] = ""
+		case strings.HasSuffix(name, "...") && last:
+			rest = strings.TrimSuffix(name, "...")
+			segments[i] = "*" + rest
+		case name != "" && !strings.ContainsAny(name, "$."):
+			segments[i] = ":" + name
+		default:
+			panic(fmt.Errorf("invalid pattern %q: invalid wildcard %q", pattern, seg))
+		}
+	}
+	return strings.Join(segments, "/"), rest
+}
+
+// trimRestWildcard returns a handle removing the leading slash of the value
+// of the catch-all parameter, which httprouter keeps and ServeMux does not.
+func trimRestWildcard(name string, h Handle) Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps Params) {
+		trimmed := make(Params, len(ps))
+		for i, p := range ps {
+			if p.Key == name {
+				p.Value = strings.TrimPrefix(p.Value, "/")
+			}
+			trimmed[i] = p
+		}
+		h(w, req, trimmed)
+	}
+}
@@ -0,0 +1,262 @@
+package jsonrest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"time"
+)
+
+// ShadowOptions configures ShadowMiddleware. Exactly one of Endpoint and URL
+// must be set.
+type ShadowOptions struct {
+	// Endpoint is the secondary implementation the requests are duplicated
+	// to. It is called with a detached copy of the request.
+	Endpoint Endpoint
+
+	// URL is the base URL of the secondary service the requests are
+	// duplicated to, e.g. "http://pricing-v2.internal". The path and query
+	// of the requests are appended to it, and their headers are forwarded.
+	URL *url.URL
+
+	// Client sends the requests to URL. It defaults to a client with a 10
+	// seconds timeout.
+	Client *http.Client
+
+	// Match, if set, selects the requests to duplicate among the GET and HEAD
+	// requests, or among all the requests with UnsafeMethods. All the GET and
+	// HEAD requests are duplicated by default.
+	Match RequestPredicate
+
+	// UnsafeMethods enables duplicating the requests with other methods than
+	// GET and HEAD, e.g. POST. The secondary must then not apply their side
+	// effects a second time: the duplicates carry the same body and headers,
+	// including Authorization and Cookie, as the original requests.
+	UnsafeMethods bool
+
+	// MaxBodySize is the maximum size of the request bodies which are
+	// duplicated; requests with larger bodies are not. It defaults to 1 MiB.
+	MaxBodySize int64
+
+	// OnResult, if set, is called with the comparison of the primary and
+	// secondary responses, e.g. to record divergence metrics.
+	OnResult func(ctx context.Context, res ShadowResult)
+}
+
+// A ShadowResult compares the response of a request with the response of its
+// duplicate.
+type ShadowResult struct {
+	Method string
+	Route  string
+
+	PrimaryStatus int
+	ShadowStatus  int
+
+	// Diverged indicates that the status codes or the JSON bodies of the
+	// responses differ.
+	Diverged bool
+
+	// Duration is how long the secondary took to respond.
+	Duration time.Duration
+
+	// Err is the error sending the duplicate to URL, if any, in which case
+	// the responses are not compared.
+	Err error
+}
+
+// defaultShadowClient sends the duplicated requests when
+// ShadowOptions.Client is nil.
+var defaultShadowClient = &http.Client{Timeout: 10 * time.Second}
+
+// ShadowMiddleware returns a middleware duplicating the requests to a
+// secondary endpoint or service, e.g. to validate a new implementation
+// against production traffic. The duplicate is sent in a background job (see
+// Request.Go) once the response is sent, and its response is discarded after
+// being compared with the primary response. Only the GET and HEAD requests
+// are duplicated unless ShadowOptions.UnsafeMethods is set.
+func ShadowMiddleware(opts ShadowOptions) Middleware {
+	if (opts.Endpoint == nil) == (opts.URL == nil) {
+		panic("jsonrest: ShadowMiddleware requires exactly one of Endpoint and URL")
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 1 << 20
+	}
+	if opts.Client == nil {
+		opts.Client = defaultShadowClient
+	}
+	return func(next Endpoint) Endpoint {
+		return func(ctx context.Context, req *Request) (interface{}, error) {
+			safe := req.Method() == http.MethodGet || req.Method() == http.MethodHead
+			if (!safe && !opts.UnsafeMethods) || (opts.Match != nil && !opts.Match(req)) {
+				return next(ctx, req)
+			}
+			body, ok, err := peekBody(req.req, opts.MaxBodySize)
+			if err != nil || !ok {
+				return next(ctx, req)
+			}
+
+			result, err := next(ctx, req)
+			if !cacheable(result) {
+				return result, err
+			}
+			primary := shadowResponse{status: responseStatus(result, err)}
+			if err == nil {
+				primary.body = result
+				if res, ok := result.(Response); ok {
+					primary.body = res.Body
+				}
+			}
+
+			shadow := req.detached()
+			shadow.req.Body = ioutil.NopCloser(bytes.NewReader(body))
+			header := req.req.Header.Clone()
+			req.Go(func(ctx context.Context) {
+				res := ShadowResult{
+					Method:        shadow.Method(),
+					Route:         shadow.Route(),
+					PrimaryStatus: primary.status,
+				}
+				start := time.Now()
+				var secondary shadowResponse
+				if opts.Endpoint != nil {
+					secondary = callShadowEndpoint(ctx, opts.Endpoint, shadow)
+				} else {
+					secondary, res.Err = sendShadowRequest(ctx, opts.Client, opts.URL, shadow.req, header, body)
+				}
+				res.Duration = time.Since(start)
+				res.ShadowStatus = secondary.status
+				if res.Err == nil {
+					res.Diverged = primary.diverges(secondary)
+				}
+				if opts.OnResult != nil {
+					opts.OnResult(ctx, res)
+				}
+			})
+			return result, err
+		}
+	}
+}
+
+// shadowResponse is a response compared by ShadowMiddleware.
+type shadowResponse struct {
+	status int
+
+	// body is the result of the endpoint, or the decoded JSON body of the
+	// response of the secondary service.
+	body interface{}
+}
+
+// diverges reports whether the status codes or the JSON bodies of the
+// responses differ. Error bodies are not compared.
+func (r shadowResponse) diverges(other shadowResponse) bool {
+	if r.status != other.status {
+		return true
+	}
+	if r.status >= 400 {
+		return false
+	}
+	a, errA := normalizeJSON(r.body)
+	b, errB := normalizeJSON(other.body)
+	return errA != nil || errB != nil || !reflect.DeepEqual(a, b)
+}
+
+// normalizeJSON returns v as decoded by encoding/json into an interface{}.
+func normalizeJSON(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var n interface{}
+	err = json.Unmarshal(b, &n)
+	return n, err
+}
+
+// callShadowEndpoint calls the secondary endpoint with the detached request.
+func callShadowEndpoint(ctx context.Context, e Endpoint, req *Request) (res shadowResponse) {
+	defer func() {
+		if r := recover(); r != nil {
+			res = shadowResponse{status: http.StatusInternalServerError}
+		}
+	}()
+	result, err := e(ctx, req)
+	res.status = responseStatus(result, err)
+	if err == nil {
+		res.body = result
+		if r, ok := result.(Response); ok {
+			res.body = r.Body
+		}
+	}
+	return res
+}
+
+// sendShadowRequest sends a duplicate of the request to the base URL.
+func sendShadowRequest(ctx context.Context, client *http.Client, base *url.URL, req *http.Request, header http.Header, body []byte) (shadowResponse, error) {
+	u := *base
+	u.Path = singleJoiningSlash(base.Path, req.URL.Path)
+	u.RawQuery = req.URL.RawQuery
+	var r io.Reader
+	if len(body) > 0 {
+		r = bytes.NewReader(body)
+	}
+	out, err := http.NewRequest(req.Method, u.String(), r)
+	if err != nil {
+		return shadowResponse{}, err
+	}
+	out = out.WithContext(ctx)
+	out.Header = header
+	out.Header.Del("Accept-Encoding")
+
+	resp, err := client.Do(out)
+	if err != nil {
+		return shadowResponse{}, err
+	}
+	defer resp.Body.Close()
+	res := shadowResponse{status: resp.StatusCode}
+	if resp.StatusCode < 400 {
+		if err := json.NewDecoder(resp.Body).Decode(&res.body); err != nil && err != io.EOF {
+			return res, fmt.Errorf("decoding shadow response: %v", err)
+		}
+	}
+	return res, nil
+}
+
+// peekBody reads the request body, up to max bytes, and replaces it with an
+// equivalent reader. It reports false if the body is larger than max.
+func peekBody(req *http.Request, max int64) ([]byte, bool, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true, nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, max+1))
+	rest := req.Body
+	req.Body = readCloser{io.MultiReader(bytes.NewReader(body), rest), rest}
+	if err != nil {
+		return nil, false, err
+	}
+	return body, int64(len(body)) <= max, nil
+}
+
+// readCloser is an io.ReadCloser reading from a reader and closing a closer.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// singleJoiningSlash joins the URL paths with a single slash, like
+// httputil.NewSingleHostReverseProxy.
+func singleJoiningSlash(a, b string) string {
+	aslash := len(a) > 0 && a[len(a)-1] == '/'
+	bslash := len(b) > 0 && b[0] == '/'
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
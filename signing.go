@@ -0,0 +1,240 @@
+package jsonrest
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The headers of signed requests, see RequestSigner.
+const (
+	HeaderSignature          = "X-Signature"
+	HeaderSignatureKeyID     = "X-Signature-Key-Id"
+	HeaderSignatureTimestamp = "X-Signature-Timestamp"
+	HeaderSignatureNonce     = "X-Signature-Nonce"
+)
+
+// A RequestSigner signs outbound requests with a shared secret, for
+// service-to-service authentication verified by SignatureMiddleware. The
+// signature is the base64-encoded HMAC-SHA256 of the method, the request URI,
+// a unix timestamp, a random nonce and the SHA-256 digest of the body.
+type RequestSigner struct {
+	KeyID  string
+	Secret []byte
+}
+
+// NewRequestSigner returns a RequestSigner signing with the secret identified
+// by the key ID.
+func NewRequestSigner(keyID string, secret []byte) *RequestSigner {
+	return &RequestSigner{KeyID: keyID, Secret: secret}
+}
+
+// Sign signs the request, setting its signature headers. The body, if any, is
+// read into memory and replaced.
+func (s *RequestSigner) Sign(req *http.Request) error {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	n := hex.EncodeToString(nonce)
+	req.Header.Set(HeaderSignatureKeyID, s.KeyID)
+	req.Header.Set(HeaderSignatureTimestamp, ts)
+	req.Header.Set(HeaderSignatureNonce, n)
+	req.Header.Set(HeaderSignature, base64.StdEncoding.EncodeToString(
+		signature(s.Secret, req.Method, req.URL.RequestURI(), ts, n, body)))
+	return nil
+}
+
+// Transport returns an http.RoundTripper signing the requests sent through
+// base, or http.DefaultTransport if nil, e.g. for the Transport of an
+// http.Client.
+func (s *RequestSigner) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return signingTransport{signer: s, base: base}
+}
+
+type signingTransport struct {
+	signer *RequestSigner
+	base   http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t signingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the request.
+	req = req.Clone(req.Context())
+	if err := t.signer.Sign(req); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// A NonceStore records the nonces of verified signed requests, to reject
+// replays. Its methods must be safe for concurrent use.
+type NonceStore interface {
+	// Use records the nonce until it expires. It returns false if the
+	// nonce was already used.
+	Use(ctx context.Context, nonce string, expires time.Time) (bool, error)
+}
+
+// SignatureOptions configures SignatureMiddleware.
+type SignatureOptions struct {
+	// Secret returns the secret identified by a key ID, or false if the key
+	// is unknown. It is required.
+	Secret func(ctx context.Context, keyID string) ([]byte, bool)
+
+	// Window is how far the timestamp of a request may be from the current
+	// time. It defaults to 5 minutes.
+	Window time.Duration
+
+	// Nonces records the nonces of the requests. It defaults to an
+	// in-memory store.
+	Nonces NonceStore
+
+	// MaxBodySize is the maximum size of the bodies read to verify their
+	// digest. It defaults to 1 MiB.
+	MaxBodySize int64
+}
+
+var errInvalidSignature = Unauthorized("invalid request signature")
+
+// SignatureMiddleware returns a middleware verifying the requests signed with
+// a RequestSigner. Requests with a missing or invalid signature, a timestamp
+// outside the window or a reused nonce are rejected with a 401 error. The key
+// ID of verified requests is set as their principal (see Request.Principal).
+func SignatureMiddleware(opts SignatureOptions) Middleware {
+	if opts.Secret == nil {
+		panic("jsonrest: SignatureOptions.Secret is required")
+	}
+	if opts.Window <= 0 {
+		opts.Window = 5 * time.Minute
+	}
+	if opts.Nonces == nil {
+		opts.Nonces = NewMemoryNonceStore()
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 1 << 20
+	}
+
+	return func(next Endpoint) Endpoint {
+		return func(ctx context.Context, req *Request) (interface{}, error) {
+			h := req.Raw().Header
+			keyID, ts, nonce := h.Get(HeaderSignatureKeyID), h.Get(HeaderSignatureTimestamp), h.Get(HeaderSignatureNonce)
+			sig, err := base64.StdEncoding.DecodeString(h.Get(HeaderSignature))
+			if err != nil || len(sig) == 0 || keyID == "" || nonce == "" {
+				return nil, Unauthorized("missing or malformed request signature")
+			}
+			unix, err := strconv.ParseInt(ts, 10, 64)
+			if err != nil {
+				return nil, Unauthorized("invalid request signature timestamp")
+			}
+			signedAt := time.Unix(unix, 0)
+			if d := time.Since(signedAt); d > opts.Window || d < -opts.Window {
+				return nil, Unauthorized("request signature expired")
+			}
+			secret, ok := opts.Secret(ctx, keyID)
+			if !ok {
+				return nil, errInvalidSignature
+			}
+
+			var body []byte
+			if raw := req.Raw().Body; raw != nil && raw != http.NoBody {
+				body, err = ioutil.ReadAll(io.LimitReader(raw, opts.MaxBodySize+1))
+				raw.Close()
+				if err != nil {
+					return nil, BadRequest("cannot read request body").Wrap(err)
+				}
+				if int64(len(body)) > opts.MaxBodySize {
+					return nil, errBodyTooLarge()
+				}
+				req.Raw().Body = ioutil.NopCloser(bytes.NewReader(body))
+			}
+			want := signature(secret, req.Method(), req.Raw().URL.RequestURI(), ts, nonce, body)
+			if !hmac.Equal(sig, want) {
+				return nil, errInvalidSignature
+			}
+
+			// Nonces are only recorded once the signature is verified, so
+			// that forged requests cannot burn them. They are kept until
+			// the timestamp falls out of the window.
+			fresh, err := opts.Nonces.Use(ctx, keyID+" "+nonce, signedAt.Add(opts.Window))
+			if err != nil {
+				return nil, err
+			}
+			if !fresh {
+				return nil, Unauthorized("request signature replayed")
+			}
+			req.SetPrincipal(keyID)
+			return next(ctx, req)
+		}
+	}
+}
+
+// signature returns the HMAC-SHA256 of the canonical form of a request.
+func signature(secret []byte, method, uri, ts, nonce string, body []byte) []byte {
+	digest := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	io.WriteString(mac, strings.Join([]string{
+		strings.ToUpper(method), uri, ts, nonce, hex.EncodeToString(digest[:]),
+	}, "\n"))
+	return mac.Sum(nil)
+}
+
+// memoryNonceStore is an in-memory NonceStore.
+type memoryNonceStore struct {
+	mu      sync.Mutex
+	nonces  map[string]time.Time
+	sweepAt time.Time // next removal of the expired nonces
+}
+
+// NewMemoryNonceStore returns a NonceStore keeping the nonces in memory. It is
+// meant for single-instance services and tests; replicated services need a
+// shared store, e.g. backed by Redis.
+func NewMemoryNonceStore() NonceStore {
+	return &memoryNonceStore{nonces: make(map[string]time.Time)}
+}
+
+// Use implements the NonceStore interface.
+func (s *memoryNonceStore) Use(ctx context.Context, nonce string, expires time.Time) (bool, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.After(s.sweepAt) {
+		for n, exp := range s.nonces {
+			if now.After(exp) {
+				delete(s.nonces, n)
+			}
+		}
+		s.sweepAt = now.Add(time.Minute)
+	}
+	if exp, ok := s.nonces[nonce]; ok && now.Before(exp) {
+		return false, nil
+	}
+	s.nonces[nonce] = expires
+	return true, nil
+}
@@ -0,0 +1,91 @@
+package jsonrest
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// flightCall is an endpoint call shared by identical requests.
+type flightCall struct {
+	done   chan struct{}
+	res    StoredResponse
+	shared bool // res can be replayed
+	err    error
+}
+
+// SingleFlightMiddleware returns a middleware coalescing the identical GET
+// requests handled concurrently into a single endpoint call, e.g. to protect
+// expensive read endpoints from thundering herds. The requests waiting for the
+// call get the same response, encoded once, along with the headers set by the
+// endpoint. Requests are identical if key returns the same non-empty string
+// for them; it defaults to the URL path and query of the request, and its
+// principal, and to "" for requests with credentials but no principal, e.g.
+// when the middleware runs before the authentication, which are never
+// coalesced.
+//
+// The call is made with the context of the first request: if it is canceled,
+// the waiting requests fail too.
+func SingleFlightMiddleware(key func(*Request) string) Middleware {
+	if key == nil {
+		key = defaultFlightKey
+	}
+	var mu sync.Mutex
+	calls := make(map[string]*flightCall)
+
+	return func(next Endpoint) Endpoint {
+		return func(ctx context.Context, req *Request) (interface{}, error) {
+			if req.Method() != http.MethodGet {
+				return next(ctx, req)
+			}
+			k := key(req)
+			if k == "" {
+				return next(ctx, req)
+			}
+			mu.Lock()
+			if c, ok := calls[k]; ok {
+				mu.Unlock()
+				select {
+				case <-c.done:
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+				if c.shared {
+					return replayResponse(req, &c.res), nil
+				}
+				if c.err != nil {
+					return nil, c.err
+				}
+				// The response cannot be replayed, e.g. a HandlerResponse.
+				return next(ctx, req)
+			}
+			c := &flightCall{done: make(chan struct{})}
+			calls[k] = c
+			mu.Unlock()
+
+			defer func() {
+				mu.Lock()
+				delete(calls, k)
+				mu.Unlock()
+				close(c.done)
+			}()
+			before := req.responseWriter.Header().Clone()
+			result, err := next(ctx, req)
+			c.err = err
+			if err == nil {
+				c.res, c.shared = captureResponse(req, before, result, nil)
+			}
+			return result, err
+		}
+	}
+}
+
+// defaultFlightKey returns the URL path and query and the principal of the
+// request, or "" for credentialed requests without a principal.
+func defaultFlightKey(req *Request) string {
+	principal := req.Principal()
+	if principal == "" && (req.Header("Authorization") != "" || req.Header("Cookie") != "") {
+		return ""
+	}
+	return req.URL().RequestURI() + " " + principal
+}
@@ -0,0 +1,94 @@
+package jsonrest
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// An SLOPolicy is applied to all the routes of an SLO class, e.g. "critical",
+// "standard" or "bulk", so that operational policies can be managed per class
+// instead of per route.
+type SLOPolicy struct {
+	// Timeout, if positive, is the deadline set on the context of the
+	// class's requests.
+	Timeout time.Duration
+
+	// MaxConcurrent, if positive, is the maximum number of the class's
+	// requests handled concurrently. Excess requests are rejected with a 503
+	// Service Unavailable error.
+	MaxConcurrent int
+}
+
+// sloPolicy is an SLOPolicy along with its concurrency limiter.
+type sloPolicy struct {
+	SLOPolicy
+	sem chan struct{}
+}
+
+// errOverloaded is returned when a request is shed by its SLO class.
+var errOverloaded = Error(http.StatusServiceUnavailable, "overloaded", "too many requests, try again later")
+
+// WithSLOClass is an Option available for NewRouter and Group to set the SLO
+// class of the routes registered with the router. It can be overridden per
+// route with SLOClass.
+func WithSLOClass(class string) Option {
+	return func(r *Router) {
+		r.sloClass = class
+	}
+}
+
+// WithSLOPolicy is an Option available for NewRouter to set the policy of an
+// SLO class. It has no effect on groups.
+func WithSLOPolicy(class string, policy SLOPolicy) Option {
+	return func(r *Router) {
+		if r.parent != nil {
+			return
+		}
+		if r.sloPolicies == nil {
+			r.sloPolicies = make(map[string]*sloPolicy)
+		}
+		p := &sloPolicy{SLOPolicy: policy}
+		if policy.MaxConcurrent > 0 {
+			p.sem = make(chan struct{}, policy.MaxConcurrent)
+		}
+		r.sloPolicies[class] = p
+	}
+}
+
+// SLOClass is a RouteOption that sets the SLO class of the route, e.g. to
+// label its metrics and apply the policy of the class.
+func SLOClass(class string) RouteOption {
+	return func(r *Route) {
+		r.SLOClass = class
+	}
+}
+
+// SLOClass returns the SLO class of the route, if any.
+func (r *Request) SLOClass() string {
+	if r.routeInfo == nil {
+		return ""
+	}
+	return r.routeInfo.SLOClass
+}
+
+// sloHandle wraps the handle to apply the SLO policy.
+func sloHandle(p *sloPolicy, h Handle, r *Router) Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps Params) {
+		if p.sem != nil {
+			select {
+			case p.sem <- struct{}{}:
+				defer func() { <-p.sem }()
+			default:
+				r.sendError(w, req, errOverloaded)
+				return
+			}
+		}
+		if p.Timeout > 0 {
+			ctx, cancel := context.WithTimeout(req.Context(), p.Timeout)
+			defer cancel()
+			req = req.WithContext(ctx)
+		}
+		h(w, req, ps)
+	}
+}
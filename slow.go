@@ -0,0 +1,84 @@
+package jsonrest
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"time"
+)
+
+// A SlowRequest describes a request whose handler exceeded the slow request
+// threshold and is still running.
+type SlowRequest struct {
+	Method string
+	Route  string
+
+	// Duration is the time elapsed since the handler started.
+	Duration time.Duration
+
+	// Stack is a snapshot of the stack of the goroutine running the handler
+	// when the threshold was exceeded.
+	Stack []byte
+}
+
+// WithSlowRequestThreshold is an Option available for NewRouter and Group to
+// call fn from another goroutine when the middleware and endpoint of a request
+// are still running after the threshold d, e.g. to log where stuck endpoints
+// are blocked. The context is the request's context.
+func WithSlowRequestThreshold(d time.Duration, fn func(ctx context.Context, slow SlowRequest)) Option {
+	return func(r *Router) {
+		r.slowThreshold, r.slowRequestFunc = d, fn
+	}
+}
+
+// slowRequestEndpoint wraps e to call fn if it runs for longer than d.
+func slowRequestEndpoint(e Endpoint, route *Route, d time.Duration, fn func(context.Context, SlowRequest)) Endpoint {
+	return func(ctx context.Context, req *Request) (interface{}, error) {
+		start := time.Now()
+		id := goroutineID()
+		timer := time.AfterFunc(d, func() {
+			fn(ctx, SlowRequest{
+				Method:   route.Method,
+				Route:    route.Path,
+				Duration: time.Since(start),
+				Stack:    goroutineStack(id),
+			})
+		})
+		defer timer.Stop()
+		return e(ctx, req)
+	}
+}
+
+// goroutineID returns the header line identifying the current goroutine in
+// stack traces, e.g. "goroutine 42 ".
+func goroutineID() []byte {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	if i := bytes.IndexByte(b, '['); i > 0 {
+		return append([]byte(nil), b[:i]...)
+	}
+	return nil
+}
+
+// goroutineStack returns the stack trace of the goroutine with the given ID,
+// or nil if it has exited.
+func goroutineStack(id []byte) []byte {
+	if id == nil {
+		return nil
+	}
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		if bytes.HasPrefix(stack, id) {
+			return stack
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package jsonrest
+
+import (
+	"context"
+	"hash/fnv"
+	"math/rand"
+)
+
+// A WeightedEndpoint is an implementation of an endpoint receiving a share of
+// the traffic proportional to its weight, see Split.
+type WeightedEndpoint struct {
+	// Name identifies the implementation, e.g. "v1" or "rewrite", see
+	// Request.SplitVariant.
+	Name     string
+	Weight   int
+	Endpoint Endpoint
+}
+
+// A StickyKey returns the key of the request determining its implementation
+// in a Split, so that the requests with the same key are consistently served
+// by the same implementation. An empty key picks an implementation at random.
+type StickyKey func(*Request) string
+
+// StickyHeader returns a StickyKey using the value of the request header.
+func StickyHeader(name string) StickyKey {
+	return func(r *Request) string {
+		return r.Header(name)
+	}
+}
+
+// StickyCookie returns a StickyKey using the value of the request cookie.
+func StickyCookie(name string) StickyKey {
+	return func(r *Request) string {
+		if c := r.Cookie(name); c != nil {
+			return c.Value
+		}
+		return ""
+	}
+}
+
+// StickyPrincipal returns a StickyKey using the principal of the request, see
+// Request.SetPrincipal.
+func StickyPrincipal() StickyKey {
+	return func(r *Request) string {
+		return r.Principal()
+	}
+}
+
+type splitVariantKey struct{}
+
+// Split returns an endpoint routing the requests among the implementations in
+// proportion to their weights, e.g. to send 5% of the traffic to a rewritten
+// endpoint:
+//
+//	r.Get("/quotes", jsonrest.Split(jsonrest.StickyPrincipal(),
+//	    jsonrest.WeightedEndpoint{Name: "v1", Weight: 95, Endpoint: quotesV1},
+//	    jsonrest.WeightedEndpoint{Name: "v2", Weight: 5, Endpoint: quotesV2},
+//	))
+//
+// The implementation serving a request is picked by hashing its sticky key,
+// if sticky is not nil and the key is not empty, and at random otherwise. Its
+// name is available to middleware, e.g. to tag metrics, through
+// Request.SplitVariant, and recorded as a "split" request event. Split panics
+// if the total weight is not positive.
+func Split(sticky StickyKey, endpoints ...WeightedEndpoint) Endpoint {
+	total := 0
+	for _, e := range endpoints {
+		if e.Weight > 0 {
+			total += e.Weight
+		}
+	}
+	if total <= 0 {
+		panic("jsonrest: Split requires a positive total weight")
+	}
+
+	return func(ctx context.Context, req *Request) (interface{}, error) {
+		var n int
+		if key := stickyKey(sticky, req); key != "" {
+			h := fnv.New32a()
+			h.Write([]byte(key))
+			n = int(h.Sum32() % uint32(total))
+		} else {
+			n = rand.Intn(total)
+		}
+		for _, e := range endpoints {
+			if e.Weight <= 0 {
+				continue
+			}
+			if n < e.Weight {
+				req.Set(splitVariantKey{}, e.Name)
+				req.AddEvent("split", M{"variant": e.Name})
+				return e.Endpoint(ctx, req)
+			}
+			n -= e.Weight
+		}
+		panic("unreachable")
+	}
+}
+
+// stickyKey returns the sticky key of the request, or an empty string.
+func stickyKey(sticky StickyKey, req *Request) string {
+	if sticky == nil {
+		return ""
+	}
+	return sticky(req)
+}
+
+// SplitVariant returns the name of the implementation which served the
+// request in a Split, or an empty string. Middleware can read it once the
+// endpoint returns.
+func (r *Request) SplitVariant() string {
+	return r.GetString(splitVariantKey{})
+}
@@ -0,0 +1,134 @@
+package jsonrest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// ServeFiles serves files from the given file system root. The path must end
+// with "/*filepath", which names the file relative to root. For example, with
+// the path "/static/*filepath" and root http.Dir("public"), a request for
+// /static/app.css is served the local file "public/app.css".
+//
+// Unlike http.FileServer, missing files, and directories without an
+// index.html, are answered with a JSON 404 error: directories are never listed.
+// The router's middleware is applied to the file requests.
+func (r *Router) ServeFiles(path string, root http.FileSystem) {
+	r.serveFiles(path, root, false)
+}
+
+// ServeSPA serves a single-page application from the given file system root,
+// like ServeFiles. Requests for missing files are answered with the
+// application's index.html instead of a 404 error, so that the application
+// can handle its own routes. Routes registered outside of path keep their
+// JSON 404s.
+func (r *Router) ServeSPA(path string, root http.FileSystem) {
+	r.serveFiles(path, root, true)
+}
+
+// WithSPAFallback is an Option available for NewRouter to serve a single-page
+// application from root for GET and HEAD requests which match no route.
+// Missing files are answered with the application's index.html, except for
+// requests under one of the API path prefixes, which keep the JSON 404 of the
+// not found handler. The API prefix defaults to "/api/".
+func WithSPAFallback(root http.FileSystem, apiPrefixes ...string) Option {
+	if len(apiPrefixes) == 0 {
+		apiPrefixes = []string{"/api/"}
+	}
+	return func(r *Router) {
+		r.spaRoot = root
+		r.spaAPIPrefixes = apiPrefixes
+	}
+}
+
+// spaFallbackHandler returns a handler serving the router's single-page
+// application, or calling notFound for API and non-GET requests.
+func spaFallbackHandler(r *Router, notFound http.Handler) http.Handler {
+	h := endpointToHandler(fileEndpoint(r.spaRoot, true), &Route{}, r)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			notFound.ServeHTTP(w, req)
+			return
+		}
+		for _, prefix := range r.spaAPIPrefixes {
+			if strings.HasPrefix(req.URL.Path, prefix) {
+				notFound.ServeHTTP(w, req)
+				return
+			}
+		}
+		h(w, req, Params{{Key: "filepath", Value: req.URL.Path}})
+	})
+}
+
+func (r *Router) serveFiles(path string, root http.FileSystem, spa bool) {
+	if !strings.HasSuffix(path, "/*filepath") {
+		r.registrationFailed(&RouteError{Path: path, Err: errors.New("path must end with /*filepath")})
+		return
+	}
+	e := fileEndpoint(root, spa)
+	r.Get(path, e)
+	r.Head(path, e)
+}
+
+// fileEndpoint returns an endpoint which serves the file named by the
+// filepath URL parameter. If spa is set, missing files fall back to the
+// index.html of the root directory.
+func fileEndpoint(root http.FileSystem, spa bool) Endpoint {
+	root = noListingFileSystem{root}
+	fileServer := http.FileServer(root)
+	return func(_ context.Context, req *Request) (interface{}, error) {
+		name := path.Clean("/" + req.Param("filepath"))
+		f, err := root.Open(name)
+		switch {
+		case err == nil:
+			f.Close()
+		case !os.IsNotExist(err):
+			return nil, err
+		case spa:
+			name = "/" // served as the root index.html
+		default:
+			return nil, NotFound("file not found")
+		}
+
+		return ServeHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			u := *req.URL
+			u.Path = name
+			r := *req // shallow copy
+			r.URL = &u
+			fileServer.ServeHTTP(w, &r)
+		})), nil
+	}
+}
+
+// noListingFileSystem is a file system hiding the directories without an
+// index.html, so that http.FileServer does not list their content.
+type noListingFileSystem struct {
+	fs http.FileSystem
+}
+
+// Open implements the http.FileSystem interface.
+func (fs noListingFileSystem) Open(name string) (http.File, error) {
+	f, err := fs.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	var info interface{ IsDir() bool }
+	info, err = f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		index, err := fs.fs.Open(strings.TrimSuffix(name, "/") + "/index.html")
+		if err != nil {
+			f.Close()
+			return nil, os.ErrNotExist
+		}
+		index.Close()
+	}
+	return f, nil
+}
@@ -0,0 +1,143 @@
+package jsonrest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+// bufferedWriterPool holds the buffered writers used by streamJSON.
+var bufferedWriterPool = sync.Pool{
+	New: func() interface{} {
+		return bufio.NewWriterSize(nil, 32<<10)
+	},
+}
+
+// maxPooledBufferSize is the capacity above which buffers are not returned to
+// bufferPool, so that a few large responses don't pin memory.
+const maxPooledBufferSize = 1 << 20
+
+// bufferPool holds the buffers used by sendJSON.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// getBuffer returns an empty buffer from bufferPool.
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putBuffer returns buf to bufferPool.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBufferSize {
+		bufferPool.Put(buf)
+	}
+}
+
+// streamJSON encodes v as JSON and writes it to the response body through a
+// pooled buffered writer. Slices and arrays are encoded one element at a
+// time. The status is written with the first bytes of the body, so that an
+// unknown error can still be sent if v cannot be encoded before then.
+func (r *Router) streamJSON(w http.ResponseWriter, req *http.Request, status int, v interface{}) {
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+	if v == nil {
+		w.WriteHeader(status)
+		return
+	}
+
+	lw := &lazyHeaderWriter{ResponseWriter: w, status: status}
+	bw := bufferedWriterPool.Get().(*bufio.Writer)
+	bw.Reset(lw)
+	defer func() {
+		bw.Reset(nil)
+		bufferedWriterPool.Put(bw)
+	}()
+
+	err := r.encodeStream(bw, v)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		return
+	}
+	r.encodeFailed(req, err)
+	if !lw.wroteHeader {
+		w.Header().Del("content-type")
+		r.sendJSON(w, req, http.StatusInternalServerError, unknownError)
+	}
+}
+
+// lazyHeaderWriter is a ResponseWriter writing the status with the first
+// bytes of the body.
+type lazyHeaderWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+// Write implements the io.Writer interface.
+func (w *lazyHeaderWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// encodeStream writes v to bw, producing the same output as sendJSON.
+func (r *Router) encodeStream(bw *bufio.Writer, v interface{}) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	indent := !r.disableJSONIndent
+
+	rv := reflect.ValueOf(v)
+	isList := rv.Kind() == reflect.Array || (rv.Kind() == reflect.Slice && !rv.IsNil())
+	if !isList || rv.Type().Elem().Kind() == reflect.Uint8 || rv.Type().Implements(typeJSONMarshaler) {
+		// Not a list, or one with a custom encoding.
+		if indent {
+			enc.SetIndent("", "  ")
+		}
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		_, err := bw.Write(buf.Bytes())
+		return err
+	}
+
+	if rv.Len() == 0 {
+		_, err := bw.WriteString("[]\n")
+		return err
+	}
+	if indent {
+		enc.SetIndent("  ", "  ")
+	}
+	// Write errors are sticky, and reported by the final Flush.
+	bw.WriteByte('[')
+	for i := 0; i < rv.Len(); i++ {
+		if i > 0 {
+			bw.WriteByte(',')
+		}
+		if indent {
+			bw.WriteString("\n  ")
+		}
+		buf.Reset()
+		if err := enc.Encode(rv.Index(i).Interface()); err != nil {
+			return err
+		}
+		bw.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+	}
+	if indent {
+		bw.WriteByte('\n')
+	}
+	_, err := bw.WriteString("]\n")
+	return err
+}
+
+var typeJSONMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
@@ -0,0 +1,149 @@
+package jsonrest
+
+import (
+	"container/list"
+	"context"
+	"net"
+	"strings"
+	"sync"
+)
+
+type tenantKey struct{}
+
+// A TenantResolver returns the ID of the tenant a request is for, or an error
+// sent to the client instead, e.g. a 404 error for an unknown tenant. An empty
+// ID means the request is not for a tenant.
+type TenantResolver func(req *Request) (string, error)
+
+// WithTenantResolver is an Option available for NewRouter and Group to
+// resolve the tenant of each request before the middleware is called, so that
+// it is available with Request.Tenant.
+func WithTenantResolver(resolve TenantResolver) Option {
+	return func(r *Router) {
+		r.tenantResolver = resolve
+	}
+}
+
+// TenantFromSubdomain returns a TenantResolver using the subdomain of the
+// request host under the domain, e.g. "acme" for "acme.example.com" under
+// "example.com". Requests to the domain itself or other hosts have no tenant.
+func TenantFromSubdomain(domain string) TenantResolver {
+	suffix := "." + strings.ToLower(strings.TrimPrefix(domain, "."))
+	return func(req *Request) (string, error) {
+		host := req.Raw().Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.ToLower(host)
+		if !strings.HasSuffix(host, suffix) {
+			return "", nil
+		}
+		sub := strings.TrimSuffix(host, suffix)
+		if i := strings.LastIndexByte(sub, '.'); i >= 0 {
+			sub = sub[i+1:]
+		}
+		return sub, nil
+	}
+}
+
+// TenantFromHeader returns a TenantResolver using the value of the request
+// header.
+func TenantFromHeader(name string) TenantResolver {
+	return func(req *Request) (string, error) {
+		return req.Header(name), nil
+	}
+}
+
+// TenantFromParam returns a TenantResolver using the URL parameter, for routes
+// whose paths start with the tenant, e.g. /:tenant/users.
+func TenantFromParam(name string) TenantResolver {
+	return func(req *Request) (string, error) {
+		return req.Param(name), nil
+	}
+}
+
+// Tenant returns the ID of the tenant resolved for the request, or an empty
+// string.
+func (r *Request) Tenant() string {
+	return r.GetString(tenantKey{})
+}
+
+// ForTenants returns a middleware applying m to the requests of the tenants
+// only.
+func ForTenants(m Middleware, tenants ...string) Middleware {
+	return Only(m, func(r *Request) bool {
+		tenant := r.Tenant()
+		for _, t := range tenants {
+			if t == tenant {
+				return tenant != ""
+			}
+		}
+		return false
+	})
+}
+
+// perTenantMax is the maximum number of tenants PerTenant keeps a middleware
+// for.
+const perTenantMax = 10000
+
+// PerTenant returns a middleware applying a distinct middleware to the
+// requests of each tenant, created by newMiddleware on the tenant's first
+// request, e.g. so that each tenant has its own rate limit or circuit
+// breaker. Requests without a tenant use the middleware of the "" tenant.
+//
+// The middleware of the 10000 most recently seen tenants are kept; the
+// middleware of a tenant evicted beyond that is created anew on its next
+// request. Tenants resolved from client input, e.g. with TenantFromHeader,
+// should still be checked against the known tenants by the TenantResolver,
+// so that clients cannot evict the middleware of real tenants.
+func PerTenant(newMiddleware func(tenant string) Middleware) Middleware {
+	middleware := newTenantLRU(perTenantMax)
+	return func(next Endpoint) Endpoint {
+		endpoints := newTenantLRU(perTenantMax)
+		return func(ctx context.Context, req *Request) (interface{}, error) {
+			tenant := req.Tenant()
+			e := endpoints.get(tenant, func() interface{} {
+				m := middleware.get(tenant, func() interface{} {
+					return newMiddleware(tenant)
+				})
+				return m.(Middleware)(next)
+			})
+			return e.(Endpoint)(ctx, req)
+		}
+	}
+}
+
+// tenantLRU holds values per tenant, evicting the least recently used one
+// beyond its maximum size.
+type tenantLRU struct {
+	mu      sync.Mutex
+	max     int
+	order   *list.List // of *tenantEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type tenantEntry struct {
+	tenant string
+	value  interface{}
+}
+
+func newTenantLRU(max int) *tenantLRU {
+	return &tenantLRU{max: max, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// get returns the value of the tenant, calling create if there is none.
+func (c *tenantLRU) get(tenant string, create func() interface{}) interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[tenant]; ok {
+		c.order.MoveToFront(el)
+		return el.Value.(*tenantEntry).value
+	}
+	v := create()
+	c.entries[tenant] = c.order.PushFront(&tenantEntry{tenant, v})
+	if c.order.Len() > c.max {
+		oldest := c.order.Remove(c.order.Back()).(*tenantEntry)
+		delete(c.entries, oldest.tenant)
+	}
+	return v
+}
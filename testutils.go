@@ -1,6 +1,11 @@
 package jsonrest
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
@@ -8,14 +13,140 @@ import (
 
 // NewTestRequest allows construction of a Request object with its internal
 // members populated. This can be used to accomplish unit testing on endpoint handlers.
-// This should only be used in test code.
+// This should only be used in test code. Response headers set by the endpoint
+// are discarded; see TestRequestBuilder to inspect them, seed meta values or
+// send a body.
 func NewTestRequest(
 	params httprouter.Params,
 	req *http.Request,
 	route string) Request {
 	return Request{
-		params: params,
-		req:    req,
-		route:  route,
+		params:         params,
+		req:            req,
+		responseWriter: discardResponseWriter{header: make(http.Header)},
+		route:          route,
 	}
 }
+
+// A TestRequestBuilder builds a *Request to unit test endpoints, without a
+// router. The response headers set by the endpoint are recorded, see
+// ResponseHeader. It should only be used in test code; see the jsonresttest
+// package to test endpoints through a router.
+type TestRequestBuilder struct {
+	method   string
+	target   string
+	route    string
+	params   Params
+	header   http.Header
+	body     []byte
+	meta     []testMeta
+	ctx      context.Context
+	response http.Header
+}
+
+// testMeta is a meta value seeded by TestRequestBuilder.WithMeta.
+type testMeta struct {
+	key, val interface{}
+}
+
+// NewTestRequestBuilder returns a builder of a request with the method to the
+// target, a URL path optionally followed by a query string.
+func NewTestRequestBuilder(method, target string) *TestRequestBuilder {
+	return &TestRequestBuilder{
+		method:   method,
+		target:   target,
+		header:   make(http.Header),
+		response: make(http.Header),
+	}
+}
+
+// WithRoute sets the route pattern of the request, as returned by
+// Request.Route.
+func (b *TestRequestBuilder) WithRoute(route string) *TestRequestBuilder {
+	b.route = route
+	return b
+}
+
+// WithParam sets a URL parameter of the request.
+func (b *TestRequestBuilder) WithParam(name, value string) *TestRequestBuilder {
+	b.params = append(b.params, httprouter.Param{Key: name, Value: value})
+	return b
+}
+
+// WithHeader sets a request header.
+func (b *TestRequestBuilder) WithHeader(key, value string) *TestRequestBuilder {
+	b.header.Set(key, value)
+	return b
+}
+
+// WithJSON sets the request body to the JSON encoding of v. It panics if v
+// cannot be encoded.
+func (b *TestRequestBuilder) WithJSON(v interface{}) *TestRequestBuilder {
+	body, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Errorf("jsonrest: encoding test request body: %v", err))
+	}
+	return b.WithBody(body, "application/json")
+}
+
+// WithBody sets the raw request body and its content type.
+func (b *TestRequestBuilder) WithBody(body []byte, contentType string) *TestRequestBuilder {
+	b.body = body
+	b.header.Set("Content-Type", contentType)
+	return b
+}
+
+// WithMeta seeds a meta value of the request, as set by a middleware with
+// Request.Set.
+func (b *TestRequestBuilder) WithMeta(key, val interface{}) *TestRequestBuilder {
+	b.meta = append(b.meta, testMeta{key, val})
+	return b
+}
+
+// WithContext sets the context of the request.
+func (b *TestRequestBuilder) WithContext(ctx context.Context) *TestRequestBuilder {
+	b.ctx = ctx
+	return b
+}
+
+// ResponseHeader returns the response headers set by the endpoint through the
+// built requests.
+func (b *TestRequestBuilder) ResponseHeader() http.Header {
+	return b.response
+}
+
+// Build returns the request. Its context carries the request, like the
+// requests of a Router, so that RequestFromContext and MetaFromContext work.
+func (b *TestRequestBuilder) Build() *Request {
+	var body io.Reader
+	if b.body != nil {
+		body = bytes.NewReader(b.body)
+	}
+	req, err := http.NewRequest(b.method, "http://example.com"+b.target, body)
+	if err != nil {
+		panic(fmt.Errorf("jsonrest: building test request: %v", err))
+	}
+	req.RequestURI = b.target
+	req.RemoteAddr = "192.0.2.1:1234"
+	for key, vals := range b.header {
+		req.Header[key] = append([]string(nil), vals...)
+	}
+	ctx := b.ctx
+	if ctx == nil {
+		ctx = req.Context()
+	}
+
+	r := &Request{
+		params:         append(Params(nil), b.params...),
+		responseWriter: discardResponseWriter{header: b.response},
+		route:          b.route,
+	}
+	if r.route == "" {
+		r.route = req.URL.Path
+	}
+	for _, m := range b.meta {
+		r.Set(m.key, m.val)
+	}
+	r.req = req.WithContext(context.WithValue(ctx, requestKey{}, r))
+	return r
+}
@@ -0,0 +1,68 @@
+package jsonrest
+
+import (
+	"net/http"
+	"time"
+)
+
+// Timeouts is a RouteOption setting the deadlines of the connection while the
+// route handles a request: the request body must be read within read, and the
+// response written within write, from the time the request is routed. They
+// override the ReadTimeout and WriteTimeout of the http.Server for the
+// route, e.g. so that a file upload route has a long body deadline while the
+// other routes stay tight. A zero duration keeps the server's deadline, and a
+// negative duration removes it.
+//
+// The deadlines are set through the SetReadDeadline and SetWriteDeadline
+// methods of the ResponseWriter, as with http.ResponseController, which are
+// supported by the servers of the net/http package since Go 1.20; they are
+// ignored otherwise. Headers are read before the request is routed, so their
+// deadline is set by the ReadHeaderTimeout of the server.
+func Timeouts(read, write time.Duration) RouteOption {
+	return func(r *Route) {
+		r.readTimeout, r.writeTimeout = read, write
+	}
+}
+
+// WithTimeouts is an Option available for NewRouter and Group to set the
+// default Timeouts of the routes.
+func WithTimeouts(read, write time.Duration) Option {
+	return func(r *Router) {
+		r.readTimeout, r.writeTimeout = read, write
+	}
+}
+
+type readDeadliner interface {
+	SetReadDeadline(time.Time) error
+}
+
+type writeDeadliner interface {
+	SetWriteDeadline(time.Time) error
+}
+
+// setConnDeadlines sets the read and write deadlines of the connection from
+// the timeouts, if not zero.
+func setConnDeadlines(w http.ResponseWriter, read, write time.Duration) {
+	now := time.Now()
+	deadline := func(d time.Duration) time.Time {
+		if d < 0 {
+			return time.Time{}
+		}
+		return now.Add(d)
+	}
+	for w != nil && (read != 0 || write != 0) {
+		if rd, ok := w.(readDeadliner); ok && read != 0 {
+			rd.SetReadDeadline(deadline(read))
+			read = 0
+		}
+		if wd, ok := w.(writeDeadliner); ok && write != 0 {
+			wd.SetWriteDeadline(deadline(write))
+			write = 0
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return
+		}
+		w = u.Unwrap()
+	}
+}
@@ -0,0 +1,224 @@
+package jsonrest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// An HTTPRule maps an RPC method to a route, as defined by the
+// google.api.http annotation of a protobuf service method. For example:
+//
+//	HTTPRule{Method: "PATCH", Path: "/v1/users/{user.id}", Body: "user"}
+type HTTPRule struct {
+	Method string
+
+	// Path is the path template, whose variables are fields of the request
+	// message, e.g. "/v1/users/{id}" or "/v1/files/{path=**}".
+	Path string
+
+	// Body is the field of the request message bound to the request body,
+	// "*" to bind the whole message, or empty if there is no body.
+	Body string
+}
+
+// A ProtoCodec converts protobuf messages from and to JSON, e.g. with the
+// protojson package:
+//
+//	codec := jsonrest.ProtoCodec{
+//	    Marshal: func(m interface{}) ([]byte, error) {
+//	        return protojson.Marshal(m.(proto.Message))
+//	    },
+//	    Unmarshal: func(b []byte, m interface{}) error {
+//	        return protojson.Unmarshal(b, m.(proto.Message))
+//	    },
+//	}
+type ProtoCodec struct {
+	Marshal   func(m interface{}) ([]byte, error)
+	Unmarshal func(b []byte, m interface{}) error
+}
+
+// Transcode returns an endpoint calling an RPC method with a request message
+// created by newRequest and bound from the route's URL parameters, the query
+// string and the request body, as described by the rule. The response message
+// is encoded with the codec. Values bound from the URL are strings, which
+// protojson accepts for all numeric fields. Nested fields are given with
+// dotted paths, e.g. "user.id".
+//
+// It allows a gRPC service implementation to be served by a Router, using the
+// rules of its google.api.http annotations, e.g. for a generated method:
+//
+//	r.HandleRule(rule, jsonrest.Transcode(codec, rule,
+//	    func() interface{} { return new(pb.GetUserRequest) },
+//	    func(ctx context.Context, m interface{}) (interface{}, error) {
+//	        return srv.GetUser(ctx, m.(*pb.GetUserRequest))
+//	    }))
+func Transcode(codec ProtoCodec, rule HTTPRule, newRequest func() interface{}, call func(ctx context.Context, req interface{}) (interface{}, error)) Endpoint {
+	vars := templateVars(rule.Path)
+	return func(ctx context.Context, req *Request) (interface{}, error) {
+		fields := make(map[string]interface{})
+		if rule.Body != "" {
+			b, err := ioutil.ReadAll(req.Raw().Body)
+			if err != nil {
+				if httpErr, ok := err.(*HTTPError); ok {
+					return nil, httpErr
+				}
+				return nil, BadRequest("cannot read request body").Wrap(err)
+			}
+			if len(bytes.TrimSpace(b)) > 0 {
+				var body interface{}
+				if err := json.Unmarshal(b, &body); err != nil {
+					return nil, BadRequest("malformed or unexpected json").Wrap(err)
+				}
+				if rule.Body == "*" {
+					obj, ok := body.(map[string]interface{})
+					if !ok {
+						return nil, BadRequest("request body must be a JSON object")
+					}
+					fields = obj
+				} else {
+					setField(fields, rule.Body, body)
+				}
+			}
+		}
+		// Without a body binding the whole message, the other fields are
+		// bound from the query string.
+		if rule.Body != "*" {
+			for k, vals := range req.Raw().URL.Query() {
+				if k == rule.Body || strings.HasPrefix(k, rule.Body+".") {
+					continue
+				}
+				if len(vals) == 1 {
+					setField(fields, k, vals[0])
+					continue
+				}
+				list := make([]interface{}, len(vals))
+				for i, v := range vals {
+					list[i] = v
+				}
+				setField(fields, k, list)
+			}
+		}
+		// The URL parameters take precedence.
+		for _, v := range vars {
+			val := req.Param(v)
+			if strings.HasSuffix(rule.Path, "{"+v+"=**}") {
+				val = strings.TrimPrefix(val, "/")
+			}
+			setField(fields, v, val)
+		}
+
+		b, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		msg := newRequest()
+		if err := codec.Unmarshal(b, msg); err != nil {
+			return nil, BadRequest("invalid request: " + err.Error()).Wrap(err)
+		}
+		res, err := call(ctx, msg)
+		if err != nil {
+			return nil, err
+		}
+		out, err := codec.Marshal(res)
+		if err != nil {
+			return nil, err
+		}
+		return json.RawMessage(out), nil
+	}
+}
+
+// HandleRule registers the endpoint for the method and path template of the
+// rule. It panics if the template cannot be converted to a route path, e.g.
+// because it has a custom verb or a multi-segment variable which is not last,
+// unless WithRegistrationErrors is used.
+func (r *Router) HandleRule(rule HTTPRule, endpoint Endpoint, opts ...RouteOption) {
+	path, err := templatePath(rule.Path)
+	if err != nil {
+		r.registrationFailed(&RouteError{Method: rule.Method, Path: rule.Path, Err: err})
+		return
+	}
+	r.Handle(rule.Method, path, endpoint, opts...)
+}
+
+// templatePath converts a google.api.http path template to a route path, e.g.
+// "/v1/users/{id}" to "/v1/users/:id".
+func templatePath(template string) (string, error) {
+	segments := splitTemplate(strings.TrimPrefix(template, "/"))
+	for i, seg := range segments {
+		if strings.Contains(seg, ":") && !strings.HasPrefix(seg, "{") {
+			return "", fmt.Errorf("unsupported custom verb in path template %q", template)
+		}
+		if !strings.HasPrefix(seg, "{") {
+			continue
+		}
+		if !strings.HasSuffix(seg, "}") {
+			return "", fmt.Errorf("unsupported path template %q", template)
+		}
+		name, pattern := seg[1:len(seg)-1], "*"
+		if j := strings.IndexByte(name, '='); j >= 0 {
+			name, pattern = name[:j], name[j+1:]
+		}
+		switch {
+		case pattern == "*":
+			segments[i] = ":" + name
+		case pattern == "**" && i == len(segments)-1:
+			segments[i] = "*" + name
+		default:
+			return "", fmt.Errorf("unsupported variable %q in path template %q", seg, template)
+		}
+	}
+	return "/" + strings.Join(segments, "/"), nil
+}
+
+// templateVars returns the names of the variables of a path template.
+func templateVars(template string) []string {
+	var vars []string
+	for _, seg := range splitTemplate(template) {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			name := seg[1 : len(seg)-1]
+			if j := strings.IndexByte(name, '='); j >= 0 {
+				name = name[:j]
+			}
+			vars = append(vars, name)
+		}
+	}
+	return vars
+}
+
+// splitTemplate splits a path template on the slashes outside of variables.
+func splitTemplate(template string) []string {
+	var segments []string
+	depth, start := 0, 0
+	for i, c := range template {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '/':
+			if depth == 0 {
+				segments = append(segments, template[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(segments, template[start:])
+}
+
+// setField sets the field with the dotted path in the JSON object.
+func setField(obj map[string]interface{}, path string, val interface{}) {
+	parts := strings.Split(path, ".")
+	for _, p := range parts[:len(parts)-1] {
+		child, ok := obj[p].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			obj[p] = child
+		}
+		obj = child
+	}
+	obj[parts[len(parts)-1]] = val
+}
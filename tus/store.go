@@ -0,0 +1,262 @@
+package tus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Errors returned by the stores.
+var (
+	// ErrNotFound is returned for unknown uploads.
+	ErrNotFound = errors.New("tus: upload not found")
+
+	// ErrOffsetMismatch is returned when appending at an offset which is
+	// not the current offset of the upload.
+	ErrOffsetMismatch = errors.New("tus: upload offset mismatch")
+)
+
+// An Info describes an upload.
+type Info struct {
+	ID     string
+	Size   int64
+	Offset int64
+
+	// Metadata are the key-value pairs sent by the client in the
+	// Upload-Metadata header, e.g. the filename.
+	Metadata map[string]string
+}
+
+// Done reports whether the upload is complete.
+func (i Info) Done() bool {
+	return i.Offset >= i.Size
+}
+
+// A Store stores the uploads. Its methods must be safe for concurrent use.
+type Store interface {
+	// Create creates an upload of the size with the metadata, and returns
+	// its ID.
+	Create(ctx context.Context, size int64, metadata map[string]string) (string, error)
+
+	// Info returns the upload, or ErrNotFound.
+	Info(ctx context.Context, id string) (Info, error)
+
+	// Append appends the data read from r to the upload if its offset is
+	// offset, or returns ErrOffsetMismatch, and returns the updated upload.
+	// The data read before a read error is kept, so that the client can
+	// resume from there.
+	Append(ctx context.Context, id string, offset int64, r io.Reader) (Info, error)
+}
+
+// newID returns a random upload ID.
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+type memoryUpload struct {
+	mu   sync.Mutex // serializes the appends
+	info Info
+	data []byte
+}
+
+// A MemoryStore is a Store keeping the uploads in memory, for tests and small
+// uploads.
+type MemoryStore struct {
+	mu      sync.Mutex
+	uploads map[string]*memoryUpload
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{uploads: make(map[string]*memoryUpload)}
+}
+
+// Create implements the Store interface.
+func (s *MemoryStore) Create(ctx context.Context, size int64, metadata map[string]string) (string, error) {
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.uploads[id] = &memoryUpload{info: Info{ID: id, Size: size, Metadata: metadata}}
+	return id, nil
+}
+
+// Info implements the Store interface.
+func (s *MemoryStore) Info(ctx context.Context, id string) (Info, error) {
+	u, err := s.upload(id)
+	if err != nil {
+		return Info{}, err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.info, nil
+}
+
+// Append implements the Store interface.
+func (s *MemoryStore) Append(ctx context.Context, id string, offset int64, r io.Reader) (Info, error) {
+	u, err := s.upload(id)
+	if err != nil {
+		return Info{}, err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if offset != u.info.Offset {
+		return u.info, ErrOffsetMismatch
+	}
+	data, err := ioutil.ReadAll(r)
+	u.data = append(u.data, data...)
+	u.info.Offset += int64(len(data))
+	return u.info, err
+}
+
+// Data returns the data of the upload received so far.
+func (s *MemoryStore) Data(id string) ([]byte, error) {
+	u, err := s.upload(id)
+	if err != nil {
+		return nil, err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]byte(nil), u.data...), nil
+}
+
+func (s *MemoryStore) upload(id string) (*memoryUpload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.uploads[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return u, nil
+}
+
+// A FileStore is a Store keeping the uploads in a directory: the data of an
+// upload is stored in the file named after its ID with the ".bin" extension,
+// and its Info in the file with the ".json" extension.
+type FileStore struct {
+	dir string
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// NewFileStore returns a Store keeping the uploads in the directory, which is
+// created if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir, locks: make(map[string]*sync.Mutex)}, nil
+}
+
+// Path returns the path of the file holding the data of the upload.
+func (s *FileStore) Path(id string) string {
+	return filepath.Join(s.dir, id+".bin")
+}
+
+// Create implements the Store interface.
+func (s *FileStore) Create(ctx context.Context, size int64, metadata map[string]string) (string, error) {
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(s.Path(id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return id, s.writeInfo(Info{ID: id, Size: size, Metadata: metadata})
+}
+
+// Info implements the Store interface.
+func (s *FileStore) Info(ctx context.Context, id string) (Info, error) {
+	unlock := s.lock(id)
+	defer unlock()
+	return s.readInfo(id)
+}
+
+// Append implements the Store interface.
+func (s *FileStore) Append(ctx context.Context, id string, offset int64, r io.Reader) (Info, error) {
+	unlock := s.lock(id)
+	defer unlock()
+	info, err := s.readInfo(id)
+	if err != nil {
+		return info, err
+	}
+	if offset != info.Offset {
+		return info, ErrOffsetMismatch
+	}
+	f, err := os.OpenFile(s.Path(id), os.O_WRONLY, 0)
+	if err != nil {
+		return info, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return info, err
+	}
+	n, copyErr := io.Copy(f, r)
+	if err := f.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	info.Offset += n
+	if err := s.writeInfo(info); err != nil {
+		return info, err
+	}
+	return info, copyErr
+}
+
+// lock locks the upload, and returns the function unlocking it.
+func (s *FileStore) lock(id string) func() {
+	s.mu.Lock()
+	l, ok := s.locks[id]
+	if !ok {
+		l = new(sync.Mutex)
+		s.locks[id] = l
+	}
+	s.mu.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
+func (s *FileStore) readInfo(id string) (Info, error) {
+	var info Info
+	if filepath.Base(id) != id {
+		return info, ErrNotFound
+	}
+	b, err := ioutil.ReadFile(filepath.Join(s.dir, id+".json"))
+	if os.IsNotExist(err) {
+		return info, ErrNotFound
+	}
+	if err != nil {
+		return info, err
+	}
+	return info, json.Unmarshal(b, &info)
+}
+
+// writeInfo writes the info of the upload atomically.
+func (s *FileStore) writeInfo(info Info) error {
+	b, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(s.dir, info.ID+".json.tmp")
+	if err := ioutil.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.dir, info.ID+".json"))
+}
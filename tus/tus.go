@@ -0,0 +1,215 @@
+// Package tus implements the core and creation extension of the tus resumable
+// upload protocol (https://tus.io/protocols/resumable-upload) for jsonrest
+// routers, so that large files can be uploaded over flaky links: the client
+// creates an upload, sends its data with PATCH requests, and after a failure
+// asks for the offset received with a HEAD request and resumes from there.
+package tus
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	jsonrest "github.com/mbranch/jsonrest-go"
+)
+
+// Version is the version of the protocol implemented.
+const Version = "1.0.0"
+
+// Options configures the routes registered by Register.
+type Options struct {
+	// Store stores the uploads. It is required.
+	Store Store
+
+	// MaxSize is the maximum size of the uploads, if positive.
+	MaxSize int64
+
+	// OnCreate, if set, is called before an upload is created, e.g. to
+	// authorize it or validate its metadata. An error is sent as the
+	// response.
+	OnCreate func(ctx context.Context, req *jsonrest.Request, size int64, metadata map[string]string) error
+
+	// OnProgress, if set, is called after data is appended to an upload,
+	// with its updated offset.
+	OnProgress func(ctx context.Context, req *jsonrest.Request, info Info)
+
+	// OnComplete, if set, is called when an upload is complete, e.g. to
+	// process the file. An error is sent as the response of the last PATCH
+	// request.
+	OnComplete func(ctx context.Context, req *jsonrest.Request, info Info) error
+}
+
+// Register registers the routes of the protocol at the path, e.g. "/files":
+//
+//   - OPTIONS path describes the server's capabilities;
+//   - POST path creates an upload, whose URL is returned in the Location
+//     header;
+//   - HEAD path/:id returns the offset of the upload;
+//   - PATCH path/:id appends the request body to the upload.
+//
+// The route options apply to all the routes, e.g. jsonrest.Timeouts to allow
+// long PATCH requests. Errors are sent as JSON, like the router's other
+// errors.
+func Register(r *jsonrest.Router, path string, opts Options, routeOpts ...jsonrest.RouteOption) {
+	if opts.Store == nil {
+		panic("tus: Options.Store is required")
+	}
+	h := &handler{opts: opts}
+	path = strings.TrimSuffix(path, "/")
+	r.Handle(http.MethodOptions, path, h.options, routeOpts...)
+	r.Post(path, h.create, routeOpts...)
+	r.Head(path+"/:id", h.head, routeOpts...)
+	r.Handle(http.MethodPatch, path+"/:id", h.patch, routeOpts...)
+}
+
+type handler struct {
+	opts Options
+}
+
+var (
+	errVersion = jsonrest.Error(http.StatusPreconditionFailed, "unsupported_version", "unsupported Tus-Resumable version")
+	errOffset  = jsonrest.Error(http.StatusConflict, "offset_mismatch", "Upload-Offset does not match the offset of the upload")
+	errTooBig  = jsonrest.Error(http.StatusRequestEntityTooLarge, "upload_too_large", "upload exceeds the maximum size")
+)
+
+// checkVersion sets the Tus-Resumable response header and checks the version
+// requested by the client.
+func checkVersion(req *jsonrest.Request) error {
+	req.SetResponseHeader("Tus-Resumable", Version)
+	if req.Header("Tus-Resumable") != Version {
+		req.SetResponseHeader("Tus-Version", Version)
+		return errVersion
+	}
+	return nil
+}
+
+func (h *handler) options(ctx context.Context, req *jsonrest.Request) (interface{}, error) {
+	req.SetResponseHeader("Tus-Resumable", Version)
+	req.SetResponseHeader("Tus-Version", Version)
+	req.SetResponseHeader("Tus-Extension", "creation")
+	if h.opts.MaxSize > 0 {
+		req.SetResponseHeader("Tus-Max-Size", strconv.FormatInt(h.opts.MaxSize, 10))
+	}
+	return jsonrest.Response{StatusCode: http.StatusNoContent}, nil
+}
+
+func (h *handler) create(ctx context.Context, req *jsonrest.Request) (interface{}, error) {
+	if err := checkVersion(req); err != nil {
+		return nil, err
+	}
+	size, err := strconv.ParseInt(req.Header("Upload-Length"), 10, 64)
+	if err != nil || size < 0 {
+		return nil, jsonrest.BadRequest("invalid Upload-Length header")
+	}
+	if h.opts.MaxSize > 0 && size > h.opts.MaxSize {
+		return nil, errTooBig
+	}
+	metadata, err := parseMetadata(req.Header("Upload-Metadata"))
+	if err != nil {
+		return nil, jsonrest.BadRequest("invalid Upload-Metadata header").Wrap(err)
+	}
+	if h.opts.OnCreate != nil {
+		if err := h.opts.OnCreate(ctx, req, size, metadata); err != nil {
+			return nil, err
+		}
+	}
+	id, err := h.opts.Store.Create(ctx, size, metadata)
+	if err != nil {
+		return nil, err
+	}
+	req.SetResponseHeader("Location", strings.TrimSuffix(req.URL().Path, "/")+"/"+id)
+	req.SetResponseHeader("Upload-Offset", "0")
+	return jsonrest.Response{StatusCode: http.StatusCreated}, nil
+}
+
+func (h *handler) head(ctx context.Context, req *jsonrest.Request) (interface{}, error) {
+	if err := checkVersion(req); err != nil {
+		return nil, err
+	}
+	info, err := h.info(ctx, req.Param("id"))
+	if err != nil {
+		return nil, err
+	}
+	req.SetResponseHeader("Cache-Control", "no-store")
+	req.SetResponseHeader("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+	req.SetResponseHeader("Upload-Length", strconv.FormatInt(info.Size, 10))
+	return nil, nil
+}
+
+func (h *handler) patch(ctx context.Context, req *jsonrest.Request) (interface{}, error) {
+	if err := checkVersion(req); err != nil {
+		return nil, err
+	}
+	if req.Header("Content-Type") != "application/offset+octet-stream" {
+		return nil, jsonrest.Error(http.StatusUnsupportedMediaType, "unsupported_media_type", "Content-Type must be application/offset+octet-stream")
+	}
+	offset, err := strconv.ParseInt(req.Header("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return nil, jsonrest.BadRequest("invalid Upload-Offset header")
+	}
+	id := req.Param("id")
+	info, err := h.info(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != info.Offset {
+		return nil, errOffset
+	}
+
+	// The data beyond the size of the upload is not read.
+	body := io.LimitReader(req.Raw().Body, info.Size-offset)
+	info, err = h.opts.Store.Append(ctx, id, offset, body)
+	if err == ErrOffsetMismatch {
+		return nil, errOffset
+	}
+	if info.Offset > offset && h.opts.OnProgress != nil {
+		h.opts.OnProgress(ctx, req, info)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.Done() && h.opts.OnComplete != nil {
+		if err := h.opts.OnComplete(ctx, req, info); err != nil {
+			return nil, err
+		}
+	}
+	req.SetResponseHeader("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+	return jsonrest.Response{StatusCode: http.StatusNoContent}, nil
+}
+
+// info returns the upload, or a 404 error.
+func (h *handler) info(ctx context.Context, id string) (Info, error) {
+	info, err := h.opts.Store.Info(ctx, id)
+	if err == ErrNotFound {
+		return info, jsonrest.NotFound("upload not found")
+	}
+	return info, err
+}
+
+// parseMetadata parses the Upload-Metadata header: comma-separated pairs of a
+// key and an optional base64-encoded value, separated by a space.
+func parseMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, errors.New("malformed key-value pair")
+		}
+		var value []byte
+		if len(fields) == 2 {
+			var err error
+			if value, err = base64.StdEncoding.DecodeString(fields[1]); err != nil {
+				return nil, err
+			}
+		}
+		metadata[fields[0]] = string(value)
+	}
+	return metadata, nil
+}
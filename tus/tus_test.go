@@ -0,0 +1,119 @@
+package tus_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mbranch/assert-go"
+	jsonrest "github.com/mbranch/jsonrest-go"
+	"github.com/mbranch/jsonrest-go/tus"
+)
+
+func TestUpload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tus")
+	assert.Must(t, err)
+	defer os.RemoveAll(dir)
+	fileStore, err := tus.NewFileStore(dir)
+	assert.Must(t, err)
+
+	for name, store := range map[string]tus.Store{"memory": tus.NewMemoryStore(), "file": fileStore} {
+		t.Run(name, func(t *testing.T) {
+			var progress []int64
+			var completed tus.Info
+			r := jsonrest.NewRouter()
+			tus.Register(r, "/files", tus.Options{
+				Store:   store,
+				MaxSize: 1 << 20,
+				OnProgress: func(ctx context.Context, req *jsonrest.Request, info tus.Info) {
+					progress = append(progress, info.Offset)
+				},
+				OnComplete: func(ctx context.Context, req *jsonrest.Request, info tus.Info) error {
+					completed = info
+					return nil
+				},
+			})
+
+			send := func(method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(method, path, strings.NewReader(body))
+				req.Header.Set("Tus-Resumable", "1.0.0")
+				for k, v := range header {
+					req.Header.Set(k, v)
+				}
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				return w
+			}
+
+			w := send("OPTIONS", "/files", "", nil)
+			assert.Equal(t, w.Code, 204)
+			assert.Equal(t, w.Header().Get("Tus-Extension"), "creation")
+			assert.Equal(t, w.Header().Get("Tus-Max-Size"), "1048576")
+
+			w = send("POST", "/files", "", map[string]string{"Upload-Length": "11", "Upload-Metadata": "filename aGVsbG8udHh0,draft"})
+			assert.Equal(t, w.Code, 201)
+			location := w.Header().Get("Location")
+			assert.True(t, strings.HasPrefix(location, "/files/"))
+
+			patch := map[string]string{"Content-Type": "application/offset+octet-stream", "Upload-Offset": "0"}
+			w = send("PATCH", location, "hello ", patch)
+			assert.Equal(t, w.Code, 204)
+			assert.Equal(t, w.Header().Get("Upload-Offset"), "6")
+
+			// The client lost the response, and asks where to resume.
+			w = send("HEAD", location, "", nil)
+			assert.Equal(t, w.Code, 200)
+			assert.Equal(t, w.Header().Get("Upload-Offset"), "6")
+			assert.Equal(t, w.Header().Get("Upload-Length"), "11")
+
+			w = send("PATCH", location, "world", patch)
+			assert.Equal(t, w.Code, 409)
+			assert.JSONEqual(t, w.Body.String(), map[string]interface{}{"error": map[string]interface{}{
+				"code":    "offset_mismatch",
+				"message": "Upload-Offset does not match the offset of the upload",
+			}})
+
+			patch["Upload-Offset"] = "6"
+			w = send("PATCH", location, "world and more", patch)
+			assert.Equal(t, w.Code, 204)
+			assert.Equal(t, w.Header().Get("Upload-Offset"), "11")
+			assert.Equal(t, progress, []int64{6, 11})
+			assert.Equal(t, completed.Size, int64(11))
+			assert.Equal(t, completed.Metadata, map[string]string{"filename": "hello.txt", "draft": ""})
+
+			var data []byte
+			id := strings.TrimPrefix(location, "/files/")
+			if ms, ok := store.(*tus.MemoryStore); ok {
+				data, err = ms.Data(id)
+			} else {
+				data, err = ioutil.ReadFile(fileStore.Path(id))
+			}
+			assert.Must(t, err)
+			assert.Equal(t, string(data), "hello world")
+		})
+	}
+}
+
+func TestUploadErrors(t *testing.T) {
+	r := jsonrest.NewRouter()
+	tus.Register(r, "/files", tus.Options{Store: tus.NewMemoryStore(), MaxSize: 10})
+
+	do := func(method, path string, header map[string]string) int {
+		req := httptest.NewRequest(method, path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, do("POST", "/files", map[string]string{"Upload-Length": "5"}), http.StatusPreconditionFailed)
+	assert.Equal(t, do("POST", "/files", map[string]string{"Tus-Resumable": "1.0.0", "Upload-Length": "50"}), http.StatusRequestEntityTooLarge)
+	assert.Equal(t, do("POST", "/files", map[string]string{"Tus-Resumable": "1.0.0"}), http.StatusBadRequest)
+	assert.Equal(t, do("HEAD", "/files/unknown", map[string]string{"Tus-Resumable": "1.0.0"}), http.StatusNotFound)
+	assert.Equal(t, do("PATCH", "/files/unknown", map[string]string{"Tus-Resumable": "1.0.0", "Upload-Offset": "0"}), http.StatusUnsupportedMediaType)
+}
@@ -0,0 +1,85 @@
+package jsonrest
+
+import (
+	"context"
+)
+
+// UnitOfWork describes a resource, such as a database transaction, which is
+// begun before an endpoint is called and committed or rolled back once it
+// returns.
+type UnitOfWork struct {
+	// Begin starts the unit of work for the request.
+	Begin func(ctx context.Context, req *Request) (interface{}, error)
+
+	// Commit is called if the endpoint succeeded. An error returned by Commit
+	// is returned instead of the endpoint's result.
+	Commit func(ctx context.Context, uow interface{}) error
+
+	// Rollback is called if the endpoint returned an error or a Response
+	// with an error status code, or panicked.
+	Rollback func(ctx context.Context, uow interface{}) error
+}
+
+type unitOfWorkKey struct{}
+
+// UnitOfWorkMiddleware returns a middleware which wraps each request in the
+// given unit of work. The value returned by Begin is available to the endpoint
+// through UnitOfWorkFromContext.
+//
+// For example, a service using database/sql might use:
+//
+//	r.Use(jsonrest.UnitOfWorkMiddleware(jsonrest.UnitOfWork{
+//	    Begin: func(ctx context.Context, req *jsonrest.Request) (interface{}, error) {
+//	        return db.BeginTx(ctx, nil)
+//	    },
+//	    Commit: func(ctx context.Context, tx interface{}) error {
+//	        return tx.(*sql.Tx).Commit()
+//	    },
+//	    Rollback: func(ctx context.Context, tx interface{}) error {
+//	        return tx.(*sql.Tx).Rollback()
+//	    },
+//	}))
+//
+//	func Tx(ctx context.Context) *sql.Tx {
+//	    tx, _ := jsonrest.UnitOfWorkFromContext(ctx).(*sql.Tx)
+//	    return tx
+//	}
+func UnitOfWorkMiddleware(uow UnitOfWork) Middleware {
+	return func(next Endpoint) Endpoint {
+		return func(ctx context.Context, req *Request) (interface{}, error) {
+			val, err := uow.Begin(ctx, req)
+			if err != nil {
+				return nil, err
+			}
+			ctx = context.WithValue(ctx, unitOfWorkKey{}, val)
+
+			committed := false
+			defer func() {
+				if !committed {
+					// Rollback errors are superseded by the endpoint's error or
+					// panic.
+					_ = uow.Rollback(ctx, val)
+				}
+			}()
+
+			result, err := next(ctx, req)
+			if err != nil {
+				return nil, err
+			}
+			if res, ok := result.(Response); ok && res.StatusCode >= 400 {
+				return result, nil
+			}
+			committed = true
+			if err := uow.Commit(ctx, val); err != nil {
+				return nil, err
+			}
+			return result, nil
+		}
+	}
+}
+
+// UnitOfWorkFromContext returns the value begun by UnitOfWorkMiddleware for
+// the request, or nil if there is none.
+func UnitOfWorkFromContext(ctx context.Context) interface{} {
+	return ctx.Value(unitOfWorkKey{})
+}
@@ -0,0 +1,54 @@
+package jsonrest
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Hijack lets the endpoint take over the connection, e.g. to implement a
+// protocol upgrade. The response is not written by the router once the
+// connection is hijacked. See http.Hijacker.
+func (r *Request) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := r.responseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("jsonrest: response writer does not support hijacking")
+	}
+	conn, rw, err := hj.Hijack()
+	if err == nil {
+		r.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Upgrade returns an endpoint handing the requests to upgrade the connection
+// to the protocol, e.g. "websocket", to h, which performs the handshake
+// (e.g. with a WebSocket library) and takes over the connection. Other
+// requests are answered with a 426 Upgrade Required error. The router's
+// middleware, e.g. for authentication, is applied before the upgrade.
+func Upgrade(protocol string, h http.Handler) Endpoint {
+	return func(ctx context.Context, req *Request) (interface{}, error) {
+		if !headerHasToken(req.Raw().Header, "Connection", "upgrade") ||
+			!headerHasToken(req.Raw().Header, "Upgrade", protocol) {
+			req.SetResponseHeader("Upgrade", protocol)
+			return nil, Error(http.StatusUpgradeRequired, "upgrade_required", "upgrade to "+protocol+" required")
+		}
+		return ServeHandler(h), nil
+	}
+}
+
+// headerHasToken reports whether the comma-separated values of the header
+// contain the token, case-insensitively.
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
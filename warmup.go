@@ -0,0 +1,149 @@
+package jsonrest
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// errWarmingUp is returned when a request is received before the warm-up
+// hooks have succeeded.
+var errWarmingUp = Error(http.StatusServiceUnavailable, "unavailable", "service is warming up")
+
+// warmupRetryBackoff is how long requests are rejected with errWarmingUp after
+// a failed lazy warm-up, before the next request runs the hooks again.
+const warmupRetryBackoff = 5 * time.Second
+
+// WithWarmup is an Option available for NewRouter to register a hook that
+// primes caches, connection pools, etc. before the router serves traffic.
+// Hooks are run in order by Warmup or ListenAndServe. If neither was called,
+// they are run lazily by the first request, which waits for them to complete.
+// If they fail, the requests are rejected with a 503 error for 5 seconds
+// before the hooks are run again. Warm-up hooks registered on groups are
+// ignored.
+func WithWarmup(fn func(ctx context.Context) error) Option {
+	return func(r *Router) {
+		r.warmups = append(r.warmups, fn)
+	}
+}
+
+// OnStart registers a warm-up hook, like WithWarmup, e.g. for cache priming or
+// connection checks declared next to the routes needing them. It must be
+// called before the router serves traffic.
+func (r *Router) OnStart(fn func(ctx context.Context) error) {
+	root := r.root()
+	root.warmupMu.Lock()
+	defer root.warmupMu.Unlock()
+	root.warmups = append(root.warmups, fn)
+}
+
+// WithWarmupTimeout is an Option available for NewRouter to bound the
+// duration of each run of the warm-up hooks. The context of the hooks is
+// canceled after the timeout, and Warmup returns the context's error if the
+// hooks did not complete in time.
+func WithWarmupTimeout(timeout time.Duration) Option {
+	return func(r *Router) {
+		if r.parent != nil {
+			return
+		}
+		r.warmupTimeout = timeout
+	}
+}
+
+// WithReadinessProbe is an Option available for NewRouter to serve a readiness
+// probe at the path, e.g. "/readyz", for load balancers and orchestrators. It
+// answers with a 200 status once the warm-up hooks have succeeded, and with a
+// 503 error before, without waiting: the first probe starts the warm-up in
+// the background if neither Warmup nor ListenAndServe was called, so that
+// readiness only flips after the warm-up succeeds.
+func WithReadinessProbe(path string) Option {
+	return func(r *Router) {
+		if r.parent != nil {
+			return
+		}
+		r.readinessPath = path
+	}
+}
+
+// Warmup runs the router's warm-up hooks, stopping at the first error. Once
+// all hooks have succeeded, the router is ready and subsequent calls are
+// no-ops; otherwise, the hooks are run again by the next call.
+func (r *Router) Warmup(ctx context.Context) error {
+	r.warmupMu.Lock()
+	defer r.warmupMu.Unlock()
+	return r.warmupLocked(ctx)
+}
+
+// lazyWarmup runs the warm-up hooks for a request, unless they failed less
+// than warmupRetryBackoff ago, in which case errWarmingUp is returned, so
+// that a failing dependency is not retried by every request in turn.
+func (r *Router) lazyWarmup(ctx context.Context) error {
+	r.warmupMu.Lock()
+	defer r.warmupMu.Unlock()
+	if !r.Ready() && time.Since(r.warmupFailedAt) < warmupRetryBackoff {
+		return errWarmingUp
+	}
+	err := r.warmupLocked(ctx)
+	if err != nil {
+		r.warmupFailedAt = time.Now()
+	}
+	return err
+}
+
+// warmupLocked runs the warm-up hooks, with r.warmupMu held.
+func (r *Router) warmupLocked(ctx context.Context) error {
+	if r.Ready() {
+		return nil
+	}
+	if r.warmupTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.warmupTimeout)
+		defer cancel()
+	}
+	for _, fn := range r.warmups {
+		if err := fn(ctx); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	atomic.StoreInt32(&r.warmedUp, 1)
+	return nil
+}
+
+// Ready reports whether the router's warm-up hooks have succeeded. It can be
+// used to implement a readiness probe, see WithReadinessProbe.
+func (r *Router) Ready() bool {
+	return len(r.warmups) == 0 || atomic.LoadInt32(&r.warmedUp) == 1
+}
+
+// serveReadiness serves the readiness probe, starting the warm-up in the
+// background if the router is not ready.
+func (r *Router) serveReadiness(w http.ResponseWriter, req *http.Request) {
+	if r.Ready() {
+		r.sendJSON(w, req, http.StatusOK, M{"status": "ready"})
+		return
+	}
+	if atomic.CompareAndSwapInt32(&r.warmingUp, 0, 1) {
+		go func() {
+			defer atomic.StoreInt32(&r.warmingUp, 0)
+			if err := r.Warmup(context.Background()); err != nil {
+				log.Printf("jsonrest: warm-up failed: %v", err)
+			}
+		}()
+	}
+	r.sendError(w, req, errWarmingUp)
+}
+
+// ListenAndServe runs the warm-up hooks and then listens on the TCP network
+// address addr, serving requests with the router. Traffic is only accepted
+// once the warm-up has succeeded.
+func (r *Router) ListenAndServe(addr string) error {
+	if err := r.Warmup(context.Background()); err != nil {
+		return err
+	}
+	return http.ListenAndServe(addr, r)
+}
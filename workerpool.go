@@ -0,0 +1,103 @@
+package jsonrest
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// A WorkerPool executes the requests of designated routes on a bounded number
+// of goroutines, so that expensive endpoints cannot starve cheap ones. Requests
+// wait in a bounded queue for a free worker; requests arriving when the queue
+// is full are rejected with a 503 Service Unavailable error.
+type WorkerPool struct {
+	// slots bounds the number of requests running or queued.
+	slots     chan struct{}
+	jobs      chan func()
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// NewWorkerPool returns a worker pool running workers goroutines, with room
+// for queueSize waiting requests.
+func NewWorkerPool(workers, queueSize int) *WorkerPool {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	p := &WorkerPool{
+		slots: make(chan struct{}, workers+queueSize),
+		jobs:  make(chan func(), workers+queueSize),
+	}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer p.wg.Done()
+			for job := range p.jobs {
+				job()
+			}
+		}()
+	}
+	return p
+}
+
+// Close stops the workers once the queued requests are handled. No request
+// must be dispatched to the pool after it is closed.
+func (p *WorkerPool) Close() {
+	p.closeOnce.Do(func() {
+		close(p.jobs)
+	})
+	p.wg.Wait()
+}
+
+// RunOn is a RouteOption that executes the route's requests on the worker
+// pool. The pool may be shared by several routes.
+func RunOn(pool *WorkerPool) RouteOption {
+	return func(r *Route) {
+		r.pool = pool
+	}
+}
+
+// Job states of a request queued on a worker pool.
+const (
+	jobQueued int32 = iota
+	jobRunning
+	jobAbandoned
+)
+
+// poolHandle wraps the handle to execute it on the worker pool.
+func poolHandle(p *WorkerPool, h Handle, r *Router) Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps Params) {
+		state := jobQueued
+		done := make(chan struct{})
+		job := func() {
+			defer func() { <-p.slots }()
+			if !atomic.CompareAndSwapInt32(&state, jobQueued, jobRunning) {
+				return
+			}
+			defer close(done)
+			h(w, req, ps)
+		}
+
+		select {
+		case p.slots <- struct{}{}:
+			p.jobs <- job
+		default:
+			r.sendError(w, req, errOverloaded)
+			return
+		}
+
+		select {
+		case <-done:
+		case <-req.Context().Done():
+			if atomic.CompareAndSwapInt32(&state, jobQueued, jobAbandoned) {
+				// The request was canceled or timed out while queued.
+				r.sendError(w, req, errOverloaded)
+				return
+			}
+			<-done
+		}
+	}
+}